@@ -0,0 +1,230 @@
+package achievements
+
+import (
+	"fmt"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// Achievement is a db structure recording that a user has unlocked a Rule.
+type Achievement struct {
+	ID          string    `json:"-" xml:"-" gorethink:"id"`
+	User        string    `json:"user" xml:"user" gorethink:"user"`
+	Rule        string    `json:"achievement" xml:"achievement" gorethink:"rule"`
+	Name        string    `json:"name" xml:"name" gorethink:"name"`
+	Description string    `json:"description" xml:"description" gorethink:"description"`
+	UnlockedAt  time.Time `json:"unlocked_at" xml:"unlocked_at" gorethink:"unlocked_at"`
+	// Private achievements are only unlocked when counting the user's
+	// private visits, so they are only shown to the user.
+	Private bool `json:"private,omitempty" xml:"private,omitempty" gorethink:"private"`
+}
+
+// achievementId returns the id of a user's Achievement for a rule.
+func achievementId(userId, ruleId string) string {
+	return userId + "/" + ruleId
+}
+
+// Client acts as an api to evaluating & retreiving user achievements.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table  string
+	Rules  []Rule
+	Visits *visits.Client
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// Rules returns the configured rules.
+func (c *Client) Rules() []Rule {
+	return c.config.Rules
+}
+
+// Get retrieves the achievements a user has unlocked.
+func (c *Client) Get(userId string) ([]Achievement, error) {
+	result, err := r.Table(c.config.Table).GetAllByIndex("user", userId).OrderBy("unlocked_at").Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get achievements: %s", err.Error())
+	}
+	achs := make([]Achievement, 0)
+	var a Achievement
+	for result.Next(&a) {
+		achs = append(achs, a)
+		a = Achievement{}
+	}
+	return achs, nil
+}
+
+// Evaluate checks every rule against a user's visits, unlocking newly
+// satisfied achievements & removing those which are no longer satisfied
+// (ie: after a visit is deleted). Like summaries, achievements are evaluated
+// from scratch so that replaying a change is harmless.
+func (c *Client) Evaluate(userId string) error {
+	all, err := c.config.Visits.GetTotals(userId, false)
+	if err != nil {
+		return err
+	}
+	public := all
+	if all.Private > 0 {
+		if public, err = c.config.Visits.GetTotals(userId, true); err != nil {
+			return err
+		}
+	}
+	states, cities := all.States(), all.CityIDs()
+	publicStates, publicCities := public.States(), public.CityIDs()
+
+	existing, err := c.Get(userId)
+	if err != nil {
+		return err
+	}
+	unlocked := make(map[string]Achievement)
+	for _, a := range existing {
+		unlocked[a.Rule] = a
+	}
+
+	for _, rl := range c.config.Rules {
+		a, ok := unlocked[rl.ID]
+		delete(unlocked, rl.ID)
+		if !rl.Satisfied(states, cities) {
+			if ok {
+				if _, err := r.Table(c.config.Table).Get(a.ID).Delete().RunWrite(c.session); err != nil {
+					return fmt.Errorf("unable to remove achievement: %s", err.Error())
+				}
+			}
+			continue
+		}
+		private := !rl.Satisfied(publicStates, publicCities)
+		if ok && a.Private == private {
+			continue
+		}
+		if !ok {
+			a = Achievement{
+				ID:          achievementId(userId, rl.ID),
+				User:        userId,
+				Rule:        rl.ID,
+				Name:        rl.Name,
+				Description: rl.Description,
+				UnlockedAt:  time.Now(),
+			}
+		}
+		a.Private = private
+		if _, err := r.Table(c.config.Table).Insert(a, r.InsertOpts{Conflict: "replace"}).RunWrite(c.session); err != nil {
+			return fmt.Errorf("unable to save achievement: %s", err.Error())
+		}
+	}
+
+	// Remove achievements whose rules are no longer configured.
+	for _, a := range unlocked {
+		if _, err := r.Table(c.config.Table).Get(a.ID).Delete().RunWrite(c.session); err != nil {
+			return fmt.Errorf("unable to remove achievement: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// EvaluateAll evaluates the achievements of every user with visits or
+// achievements.
+func (c *Client) EvaluateAll() error {
+	users, err := c.config.Visits.GetUsers()
+	if err != nil {
+		return err
+	}
+	result, err := r.Table(c.config.Table).Distinct(r.DistinctOpts{Index: "user"}).Run(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to get achievement users: %s", err.Error())
+	}
+	var u string
+	for result.Next(&u) {
+		users = append(users, u)
+	}
+	seen := make(map[string]bool)
+	for _, u := range users {
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		if err := c.Evaluate(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the achievements' outbox queue.
+func (c *Client) Name() string {
+	return "achievements"
+}
+
+// Publish evaluates the achievements of the user whose visit an outbox event
+// changed, which makes Client an outbox sink. Since the outbox queues events
+// until they are published, changes made while the service is down are
+// evaluated once it is back up.
+func (c *Client) Publish(e *visits.Event) error {
+	if e.Visit == nil {
+		return nil
+	}
+	return c.Evaluate(e.Visit.User)
+}
+
+// UnlockFeed is a feed of newly unlocked achievements. Achievements which
+// were unlocked privately (see Achievement.Private) are sent again once they
+// are unlocked publicly.
+type UnlockFeed struct {
+	cursor *r.Cursor
+	repeat bool
+}
+
+// unlock is a change of the achievements change-feed.
+type unlock struct {
+	Old *Achievement `gorethink:"old_val"`
+	New *Achievement `gorethink:"new_val"`
+}
+
+// Next grabs the next unlocked Achievement from the feed.
+func (uf *UnlockFeed) Next(a *Achievement) bool {
+	var u unlock
+	if !uf.cursor.Next(&u) || u.New == nil {
+		return false
+	}
+	*a = *u.New
+	uf.repeat = u.Old != nil
+	return true
+}
+
+// Repeat reports whether the last Achievement grabbed by Next was sent
+// before, when it was unlocked privately, so that only its user has seen
+// it.
+func (uf *UnlockFeed) Repeat() bool {
+	return uf.repeat
+}
+
+// Close closes the feed.
+func (uf *UnlockFeed) Close() error {
+	return uf.cursor.Close()
+}
+
+// Unlocks opens a feed of achievements as they are unlocked.
+func (c *Client) Unlocks() (*UnlockFeed, error) {
+	cursor, err := r.Table(c.config.Table).Changes().Filter(func(ch r.Term) r.Term {
+		return ch.Field("new_val").Ne(nil).And(r.Or(
+			ch.Field("old_val").Eq(nil),
+			ch.Field("old_val").Field("private").And(ch.Field("new_val").Field("private").Not()),
+		))
+	}).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open achievements change-feed: %s", err.Error())
+	}
+	return &UnlockFeed{cursor: cursor}, nil
+}
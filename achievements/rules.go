@@ -0,0 +1,115 @@
+package achievements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Kinds of places which rules count.
+const (
+	KindStates = "states"
+	KindCities = "cities"
+)
+
+// Rule is a declarative achievement: visiting at least Min of the Places of
+// a Kind. Places are 2-letter states or city ids ("City,ST"). An empty list
+// of places counts any place, while a zero Min requires all of the places.
+type Rule struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Kind        string   `json:"kind"`
+	Places      []string `json:"places,omitempty"`
+	Min         int      `json:"min,omitempty"`
+}
+
+// Goal returns the number of places which must be visited.
+func (rl *Rule) Goal() int {
+	if rl.Min > 0 {
+		return rl.Min
+	}
+	return len(rl.Places)
+}
+
+// Progress returns the number of the rule's places which are among the given
+// visited states & cities. Progress is capped at the goal.
+func (rl *Rule) Progress(states, cities []string) int {
+	visited := states
+	if rl.Kind == KindCities {
+		visited = cities
+	}
+	n := len(visited)
+	if len(rl.Places) > 0 {
+		seen := make(map[string]bool)
+		for _, p := range visited {
+			seen[strings.ToUpper(p)] = true
+		}
+		n = 0
+		for _, p := range rl.Places {
+			if seen[strings.ToUpper(p)] {
+				n++
+			}
+		}
+	}
+	if n > rl.Goal() {
+		return rl.Goal()
+	}
+	return n
+}
+
+// Satisfied reports whether the given visited states & cities unlock the
+// rule.
+func (rl *Rule) Satisfied(states, cities []string) bool {
+	return rl.Progress(states, cities) >= rl.Goal()
+}
+
+// Validate returns a non-nil error for an invalid Rule.
+func (rl *Rule) Validate() error {
+	if rl.ID == "" {
+		return errors.New("missing 'id' field")
+	}
+	if rl.Name == "" {
+		return errors.New("missing 'name' field")
+	}
+	if rl.Kind != KindStates && rl.Kind != KindCities {
+		return fmt.Errorf("'kind' must be %q or %q", KindStates, KindCities)
+	}
+	if rl.Min < 0 || (len(rl.Places) > 0 && rl.Min > len(rl.Places)) {
+		return errors.New("'min' must be between 0 and the number of places")
+	}
+	if rl.Goal() == 0 {
+		return errors.New("either 'places' or 'min' is required")
+	}
+	return nil
+}
+
+// LoadRules reads a JSON list of rules from a file.
+func LoadRules(path string) ([]Rule, error) {
+	js, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open achievement rules: %s", err.Error())
+	}
+	return ParseRules(js)
+}
+
+// ParseRules decodes & validates a JSON list of rules.
+func ParseRules(js []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(js, &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse achievement rules: %s", err.Error())
+	}
+	ids := make(map[string]bool)
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("invalid achievement rule %d: %s", i, err.Error())
+		}
+		if ids[rules[i].ID] {
+			return nil, fmt.Errorf("duplicate achievement rule: %s", rules[i].ID)
+		}
+		ids[rules[i].ID] = true
+	}
+	return rules, nil
+}
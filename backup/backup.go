@@ -0,0 +1,284 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/dancannon/gorethink/types"
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// Format & Version are written in the header of every archive. Version is
+// increased whenever the rows of an archive change in a way which older
+// versions of the service could not restore. Since version 2, archives
+// include deleted visits (see visits.Visit.DeletedAt), which older versions
+// would restore as if they had not been deleted.
+const (
+	Format  = "beenthere-backup"
+	Version = 2
+)
+
+// Tables of an archive. They are named independently of the configured db
+// tables so that archives can be restored into any environment.
+const (
+	TableVisits = "visits"
+	TableCities = "cities"
+)
+
+// batchSize is the number of rows inserted per query when restoring.
+const batchSize = 500
+
+// Conflict decides what happens to restored rows whose id already exists.
+type Conflict string
+
+const (
+	// ConflictSkip keeps the existing row.
+	ConflictSkip Conflict = "skip"
+	// ConflictOverwrite replaces the existing row with the restored one.
+	ConflictOverwrite Conflict = "overwrite"
+)
+
+// Header is the first line of an archive.
+type Header struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Tables  []string  `json:"tables"`
+}
+
+// line is every line of an archive after the header.
+type line struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// city is a locations.City including the fields which the api hides.
+type city struct {
+	ID       string       `json:"id" gorethink:"id"`
+	Name     string       `json:"name,omitempty" gorethink:"name,omitempty"`
+	State    string       `json:"state" gorethink:"state"`
+	Location *types.Point `json:"location,omitempty" gorethink:"location,omitempty"`
+	Verified bool         `json:"verified,omitempty" gorethink:"verified"`
+}
+
+// Stats counts the rows of a table which were backed up or restored.
+type Stats struct {
+	Rows      int `json:"rows"`
+	Inserted  int `json:"inserted"`
+	Skipped   int `json:"skipped"`
+	Overwrote int `json:"overwrote"`
+}
+
+// Client backs up & restores the visits & cities tables as gzipped NDJSON
+// archives: a Header line followed by a line per row.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	VisitsTable string
+	CitiesTable string
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// table maps an archive table to its db table & the type of its rows.
+func (c *Client) table(name string) (string, func() interface{}, bool) {
+	switch name {
+	case TableVisits:
+		return c.config.VisitsTable, func() interface{} { return &visits.Visit{} }, true
+	case TableCities:
+		return c.config.CitiesTable, func() interface{} { return &city{} }, true
+	}
+	return "", nil, false
+}
+
+// Backup writes an archive of every visit & city to w.
+func (c *Client) Backup(w io.Writer) (map[string]*Stats, error) {
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	tables := []string{TableVisits, TableCities}
+	if err := enc.Encode(Header{
+		Format:  Format,
+		Version: Version,
+		Created: time.Now().UTC(),
+		Tables:  tables,
+	}); err != nil {
+		return nil, fmt.Errorf("unable to write backup header: %s", err.Error())
+	}
+
+	stats := make(map[string]*Stats)
+	for _, name := range tables {
+		st := &Stats{}
+		stats[name] = st
+		dbTable, newRow, _ := c.table(name)
+		cur, err := r.Table(dbTable).OrderBy(r.OrderByOpts{Index: "id"}).Run(c.session)
+		if err != nil {
+			return nil, fmt.Errorf("unable to query %s: %s", name, err.Error())
+		}
+		row := newRow()
+		for cur.Next(row) {
+			js, err := json.Marshal(row)
+			if err != nil {
+				cur.Close()
+				return nil, fmt.Errorf("unable to encode %s row: %s", name, err.Error())
+			}
+			if err := enc.Encode(line{Table: name, Row: js}); err != nil {
+				cur.Close()
+				return nil, fmt.Errorf("unable to write backup: %s", err.Error())
+			}
+			st.Rows++
+			row = newRow()
+		}
+		err = cur.Err()
+		cur.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", name, err.Error())
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("unable to write backup: %s", err.Error())
+	}
+	return stats, nil
+}
+
+// Restore writes the rows of an archive read from rd into the db, resolving
+// rows which already exist by conflict. Tables must already exist.
+func (c *Client) Restore(rd io.Reader, conflict Conflict) (map[string]*Stats, error) {
+	if conflict != ConflictSkip && conflict != ConflictOverwrite {
+		return nil, fmt.Errorf("unknown conflict option: %q", conflict)
+	}
+	gz, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read backup: %s", err.Error())
+	}
+	defer gz.Close()
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !sc.Scan() {
+		return nil, fmt.Errorf("unable to read backup header: %s", scanErr(sc))
+	}
+	hdr := Header{}
+	if err := json.Unmarshal(sc.Bytes(), &hdr); err != nil || hdr.Format != Format {
+		return nil, fmt.Errorf("unable to read backup header: not a %s archive", Format)
+	}
+	if hdr.Version < 1 || hdr.Version > Version {
+		return nil, fmt.Errorf("unsupported backup version: %d (expected at most %d)", hdr.Version, Version)
+	}
+
+	stats := make(map[string]*Stats)
+	batches := make(map[string][]interface{})
+	for n := 2; sc.Scan(); n++ {
+		l := line{}
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			return nil, fmt.Errorf("unable to read backup line %d: %s", n, err.Error())
+		}
+		_, newRow, ok := c.table(l.Table)
+		if !ok {
+			return nil, fmt.Errorf("unable to read backup line %d: unknown table %q", n, l.Table)
+		}
+		row := newRow()
+		if err := json.Unmarshal(l.Row, row); err != nil {
+			return nil, fmt.Errorf("unable to read backup line %d: %s", n, err.Error())
+		}
+		if stats[l.Table] == nil {
+			stats[l.Table] = &Stats{}
+		}
+		stats[l.Table].Rows++
+		batches[l.Table] = append(batches[l.Table], row)
+		if len(batches[l.Table]) == batchSize {
+			if err := c.insert(l.Table, batches[l.Table], conflict, stats[l.Table]); err != nil {
+				return nil, err
+			}
+			batches[l.Table] = batches[l.Table][:0]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read backup: %s", err.Error())
+	}
+	for name, rows := range batches {
+		if err := c.insert(name, rows, conflict, stats[name]); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// insert writes a batch of rows to a table. Skipped rows are found up front
+// so that conflicts are not confused with rows which failed to insert.
+func (c *Client) insert(name string, rows []interface{}, conflict Conflict, st *Stats) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	dbTable, _, _ := c.table(name)
+	if conflict == ConflictSkip {
+		ids := make([]interface{}, len(rows))
+		for i, row := range rows {
+			ids[i] = rowID(row)
+		}
+		existing := []string{}
+		if err := r.Table(dbTable).GetAll(ids...).Field("id").ReadAll(&existing, c.session); err != nil {
+			return fmt.Errorf("unable to find existing %s: %s", name, err.Error())
+		}
+		skip := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			skip[id] = true
+		}
+		kept := rows[:0]
+		for _, row := range rows {
+			if !skip[rowID(row)] {
+				kept = append(kept, row)
+			}
+		}
+		st.Skipped += len(rows) - len(kept)
+		if rows = kept; len(rows) == 0 {
+			return nil
+		}
+	}
+
+	opts := r.InsertOpts{Conflict: "error"}
+	if conflict == ConflictOverwrite {
+		opts.Conflict = "replace"
+	}
+	res, err := r.Table(dbTable).Insert(rows, opts).RunWrite(c.session)
+	if err == nil && res.Errors > 0 {
+		err = fmt.Errorf("%d rows failed, first: %s", res.Errors, res.FirstError)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to restore %s: %s", name, err.Error())
+	}
+	st.Inserted += res.Inserted
+	st.Overwrote += res.Replaced + res.Unchanged
+	return nil
+}
+
+func rowID(row interface{}) string {
+	switch row := row.(type) {
+	case *visits.Visit:
+		return row.ID
+	case *city:
+		return row.ID
+	}
+	return ""
+}
+
+func scanErr(sc *bufio.Scanner) string {
+	if err := sc.Err(); err != nil {
+		return err.Error()
+	}
+	return "empty archive"
+}
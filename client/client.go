@@ -0,0 +1,203 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/locations"
+	"github.com/nstogner/beenthere-ws/visits"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Client acts as an api to a beenthere service over http.
+type Client struct {
+	config Config
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	// URL of the service (ie: "http://localhost:8080").
+	URL string
+	// User is sent as the calling user in the AuthHeader. Calls are made
+	// anonymously when it is empty.
+	User string
+	// AuthHeader names the request header which identifies the calling
+	// user, as configured for the service. It defaults to "X-Auth-User".
+	AuthHeader string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// ReconnectWait is the time Watch waits before reconnecting to a
+	// dropped stream. It defaults to a second.
+	ReconnectWait time.Duration
+}
+
+// Error is returned for responses with an error status, as decoded from the
+// service's error body.
+type Error struct {
+	StatusCode int                    `json:"-"`
+	Message    string                 `json:"message"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if invalid, ok := e.Fields["invalid"]; ok {
+		return fmt.Sprintf("%d %s: %v", e.StatusCode, e.Message, invalid)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether an error is a "404 Not Found" response.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config) *Client {
+	conf.URL = strings.TrimSuffix(conf.URL, "/")
+	if conf.AuthHeader == "" {
+		conf.AuthHeader = "X-Auth-User"
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	if conf.ReconnectWait == 0 {
+		conf.ReconnectWait = time.Second
+	}
+	return &Client{
+		config: conf,
+	}
+}
+
+// AddVisit adds a city/state that a user has visited. The saved visit (with
+// its id) is returned.
+func (c *Client) AddVisit(ctx context.Context, userId string, visit *visits.Visit) (*visits.Visit, error) {
+	saved := &visits.Visit{}
+	if err := c.do(ctx, "POST", "/users/"+url.PathEscape(userId)+"/visits", nil, visit, saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// DeleteVisit removes a user's previously added visit.
+func (c *Client) DeleteVisit(ctx context.Context, userId, visitId string) error {
+	return c.do(ctx, "DELETE", "/users/"+url.PathEscape(userId)+"/visits/"+url.PathEscape(visitId), nil, nil, nil)
+}
+
+// VisitedStates gets the names of the unique states visited by a user.
+func (c *Client) VisitedStates(ctx context.Context, userId string) ([]string, error) {
+	body := struct {
+		States []string `json:"states"`
+	}{}
+	if err := c.do(ctx, "GET", "/users/"+url.PathEscape(userId)+"/visits/states", nil, nil, &body); err != nil {
+		return nil, err
+	}
+	return body.States, nil
+}
+
+// VisitedCities gets the names of the unique cities visited by a user.
+func (c *Client) VisitedCities(ctx context.Context, userId string) ([]string, error) {
+	body := struct {
+		Cities []string `json:"cities"`
+	}{}
+	if err := c.do(ctx, "GET", "/users/"+url.PathEscape(userId)+"/visits/cities", nil, nil, &body); err != nil {
+		return nil, err
+	}
+	return body.Cities, nil
+}
+
+// CitiesInState gets the known cities in a state (as a 2-letter
+// abbreviation).
+func (c *Client) CitiesInState(ctx context.Context, state string) ([]locations.City, error) {
+	body := struct {
+		Cities []string `json:"cities"`
+	}{}
+	if err := c.do(ctx, "GET", "/states/"+url.PathEscape(state)+"/cities", nil, nil, &body); err != nil {
+		return nil, err
+	}
+	state = strings.ToUpper(state)
+	cities := make([]locations.City, len(body.Cities))
+	for i, name := range body.Cities {
+		cities[i] = locations.City{
+			ID:    name + "," + state,
+			Name:  name,
+			State: state,
+		}
+	}
+	return cities, nil
+}
+
+// request returns a new request to the service on behalf of the configured
+// user.
+func (c *Client) request(method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.config.URL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %s", err.Error())
+	}
+	if c.config.User != "" {
+		req.Header.Set(c.config.AuthHeader, c.config.User)
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// do makes a request with an optional JSON body (in) & decodes the JSON
+// response into out, when given. Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		js, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("unable to marshal request body: %s", err.Error())
+		}
+		body = bytes.NewReader(js)
+	}
+	req, err := c.request(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := ctxhttp.Do(ctx, c.config.HTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("unable to make request: %s", err.Error())
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return responseErr(res)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode response body: %s", err.Error())
+	}
+	return nil
+}
+
+// responseErr reads the error body of a response. Bodies which are not
+// JSON errors (ie: from a proxy) are used as the message.
+func responseErr(res *http.Response) error {
+	e := &Error{StatusCode: res.StatusCode}
+	js, err := ioutil.ReadAll(res.Body)
+	if err != nil || json.Unmarshal(js, e) != nil || e.Message == "" {
+		e.Message = strings.TrimSpace(string(js))
+		if e.Message == "" {
+			e.Message = http.StatusText(res.StatusCode)
+		}
+	}
+	return e
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/visits"
+	"golang.org/x/net/context"
+)
+
+// ListQuery filters & sorts the visits listed by ListVisits. Zero values are
+// left out.
+type ListQuery struct {
+	State string
+	City  string
+	Trip  string
+	From  time.Time
+	To    time.Time
+	// Sort is one of "timestamp" (the default), "-timestamp" or "city".
+	Sort string
+	// PageSize is the number of visits fetched per request. It defaults to
+	// 100.
+	PageSize int
+}
+
+// VisitIterator iterates over a listing of visits, fetching a page at a
+// time. Pages are continued by cursor when the service returns one, so
+// visits being added or removed while iterating are not skipped or
+// repeated.
+type VisitIterator struct {
+	client *Client
+	ctx    context.Context
+	path   string
+	query  url.Values
+	size   int
+
+	page  []visits.Visit
+	start int
+	done  bool
+	err   error
+}
+
+// ListVisits returns an iterator over a user's visits.
+func (c *Client) ListVisits(ctx context.Context, userId string, q ListQuery) *VisitIterator {
+	query := url.Values{}
+	for name, val := range map[string]string{
+		"state": q.State,
+		"city":  q.City,
+		"trip":  q.Trip,
+		"sort":  q.Sort,
+	} {
+		if val != "" {
+			query.Set(name, val)
+		}
+	}
+	if !q.From.IsZero() {
+		query.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to", q.To.Format(time.RFC3339))
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = 100
+	}
+	query.Set("limit", strconv.Itoa(q.PageSize))
+	return &VisitIterator{
+		client: c,
+		ctx:    ctx,
+		path:   "/users/" + url.PathEscape(userId) + "/visits",
+		query:  query,
+		size:   q.PageSize,
+	}
+}
+
+// Next reads the next visit into the given visit, fetching the next page when
+// needed. It returns false when there are no more visits or a request
+// failed (see Err).
+func (it *VisitIterator) Next(visit *visits.Visit) bool {
+	if len(it.page) == 0 && !it.done {
+		it.fetch()
+	}
+	if len(it.page) == 0 {
+		return false
+	}
+	*visit = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Err returns the error which ended the iteration, if any.
+func (it *VisitIterator) Err() error {
+	return it.err
+}
+
+// fetch requests the next page of visits.
+func (it *VisitIterator) fetch() {
+	body := struct {
+		Visits     []visits.Visit `json:"visits"`
+		NextCursor string         `json:"next_cursor"`
+	}{}
+	if err := it.client.do(it.ctx, "GET", it.path, it.query, nil, &body); err != nil {
+		it.err = err
+		it.done = true
+		return
+	}
+	it.page = body.Visits
+	switch {
+	case body.NextCursor != "":
+		it.query.Set("cursor", body.NextCursor)
+	case len(body.Visits) == it.size && it.query.Get("cursor") == "":
+		// Listings which can not be cursored are paged by offset.
+		it.start += it.size
+		it.query.Set("start", strconv.Itoa(it.start))
+	default:
+		it.done = true
+	}
+}
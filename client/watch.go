@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/visits"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Watcher reads the visits streamed from /stream/visits, reconnecting when
+// the stream is dropped. Visits which are added while reconnecting are not
+// sent.
+type Watcher struct {
+	client *Client
+	ctx    context.Context
+	res    *http.Response
+	lines  *bufio.Scanner
+	err    error
+}
+
+// Watch returns a Watcher of visits as they are added. Only visits which the
+// configured user may view are sent. Watching stops when the context is
+// done.
+func (c *Client) Watch(ctx context.Context) *Watcher {
+	return &Watcher{
+		client: c,
+		ctx:    ctx,
+	}
+}
+
+// Next reads the next visit into the given visit, blocking until one is
+// added. It returns false when the context is done or the service refuses
+// the stream (see Err).
+func (w *Watcher) Next(visit *visits.Visit) bool {
+	for w.err == nil {
+		if w.lines == nil {
+			w.connect()
+			continue
+		}
+		if !w.lines.Scan() {
+			w.disconnect()
+			w.wait()
+			continue
+		}
+		line := w.lines.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		*visit = visits.Visit{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), visit); err != nil {
+			continue
+		}
+		return true
+	}
+	w.disconnect()
+	return false
+}
+
+// Err returns the error which stopped watching. It is nil when the context
+// was cancelled.
+func (w *Watcher) Err() error {
+	if w.err == context.Canceled {
+		return nil
+	}
+	return w.err
+}
+
+// connect opens the stream. Responses with a client error status stop
+// watching, while other failures are retried.
+func (w *Watcher) connect() {
+	req, err := w.client.request("GET", "/stream/visits", nil, nil)
+	if err != nil {
+		w.err = err
+		return
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := ctxhttp.Do(w.ctx, w.client.config.HTTPClient, req)
+	switch {
+	case err != nil:
+		w.wait()
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		w.err = responseErr(res)
+		res.Body.Close()
+	case res.StatusCode >= 400:
+		res.Body.Close()
+		w.wait()
+	default:
+		w.res = res
+		w.lines = bufio.NewScanner(res.Body)
+	}
+}
+
+func (w *Watcher) disconnect() {
+	if w.res != nil {
+		w.res.Body.Close()
+	}
+	w.res, w.lines = nil, nil
+}
+
+// wait sleeps before reconnecting, unless the context is done first.
+func (w *Watcher) wait() {
+	select {
+	case <-w.ctx.Done():
+		w.err = w.ctx.Err()
+	case <-time.After(w.client.config.ReconnectWait):
+	}
+}
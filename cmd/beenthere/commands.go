@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/client"
+	"github.com/nstogner/beenthere-ws/visits"
+	"golang.org/x/net/context"
+)
+
+// timeLayouts are accepted wherever a time is given: a full RFC 3339 time
+// or a date.
+var timeLayouts = []string{time.RFC3339, "2006-01-02"}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected RFC 3339 (ie: 2016-01-02T15:04:05Z) or a date (ie: 2016-01-02)", s)
+}
+
+// flags returns a flag set for a command's arguments, reporting errors
+// rather than exiting.
+func flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+func requireUser(user string) error {
+	if user == "" {
+		return usageErr("a user is required: set -user or BEENTHERE_USER")
+	}
+	return nil
+}
+
+func visitAdd(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error {
+	fs := flags("visit add")
+	at := fs.String("time", "", "time of the visit (defaults to now)")
+	private := fs.Bool("private", false, "only show the visit to its user")
+	if err := fs.Parse(args); err != nil {
+		return usageErr(err.Error())
+	}
+	if fs.NArg() != 2 {
+		return usageErr("visit add expects a city & state (ie: visit add Raleigh NC)")
+	}
+	if err := requireUser(user); err != nil {
+		return err
+	}
+	v := &visits.Visit{
+		City:    fs.Arg(0),
+		State:   fs.Arg(1),
+		Private: *private,
+	}
+	if *at != "" {
+		t, err := parseTime(*at)
+		if err != nil {
+			return usageErr(err.Error())
+		}
+		v.Timestamp = t
+	}
+	saved, err := cl.AddVisit(ctx, user, v)
+	if err != nil {
+		return err
+	}
+	out.single = true
+	if err := out.header(visitColumns...); err != nil {
+		return err
+	}
+	return out.visit(saved)
+}
+
+func visitRm(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error {
+	if len(args) != 1 {
+		return usageErr("visit rm expects a visit id")
+	}
+	if err := requireUser(user); err != nil {
+		return err
+	}
+	return cl.DeleteVisit(ctx, user, args[0])
+}
+
+func visitsLs(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error {
+	fs := flags("visits ls")
+	q := client.ListQuery{}
+	fs.StringVar(&q.State, "state", "", "only list visits to a state")
+	fs.StringVar(&q.City, "city", "", "only list visits to a city")
+	fs.StringVar(&q.Trip, "trip", "", "only list visits of a trip")
+	fs.StringVar(&q.Sort, "sort", "", "timestamp, -timestamp or city")
+	from := fs.String("from", "", "only list visits at or after a time")
+	to := fs.String("to", "", "only list visits before a time")
+	if err := fs.Parse(args); err != nil {
+		return usageErr(err.Error())
+	}
+	if fs.NArg() != 0 {
+		return usageErr("visits ls does not take arguments")
+	}
+	if err := requireUser(user); err != nil {
+		return err
+	}
+	for _, t := range []struct {
+		s string
+		t *time.Time
+	}{{*from, &q.From}, {*to, &q.To}} {
+		if t.s == "" {
+			continue
+		}
+		var err error
+		if *t.t, err = parseTime(t.s); err != nil {
+			return usageErr(err.Error())
+		}
+	}
+
+	if err := out.header(visitColumns...); err != nil {
+		return err
+	}
+	it := cl.ListVisits(ctx, user, q)
+	var v visits.Visit
+	for it.Next(&v) {
+		if err := out.visit(&v); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func states(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error {
+	if len(args) != 0 {
+		return usageErr("states does not take arguments")
+	}
+	if err := requireUser(user); err != nil {
+		return err
+	}
+	names, err := cl.VisitedStates(ctx, user)
+	if err != nil {
+		return err
+	}
+	if err := out.header("state"); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := out.row(name, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cities(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error {
+	if len(args) != 1 {
+		return usageErr("cities expects a state (ie: cities NC)")
+	}
+	cities, err := cl.CitiesInState(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if err := out.header("id", "name", "state"); err != nil {
+		return err
+	}
+	for i := range cities {
+		ct := &cities[i]
+		if err := out.row(ct, ct.ID, ct.Name, ct.State); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watch prints visits as they are added until interrupted.
+func watch(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error {
+	if len(args) != 0 {
+		return usageErr("watch does not take arguments")
+	}
+	out.stream = true
+	if err := out.header(visitColumns...); err != nil {
+		return err
+	}
+	if err := out.flush(); err != nil {
+		return err
+	}
+	w := cl.Watch(ctx)
+	var v visits.Visit
+	for w.Next(&v) {
+		if err := out.visit(&v); err != nil {
+			return err
+		}
+	}
+	return w.Err()
+}
+
+// importColumns are the columns of an imported csv file, which are named by
+// its header row. Only city & state are required.
+var importColumns = map[string]func(v *visits.Visit, val string) error{
+	"city": func(v *visits.Visit, val string) error {
+		v.City = val
+		return nil
+	},
+	"state": func(v *visits.Visit, val string) error {
+		v.State = val
+		return nil
+	},
+	"timestamp": func(v *visits.Visit, val string) (err error) {
+		v.Timestamp, err = parseTime(val)
+		return err
+	},
+	"arrived_at": func(v *visits.Visit, val string) error {
+		t, err := parseTime(val)
+		v.ArrivedAt = &t
+		return err
+	},
+	"departed_at": func(v *visits.Visit, val string) error {
+		t, err := parseTime(val)
+		v.DepartedAt = &t
+		return err
+	},
+	"time_zone": func(v *visits.Visit, val string) error {
+		v.TimeZone = val
+		return nil
+	},
+	"private": func(v *visits.Visit, val string) (err error) {
+		v.Private, err = strconv.ParseBool(val)
+		return err
+	},
+}
+
+// importCSV adds a visit for every row of a csv file. Rows which fail are
+// reported & skipped, so the rest of the file is still imported.
+func importCSV(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error {
+	if len(args) != 1 {
+		return usageErr("import expects a csv file (use - for stdin)")
+	}
+	if err := requireUser(user); err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("unable to open csv file: %s", err.Error())
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r := csv.NewReader(in)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("unable to read csv header: %s", err.Error())
+	}
+	cols, err := importHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if err := out.header(visitColumns...); err != nil {
+		return err
+	}
+	failed := 0
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read csv file: %s", err.Error())
+		}
+		v, err := importRow(cols, rec)
+		if err == nil {
+			v, err = cl.AddVisit(ctx, user, v)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "beenthere: line %d: %s\n", line, err.Error())
+			failed++
+			continue
+		}
+		if err := out.visit(v); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		if err := out.flush(); err != nil {
+			return err
+		}
+		return fmt.Errorf("unable to import %d of the rows", failed)
+	}
+	return nil
+}
+
+// importHeader returns the column names of a csv header row (see
+// importColumns).
+func importHeader(header []string) ([]string, error) {
+	cols := make([]string, len(header))
+	found := map[string]bool{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := importColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown csv column: %q", header[i])
+		}
+		cols[i] = name
+		found[name] = true
+	}
+	if !found["city"] || !found["state"] {
+		return nil, fmt.Errorf("csv header must include city & state columns")
+	}
+	return cols, nil
+}
+
+// importRow returns the visit of a csv row whose columns are named by cols.
+// Empty cells are left unset.
+func importRow(cols []string, rec []string) (*visits.Visit, error) {
+	v := &visits.Visit{}
+	for i, val := range rec {
+		if val == "" {
+			continue
+		}
+		if err := importColumns[cols[i]](v, val); err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", cols[i], err.Error())
+		}
+	}
+	return v, nil
+}
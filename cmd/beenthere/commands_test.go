@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImportHeader(t *testing.T) {
+	cols, err := importHeader([]string{" City", "STATE ", "private"})
+	if err != nil {
+		t.Fatalf("expected a valid header, got %s", err.Error())
+	}
+	if len(cols) != 3 || cols[0] != "city" || cols[1] != "state" || cols[2] != "private" {
+		t.Fatalf("expected lower case column names, got %q", cols)
+	}
+
+	for _, header := range [][]string{
+		{"city"},
+		{"state", "timestamp"},
+		{"city", "state", "trip"},
+		{"city", "state", "nope"},
+	} {
+		if _, err := importHeader(header); err == nil {
+			t.Fatalf("expected header %q to be invalid", header)
+		}
+	}
+}
+
+func TestImportRow(t *testing.T) {
+	cols := []string{"city", "state", "timestamp", "arrived_at", "departed_at", "time_zone", "private"}
+	v, err := importRow(cols, []string{"Raleigh", "NC", "", "2016-01-02", "2016-01-03T10:00:00Z", "America/New_York", "true"})
+	if err != nil {
+		t.Fatalf("expected a valid row, got %s", err.Error())
+	}
+	arrived := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)
+	departed := time.Date(2016, 1, 3, 10, 0, 0, 0, time.UTC)
+	if v.City != "Raleigh" || v.State != "NC" || !v.Timestamp.IsZero() ||
+		v.ArrivedAt == nil || !v.ArrivedAt.Equal(arrived) ||
+		v.DepartedAt == nil || !v.DepartedAt.Equal(departed) ||
+		v.TimeZone != "America/New_York" || !v.Private {
+		t.Fatalf("expected every column to be parsed, got %+v", v)
+	}
+
+	for _, rec := range [][]string{
+		{"Raleigh", "NC", "yesterday", "", "", "", ""},
+		{"Raleigh", "NC", "", "2016-13-01", "", "", ""},
+		{"Raleigh", "NC", "", "", "", "", "maybe"},
+	} {
+		if _, err := importRow(cols, rec); err == nil {
+			t.Fatalf("expected row %q to be invalid", rec)
+		}
+	}
+}
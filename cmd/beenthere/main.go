@@ -0,0 +1,132 @@
+// Command beenthere is a command line client of the beenthere service.
+//
+//	beenthere [-url URL] [-user USER] [-o table|json|csv] <command> [args]
+//
+// The url & user default to the BEENTHERE_URL & BEENTHERE_USER environment
+// variables.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+
+	"github.com/nstogner/beenthere-ws/client"
+	"golang.org/x/net/context"
+)
+
+const usage = `usage: beenthere [flags] <command> [args]
+
+commands:
+  visit add [-time T] [-private] <city> <state>   add a visit
+  visit rm <visit id>                             delete a visit
+  visits ls [-state ST] [-city C] [-sort S]       list visits
+  states                                          list visited states
+  cities <state>                                  list the cities of a state
+  watch                                           tail newly added visits
+  import <file.csv>                               add visits from a csv file
+
+flags:
+`
+
+// command runs a subcommand with its arguments, writing its results to out.
+type command func(ctx context.Context, cl *client.Client, user string, args []string, out *printer) error
+
+var commands = map[string]command{
+	"visit add": visitAdd,
+	"visit rm":  visitRm,
+	"visits ls": visitsLs,
+	"states":    states,
+	"cities":    cities,
+	"watch":     watch,
+	"import":    importCSV,
+}
+
+// usageErr is returned for invalid arguments, after which usage is printed.
+type usageErr string
+
+func (e usageErr) Error() string {
+	return string(e)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	url := flag.String("url", getEnvOrElse("BEENTHERE_URL", "http://localhost:8080"), "url of the service")
+	user := flag.String("user", os.Getenv("BEENTHERE_USER"), "user to act as")
+	authHeader := flag.String("auth-header", getEnvOrElse("BEENTHERE_AUTH_HEADER", "X-Auth-User"), "request header which identifies the user")
+	format := flag.String("o", "table", "output format: table, json or csv")
+	flag.Parse()
+
+	if *format != "table" && *format != "json" && *format != "csv" {
+		fail(usageErr(fmt.Sprintf("unknown output format: %s", *format)))
+	}
+	cmd, args, err := lookup(flag.Args())
+	if err != nil {
+		fail(err)
+	}
+
+	// Stop streaming commands (ie: watch) on interrupt.
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	cl := client.NewClient(client.Config{
+		URL:        *url,
+		User:       *user,
+		AuthHeader: *authHeader,
+	})
+	out := newPrinter(os.Stdout, *format)
+	if err := cmd(ctx, cl, *user, args, out); err != nil {
+		fail(err)
+	}
+	if err := out.flush(); err != nil {
+		fail(err)
+	}
+}
+
+// lookup finds the command named by the leading arguments: either one word
+// (ie: "states") or two (ie: "visit add").
+func lookup(args []string) (command, []string, error) {
+	if len(args) == 0 {
+		return nil, nil, usageErr("missing command")
+	}
+	if len(args) > 1 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd, args[2:], nil
+		}
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		return cmd, args[1:], nil
+	}
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, nil, usageErr(fmt.Sprintf("unknown command: %s (expected one of %q)", args[0], names))
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "beenthere: %s\n", err.Error())
+	if _, ok := err.(usageErr); ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(1)
+}
+
+func getEnvOrElse(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		cmd  string
+		rest []string
+	}{
+		{[]string{"states"}, "states", []string{}},
+		{[]string{"cities", "NC"}, "cities", []string{"NC"}},
+		{[]string{"visit", "add", "-private", "Raleigh", "NC"}, "visit add", []string{"-private", "Raleigh", "NC"}},
+		{[]string{"visits", "ls"}, "visits ls", []string{}},
+	} {
+		cmd, rest, err := lookup(c.args)
+		if err != nil {
+			t.Fatalf("expected %q to find a command, got %s", c.args, err.Error())
+		}
+		if cmd == nil || len(rest) != len(c.rest) {
+			t.Fatalf("expected %q to find %q with args %q, got %q", c.args, c.cmd, c.rest, rest)
+		}
+		for i := range rest {
+			if rest[i] != c.rest[i] {
+				t.Fatalf("expected %q to find %q with args %q, got %q", c.args, c.cmd, c.rest, rest)
+			}
+		}
+	}
+
+	for _, args := range [][]string{nil, {"visit"}, {"visit", "edit"}, {"nope"}} {
+		if _, _, err := lookup(args); err == nil {
+			t.Fatalf("expected %q not to find a command", args)
+		} else if _, ok := err.(usageErr); !ok {
+			t.Fatalf("expected %q to be a usage error, got %T", args, err)
+		}
+	}
+}
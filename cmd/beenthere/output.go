@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// printer writes the results of a command as an aligned table, JSON or CSV.
+// Tables & CSV are written row by row while JSON is written as a single
+// value on flush, unless the printer streams.
+type printer struct {
+	format string
+	table  *tabwriter.Writer
+	csv    *csv.Writer
+	json   *json.Encoder
+
+	// stream writes every row as soon as it is added: JSON rows are written
+	// as one object per line.
+	stream bool
+	// single writes the one row of a command as a JSON object rather than
+	// an array.
+	single bool
+	values []interface{}
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	p := &printer{format: format}
+	switch format {
+	case "csv":
+		p.csv = csv.NewWriter(w)
+	case "json":
+		p.json = json.NewEncoder(w)
+		p.json.SetIndent("", "  ")
+	default:
+		p.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	}
+	return p
+}
+
+// header sets the column names of tables & CSV.
+func (p *printer) header(cols ...string) error {
+	switch p.format {
+	case "csv":
+		return p.csv.Write(cols)
+	case "json":
+		return nil
+	}
+	_, err := fmt.Fprintln(p.table, strings.ToUpper(strings.Join(cols, "\t")))
+	return err
+}
+
+// row adds a result, as cells for tables & CSV or as a value for JSON.
+func (p *printer) row(value interface{}, cells ...string) error {
+	switch p.format {
+	case "csv":
+		if err := p.csv.Write(cells); err != nil {
+			return err
+		}
+	case "json":
+		if p.stream {
+			p.json.SetIndent("", "")
+			return p.json.Encode(value)
+		}
+		p.values = append(p.values, value)
+		return nil
+	default:
+		if _, err := fmt.Fprintln(p.table, strings.Join(cells, "\t")); err != nil {
+			return err
+		}
+	}
+	if p.stream {
+		return p.flush()
+	}
+	return nil
+}
+
+// flush writes any buffered output.
+func (p *printer) flush() error {
+	switch p.format {
+	case "csv":
+		p.csv.Flush()
+		return p.csv.Error()
+	case "json":
+		if p.stream {
+			return nil
+		}
+		if p.single && len(p.values) == 1 {
+			return p.json.Encode(p.values[0])
+		}
+		if p.values == nil {
+			p.values = []interface{}{}
+		}
+		return p.json.Encode(p.values)
+	}
+	return p.table.Flush()
+}
+
+var visitColumns = []string{"id", "user", "city", "state", "timestamp", "arrived_at", "departed_at", "time_zone", "trip", "private"}
+
+func (p *printer) visit(v *visits.Visit) error {
+	return p.row(v,
+		v.ID,
+		v.User,
+		v.City,
+		v.State,
+		v.Timestamp.Format(time.RFC3339),
+		optTime(v.ArrivedAt),
+		optTime(v.DepartedAt),
+		v.TimeZone,
+		v.TripID,
+		fmt.Sprint(v.Private),
+	)
+}
+
+func optTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
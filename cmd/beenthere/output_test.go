@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// printed returns the output of a printer of each visit.
+func printed(t *testing.T, format string, configure func(p *printer), vs ...*visits.Visit) string {
+	buf := &bytes.Buffer{}
+	p := newPrinter(buf, format)
+	if configure != nil {
+		configure(p)
+	}
+	if err := p.header(visitColumns...); err != nil {
+		t.Fatalf("unable to print header: %s", err.Error())
+	}
+	for _, v := range vs {
+		if err := p.visit(v); err != nil {
+			t.Fatalf("unable to print visit: %s", err.Error())
+		}
+	}
+	if err := p.flush(); err != nil {
+		t.Fatalf("unable to flush printer: %s", err.Error())
+	}
+	return buf.String()
+}
+
+func TestPrinter(t *testing.T) {
+	arrived := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)
+	raleigh := &visits.Visit{
+		ID:        "1",
+		User:      "bob",
+		City:      "Raleigh",
+		State:     "NC",
+		Timestamp: arrived,
+		ArrivedAt: &arrived,
+	}
+	austin := &visits.Visit{
+		ID:        "2",
+		User:      "bob",
+		City:      "Austin",
+		State:     "TX",
+		Timestamp: time.Date(2016, 2, 3, 4, 5, 6, 0, time.UTC),
+		Private:   true,
+	}
+
+	table := "ID  USER  CITY     STATE  TIMESTAMP             ARRIVED_AT            DEPARTED_AT  TIME_ZONE  TRIP  PRIVATE\n" +
+		"1   bob   Raleigh  NC     2016-01-02T00:00:00Z  2016-01-02T00:00:00Z                                false\n" +
+		"2   bob   Austin   TX     2016-02-03T04:05:06Z                                                      true\n"
+	if got := printed(t, "table", nil, raleigh, austin); got != table {
+		t.Fatalf("expected table:\n%s\ngot:\n%s", table, got)
+	}
+
+	csv := "id,user,city,state,timestamp,arrived_at,departed_at,time_zone,trip,private\n" +
+		"1,bob,Raleigh,NC,2016-01-02T00:00:00Z,2016-01-02T00:00:00Z,,,,false\n" +
+		"2,bob,Austin,TX,2016-02-03T04:05:06Z,,,,,true\n"
+	if got := printed(t, "csv", nil, raleigh, austin); got != csv {
+		t.Fatalf("expected csv:\n%s\ngot:\n%s", csv, got)
+	}
+
+	// JSON is an array of every visit, or a single object for commands of
+	// one visit, or an object per line when streaming.
+	array := "[\n  {\n    \"id\": \"2\",\n    \"city\": \"Austin\",\n    \"state\": \"TX\",\n    \"user\": \"bob\",\n    \"timestamp\": \"2016-02-03T04:05:06Z\",\n    \"private\": true\n  }\n]\n"
+	if got := printed(t, "json", nil, austin); got != array {
+		t.Fatalf("expected json array:\n%s\ngot:\n%s", array, got)
+	}
+	if got := printed(t, "json", nil); got != "[]\n" {
+		t.Fatalf("expected an empty json array, got:\n%s", got)
+	}
+	single := "{\n  \"id\": \"2\",\n  \"city\": \"Austin\",\n  \"state\": \"TX\",\n  \"user\": \"bob\",\n  \"timestamp\": \"2016-02-03T04:05:06Z\",\n  \"private\": true\n}\n"
+	if got := printed(t, "json", func(p *printer) { p.single = true }, austin); got != single {
+		t.Fatalf("expected json object:\n%s\ngot:\n%s", single, got)
+	}
+	stream := "{\"id\":\"2\",\"city\":\"Austin\",\"state\":\"TX\",\"user\":\"bob\",\"timestamp\":\"2016-02-03T04:05:06Z\",\"private\":true}\n" +
+		"{\"id\":\"2\",\"city\":\"Austin\",\"state\":\"TX\",\"user\":\"bob\",\"timestamp\":\"2016-02-03T04:05:06Z\",\"private\":true}\n"
+	if got := printed(t, "json", func(p *printer) { p.stream = true }, austin, austin); got != stream {
+		t.Fatalf("expected json lines:\n%s\ngot:\n%s", stream, got)
+	}
+}
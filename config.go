@@ -1,26 +1,83 @@
 package main
 
-import "os"
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Config represents the complete configuration information for the service.
 type Config struct {
-	ServerPort  string
-	DBHost      string
-	DBPort      string
-	DBName      string
-	VisitsTable string
-	CitiesTable string
+	ServerPort       string
+	GRPCPort         string
+	DBHost           string
+	DBPort           string
+	DBName           string
+	VisitsTable      string
+	CitiesTable      string
+	TripsTable       string
+	SummsTable       string
+	ProfilesTable    string
+	FollowsTable     string
+	SharesTable      string
+	AchievesTable    string
+	AchievementsFile string
+	OpenAPIFile      string
+	WebhooksTable    string
+	DeliveriesTable  string
+	WebhookBackoff   time.Duration
+	WebhookPrivate   bool
+	OutboxTable      string
+	AuditTable       string
+	OutboxQueueTable string
+	OutboxFile       string
+	ShareSecret      string
+	DedupWindow      time.Duration
+	TrashRetention   time.Duration
+	AuthHeader       string
+	AuthProxyTrusted bool
+	Admins           []string
+	TrustedProxies   []*net.IPNet
+	SchemaTable      string
 }
 
 // ConfigFromEnv sources configuration from environment variables.
 func ConfigFromEnv() Config {
 	return Config{
-		ServerPort:  getEnvOrElse("SERVER_PORT", "8080"),
-		DBPort:      getEnvOrElse("DB_PORT", "28015"),
-		DBHost:      getEnvOrElse("DB_HOST", "localhost"),
-		DBName:      getEnvOrElse("DB_NAME", "been_there"),
-		VisitsTable: getEnvOrElse("VISITS_TABLE", "visits"),
-		CitiesTable: getEnvOrElse("CITIES_TABLE", "cities"),
+		ServerPort:       getEnvOrElse("SERVER_PORT", "8080"),
+		GRPCPort:         getEnvOrElse("GRPC_PORT", "9090"),
+		DBPort:           getEnvOrElse("DB_PORT", "28015"),
+		DBHost:           getEnvOrElse("DB_HOST", "localhost"),
+		DBName:           getEnvOrElse("DB_NAME", "been_there"),
+		VisitsTable:      getEnvOrElse("VISITS_TABLE", "visits"),
+		CitiesTable:      getEnvOrElse("CITIES_TABLE", "cities"),
+		TripsTable:       getEnvOrElse("TRIPS_TABLE", "trips"),
+		SummsTable:       getEnvOrElse("SUMMARIES_TABLE", "summaries"),
+		ProfilesTable:    getEnvOrElse("PROFILES_TABLE", "profiles"),
+		FollowsTable:     getEnvOrElse("FOLLOWS_TABLE", "follows"),
+		SharesTable:      getEnvOrElse("SHARES_TABLE", "shares"),
+		AchievesTable:    getEnvOrElse("ACHIEVEMENTS_TABLE", "achievements"),
+		AchievementsFile: getEnvOrElse("ACHIEVEMENTS_FILE", ""),
+		OpenAPIFile:      getEnvOrElse("OPENAPI_FILE", ""),
+		WebhooksTable:    getEnvOrElse("WEBHOOKS_TABLE", "webhooks"),
+		DeliveriesTable:  getEnvOrElse("DELIVERIES_TABLE", "webhook_deliveries"),
+		WebhookBackoff:   getDurationEnvOrElse("WEBHOOK_BACKOFF", "10s"),
+		WebhookPrivate:   getBoolEnvOrElse("WEBHOOK_ALLOW_PRIVATE", "false"),
+		OutboxTable:      getEnvOrElse("OUTBOX_TABLE", "outbox"),
+		OutboxQueueTable: getEnvOrElse("OUTBOX_QUEUE_TABLE", "outbox_queue"),
+		AuditTable:       getEnvOrElse("AUDIT_TABLE", "audit"),
+		OutboxFile:       getEnvOrElse("OUTBOX_FILE", ""),
+		DedupWindow:      getDurationEnvOrElse("VISITS_DEDUP_WINDOW", "0s"),
+		TrashRetention:   getDurationEnvOrElse("TRASH_RETENTION", "720h"),
+		AuthHeader:       getEnvOrElse("AUTH_HEADER", "X-Auth-User"),
+		AuthProxyTrusted: getBoolEnvOrElse("AUTH_PROXY_TRUSTED", "false"),
+		Admins:           getListEnvOrElse("ADMIN_USERS", ""),
+		TrustedProxies:   getNetsEnvOrElse("TRUSTED_PROXIES", ""),
+		SchemaTable:      getEnvOrElse("SCHEMA_TABLE", "schema"),
+		// Secrets are not logged.
+		ShareSecret: os.Getenv("SHARE_SECRET"),
 	}
 }
 
@@ -37,6 +94,66 @@ func getEnvOrElse(name string, other string) string {
 	return env
 }
 
+// getDurationEnvOrElse looks up an environment variable as a duration (ie:
+// "10m") and if it does not exist, the default value is parsed instead. An
+// unparseable duration is fatally logged.
+func getDurationEnvOrElse(name string, other string) time.Duration {
+	env := getEnvOrElse(name, other)
+	d, err := time.ParseDuration(env)
+	if err != nil {
+		log.WithField(name, env).Fatalf("unable to parse duration from environment variable")
+	}
+	return d
+}
+
+// getBoolEnvOrElse looks up an environment variable as a bool (ie: "true")
+// and if it does not exist, the default value is parsed instead. An
+// unparseable bool is fatally logged.
+func getBoolEnvOrElse(name string, other string) bool {
+	env := getEnvOrElse(name, other)
+	b, err := strconv.ParseBool(env)
+	if err != nil {
+		log.WithField(name, env).Fatalf("unable to parse bool from environment variable")
+	}
+	return b
+}
+
+// getListEnvOrElse looks up an environment variable as a comma separated list
+// (ie: "alice,bob") and if it does not exist, the default value is split
+// instead. Empty items are dropped.
+func getListEnvOrElse(name string, other string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(getEnvOrElse(name, other), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getNetsEnvOrElse looks up an environment variable as a comma separated list
+// of IP addresses & CIDR ranges (ie: "10.0.0.0/8,192.168.1.2") and if it does
+// not exist, the default value is parsed instead. An unparseable item is
+// fatally logged.
+func getNetsEnvOrElse(name string, other string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0)
+	for _, item := range getListEnvOrElse(name, other) {
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			log.WithField(name, item).Fatalf("unable to parse IP address or CIDR range from environment variable")
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
 // mustGetEnv looks up a given environment variable and fatally logs an
 // error if it does not exist.
 func mustGetEnv(name string) string {
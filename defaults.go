@@ -0,0 +1,36 @@
+package main
+
+import (
+	_ "embed"
+
+	"github.com/nstogner/beenthere-ws/achievements"
+	"github.com/nstogner/beenthere-ws/openapi"
+)
+
+// The api spec & achievement rules are built into the binary, so that it
+// does not depend on the directory it is run from. OPENAPI_FILE &
+// ACHIEVEMENTS_FILE replace them.
+var (
+	//go:embed openapi.json
+	defaultSpec []byte
+	//go:embed achievements.json
+	defaultRules []byte
+)
+
+// loadSpec loads the api spec from a file, or the built in spec when path is
+// empty.
+func loadSpec(path string) (*openapi.Spec, error) {
+	if path == "" {
+		return openapi.Parse(defaultSpec)
+	}
+	return openapi.Load(path)
+}
+
+// loadRules loads the achievement rules from a file, or the built in rules
+// when path is empty.
+func loadRules(path string) ([]achievements.Rule, error) {
+	if path == "" {
+		return achievements.ParseRules(defaultRules)
+	}
+	return achievements.LoadRules(path)
+}
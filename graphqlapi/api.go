@@ -0,0 +1,140 @@
+package graphqlapi
+
+import (
+	"sync/atomic"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/nstogner/beenthere-ws/locations"
+	"github.com/nstogner/beenthere-ws/outbox"
+	"github.com/nstogner/beenthere-ws/service"
+	"github.com/nstogner/beenthere-ws/visits"
+	"golang.org/x/net/context"
+)
+
+// Limits of a single query. Since a visit's user has visits of their own,
+// queries can nest lists of visits, so the visits listed across a whole query
+// are limited as well as its depth.
+const (
+	maxDepth       = 10
+	maxParallelism = 10
+	maxQueryVisits = 5000
+)
+
+// API executes GraphQL requests against the schema (see schema.go) on top
+// of the same service layer as the REST API.
+type API struct {
+	schema    *graphql.Schema
+	service   *service.Service
+	visits    *visits.Client
+	locations *locations.Client
+	events    *outbox.Hub
+}
+
+// Config is used to create a new instance of API in New(...).
+type Config struct {
+	Service      *service.Service
+	VisitsClient *visits.Client
+	LocsClient   *locations.Client
+	// Events is the outbox sink which visitAdded subscriptions stream from.
+	Events *outbox.Hub
+}
+
+// Request is a GraphQL request as sent in the body of a POST.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// New returns a new instance of API.
+func New(conf Config) *API {
+	a := &API{
+		service:   conf.Service,
+		visits:    conf.VisitsClient,
+		locations: conf.LocsClient,
+		events:    conf.Events,
+	}
+	a.schema = graphql.MustParseSchema(schema, &resolver{api: a},
+		graphql.MaxDepth(maxDepth),
+		graphql.MaxParallelism(maxParallelism),
+	)
+	return a
+}
+
+// Exec runs a query on behalf of the caller (an empty string for
+// unauthenticated requests).
+func (a *API) Exec(ctx context.Context, caller string, req *Request) *graphql.Response {
+	return a.schema.Exec(a.context(ctx, caller), req.Query, req.OperationName, req.Variables)
+}
+
+// Subscribe runs a subscription on behalf of the caller. Each value sent on
+// the returned channel is a *graphql.Response. The channel is closed when
+// the context is done or the subscriber falls too far behind.
+func (a *API) Subscribe(ctx context.Context, caller string, req *Request) (<-chan interface{}, error) {
+	return a.schema.Subscribe(a.context(ctx, caller), req.Query, req.OperationName, req.Variables)
+}
+
+type contextKey int
+
+const (
+	callerKey contextKey = iota
+	loaderKey
+	budgetKey
+)
+
+// context returns a request context holding the caller, a fresh city loader
+// & the number of visits the request may list (see maxQueryVisits).
+func (a *API) context(ctx context.Context, caller string) context.Context {
+	ctx = context.WithValue(ctx, callerKey, caller)
+	budget := int64(maxQueryVisits)
+	ctx = context.WithValue(ctx, budgetKey, &budget)
+	return context.WithValue(ctx, loaderKey, newCityLoader(a.locations))
+}
+
+// spend takes n visits from the request's budget, returning false when the
+// budget does not cover them. Resolvers run in parallel, so the budget is
+// updated atomically.
+func spend(ctx context.Context, n int) bool {
+	budget := ctx.Value(budgetKey).(*int64)
+	return atomic.AddInt64(budget, -int64(n)) >= 0
+}
+
+func callerFrom(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey).(string)
+	return caller
+}
+
+func loaderFrom(ctx context.Context) *cityLoader {
+	return ctx.Value(loaderKey).(*cityLoader)
+}
+
+// queryErr wraps errors from the service layer so that their kind is
+// reported in the error's extensions.
+type queryErr struct {
+	err *service.Error
+}
+
+func (e queryErr) Error() string {
+	return e.err.Error()
+}
+
+func (e queryErr) Extensions() map[string]interface{} {
+	code := "INTERNAL"
+	switch e.err.Kind {
+	case service.KindInvalid:
+		code = "INVALID"
+	case service.KindForbidden:
+		code = "FORBIDDEN"
+	case service.KindNotFound:
+		code = "NOT_FOUND"
+	}
+	return map[string]interface{}{"code": code}
+}
+
+// apiErr maps errors from the service layer to query errors.
+func apiErr(err error) error {
+	if e, ok := err.(*service.Error); ok {
+		return queryErr{err: e}
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package graphqlapi
+
+import (
+	"sync"
+
+	"github.com/nstogner/beenthere-ws/locations"
+)
+
+// cityLoader batches & caches city lookups for a single request. Resolvers
+// of lists prime the loader with every city in the list, so that resolving
+// each item's city takes a single query rather than one per item.
+type cityLoader struct {
+	locations *locations.Client
+
+	mu      sync.Mutex
+	cities  map[string]*locations.City
+	pending map[string]bool
+}
+
+func newCityLoader(lc *locations.Client) *cityLoader {
+	return &cityLoader{
+		locations: lc,
+		cities:    make(map[string]*locations.City),
+		pending:   make(map[string]bool),
+	}
+}
+
+// prime queues cities ("City,ST") to be fetched by the next load.
+func (l *cityLoader) prime(ids ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := l.cities[id]; !ok {
+			l.pending[id] = true
+		}
+	}
+}
+
+// load returns a city, fetching it along with every primed city when it has
+// not been loaded yet. A nil City is returned for unknown cities.
+func (l *cityLoader) load(id string) (*locations.City, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ct, ok := l.cities[id]; ok {
+		return ct, nil
+	}
+	l.pending[id] = true
+	ids := make([]string, 0, len(l.pending))
+	for p := range l.pending {
+		ids = append(ids, p)
+	}
+	found, err := l.locations.GetCities(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ids {
+		l.cities[p] = nil
+	}
+	for i := range found {
+		l.cities[found[i].ID] = &found[i]
+	}
+	l.pending = make(map[string]bool)
+	return l.cities[id], nil
+}
@@ -0,0 +1,343 @@
+package graphqlapi
+
+import (
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/nstogner/beenthere-ws/service"
+	"github.com/nstogner/beenthere-ws/visits"
+	"golang.org/x/net/context"
+)
+
+// Page sizes of User.visits.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// resolver is the root resolver of queries & subscriptions.
+type resolver struct {
+	api *API
+}
+
+// User resolves a user when the caller may view their visits.
+func (r *resolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	id := string(args.ID)
+	public, err := r.api.service.Viewer(callerFrom(ctx), id)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+	return &userResolver{api: r.api, id: id, public: public}, nil
+}
+
+// State resolves a state by abbreviation, or null for unknown states.
+func (r *resolver) State(args struct{ Abbr string }) *stateResolver {
+	abbr := strings.ToUpper(args.Abbr)
+	if r.api.locations.StateName(abbr) == "" {
+		return nil
+	}
+	return &stateResolver{api: r.api, abbr: abbr}
+}
+
+// VisitAdded streams visits as they are added. Only visits which the caller
+// may view are sent.
+func (r *resolver) VisitAdded(ctx context.Context, args struct{ User *graphql.ID }) (<-chan *visitResolver, error) {
+	caller := callerFrom(ctx)
+	live, unsubscribe := r.api.events.Subscribe()
+	out := make(chan *visitResolver)
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-live:
+				if !ok {
+					return
+				}
+				if e.Type != visits.EventCreated || (args.User != nil && e.Visit.User != string(*args.User)) {
+					continue
+				}
+				if ok, err := r.api.service.CanViewVisit(caller, e.Visit); err != nil || !ok {
+					continue
+				}
+				select {
+				case out <- &visitResolver{api: r.api, visit: e.Visit, public: e.Visit.User != caller}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+type userResolver struct {
+	api *API
+	id  string
+	// public hides the user's private visits from the caller.
+	public bool
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return graphql.ID(u.id)
+}
+
+type visitsArgs struct {
+	State *string
+	City  *string
+	Trip  *graphql.ID
+	From  *graphql.Time
+	To    *graphql.Time
+	Sort  *string
+	Start *int32
+	Limit *int32
+}
+
+func (u *userResolver) Visits(ctx context.Context, args visitsArgs) ([]*visitResolver, error) {
+	q := visits.Query{
+		User:   u.id,
+		Limit:  defaultListLimit,
+		Public: u.public,
+	}
+	if args.State != nil {
+		q.State = *args.State
+	}
+	if args.City != nil {
+		q.City = *args.City
+	}
+	if args.Trip != nil {
+		q.Trip = string(*args.Trip)
+	}
+	if args.From != nil {
+		q.From = args.From.Time
+	}
+	if args.To != nil {
+		q.To = args.To.Time
+	}
+	if args.Sort != nil {
+		q.Sort = *args.Sort
+	}
+	if args.Start != nil {
+		q.Start = int(*args.Start)
+	}
+	if args.Limit != nil {
+		q.Limit = int(*args.Limit)
+	}
+	if q.Start < 0 || q.Limit < 0 || q.Limit > maxListLimit {
+		return nil, apiErr(&service.Error{
+			Kind:   service.KindInvalid,
+			Msg:    "invalid query",
+			Reason: "'start' must not be negative & 'limit' must be at most 1000",
+		})
+	}
+	if !spend(ctx, q.Limit) {
+		return nil, apiErr(&service.Error{
+			Kind:   service.KindInvalid,
+			Msg:    "invalid query",
+			Reason: "the query must list at most 5000 visits in total, including nested lists",
+		})
+	}
+	dbVisits, err := u.api.service.ListVisits(q)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+
+	loader := loaderFrom(ctx)
+	rs := make([]*visitResolver, len(dbVisits))
+	for i := range dbVisits {
+		loader.prime(dbVisits[i].City + "," + dbVisits[i].State)
+		rs[i] = &visitResolver{api: u.api, visit: &dbVisits[i], public: u.public}
+	}
+	return rs, nil
+}
+
+func (u *userResolver) States() ([]*stateResolver, error) {
+	states, err := u.api.service.StatesVisited(u.id, u.public)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+	rs := make([]*stateResolver, len(states))
+	for i, abbr := range states {
+		rs[i] = &stateResolver{api: u.api, abbr: abbr}
+	}
+	return rs, nil
+}
+
+func (u *userResolver) Cities(ctx context.Context) ([]*cityResolver, error) {
+	totals, err := u.api.visits.GetTotals(u.id, u.public)
+	if err != nil {
+		return nil, err
+	}
+	ids := totals.CityIDs()
+	loaderFrom(ctx).prime(ids...)
+	rs := make([]*cityResolver, len(ids))
+	for i, id := range ids {
+		rs[i] = newCityResolver(u.api, id)
+	}
+	return rs, nil
+}
+
+func (u *userResolver) Stats() (*statsResolver, error) {
+	stats, err := u.api.visits.GetStats(u.id, u.public)
+	if err != nil {
+		return nil, err
+	}
+	return &statsResolver{stats: stats}, nil
+}
+
+type visitResolver struct {
+	api    *API
+	visit  *visits.Visit
+	public bool
+}
+
+func (v *visitResolver) ID() graphql.ID {
+	return graphql.ID(v.visit.ID)
+}
+
+func (v *visitResolver) User() *userResolver {
+	return &userResolver{api: v.api, id: v.visit.User, public: v.public}
+}
+
+func (v *visitResolver) City() *cityResolver {
+	return newCityResolver(v.api, v.visit.City+","+v.visit.State)
+}
+
+func (v *visitResolver) State() *stateResolver {
+	return &stateResolver{api: v.api, abbr: v.visit.State}
+}
+
+func (v *visitResolver) Timestamp() graphql.Time {
+	return graphql.Time{Time: v.visit.Timestamp}
+}
+
+func (v *visitResolver) ArrivedAt() *graphql.Time {
+	return optTime(v.visit.ArrivedAt)
+}
+
+func (v *visitResolver) DepartedAt() *graphql.Time {
+	return optTime(v.visit.DepartedAt)
+}
+
+func (v *visitResolver) TimeZone() *string {
+	if v.visit.TimeZone == "" {
+		return nil
+	}
+	return &v.visit.TimeZone
+}
+
+func (v *visitResolver) Trip() *graphql.ID {
+	if v.visit.TripID == "" {
+		return nil
+	}
+	id := graphql.ID(v.visit.TripID)
+	return &id
+}
+
+func (v *visitResolver) Private() bool {
+	return v.visit.Private
+}
+
+type cityResolver struct {
+	api   *API
+	id    string
+	name  string
+	state string
+}
+
+// newCityResolver returns a resolver of a city id ("City,ST").
+func newCityResolver(api *API, id string) *cityResolver {
+	ct := &cityResolver{api: api, id: id, name: id}
+	if i := strings.LastIndex(id, ","); i >= 0 {
+		ct.name, ct.state = id[:i], id[i+1:]
+	}
+	return ct
+}
+
+func (ct *cityResolver) ID() graphql.ID {
+	return graphql.ID(ct.id)
+}
+
+func (ct *cityResolver) Name() string {
+	return ct.name
+}
+
+func (ct *cityResolver) State() *stateResolver {
+	return &stateResolver{api: ct.api, abbr: ct.state}
+}
+
+func (ct *cityResolver) Longitude(ctx context.Context) (*float64, error) {
+	city, err := loaderFrom(ctx).load(ct.id)
+	if err != nil || city == nil || (city.Location.Lon == 0 && city.Location.Lat == 0) {
+		return nil, err
+	}
+	return &city.Location.Lon, nil
+}
+
+func (ct *cityResolver) Latitude(ctx context.Context) (*float64, error) {
+	city, err := loaderFrom(ctx).load(ct.id)
+	if err != nil || city == nil || (city.Location.Lon == 0 && city.Location.Lat == 0) {
+		return nil, err
+	}
+	return &city.Location.Lat, nil
+}
+
+type stateResolver struct {
+	api  *API
+	abbr string
+}
+
+func (s *stateResolver) Abbr() string {
+	return s.abbr
+}
+
+func (s *stateResolver) Name() string {
+	return s.api.locations.StateName(s.abbr)
+}
+
+func (s *stateResolver) Cities(ctx context.Context) ([]*cityResolver, error) {
+	names, err := s.api.service.CityNames(s.abbr)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+	rs := make([]*cityResolver, len(names))
+	for i, name := range names {
+		rs[i] = newCityResolver(s.api, name+","+s.abbr)
+		loaderFrom(ctx).prime(rs[i].id)
+	}
+	return rs, nil
+}
+
+type statsResolver struct {
+	stats *visits.Stats
+}
+
+func (s *statsResolver) Visits() int32 {
+	return int32(s.stats.Visits)
+}
+
+func (s *statsResolver) States() int32 {
+	return int32(len(s.stats.States))
+}
+
+func (s *statsResolver) Cities() int32 {
+	return int32(s.stats.Cities)
+}
+
+func (s *statsResolver) FirstVisit() *graphql.Time {
+	return optTime(s.stats.FirstVisit)
+}
+
+func (s *statsResolver) LastVisit() *graphql.Time {
+	return optTime(s.stats.LastVisit)
+}
+
+func optTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
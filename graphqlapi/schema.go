@@ -0,0 +1,69 @@
+package graphqlapi
+
+// schema is the GraphQL schema served at /graphql.
+const schema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+scalar Time
+
+type Query {
+	# A user, when the caller may view their visits.
+	user(id: ID!): User
+	# A state by its 2-letter abbreviation.
+	state(abbr: String!): State
+}
+
+type Subscription {
+	# Visits as they are added, optionally by a single user.
+	visitAdded(user: ID): Visit!
+}
+
+type User {
+	id: ID!
+	# The user's visits, filtered & sorted like the REST API.
+	visits(state: String, city: String, trip: ID, from: Time, to: Time, sort: String, start: Int = 0, limit: Int = 100): [Visit!]!
+	states: [State!]!
+	cities: [City!]!
+	stats: Stats!
+}
+
+type Visit {
+	id: ID!
+	user: User!
+	city: City!
+	state: State!
+	timestamp: Time!
+	arrivedAt: Time
+	departedAt: Time
+	timeZone: String
+	trip: ID
+	private: Boolean!
+}
+
+type City {
+	# The city as "City,ST".
+	id: ID!
+	name: String!
+	state: State!
+	# Coordinates are only known for some cities.
+	longitude: Float
+	latitude: Float
+}
+
+type State {
+	abbr: String!
+	name: String!
+	cities: [City!]!
+}
+
+type Stats {
+	visits: Int!
+	states: Int!
+	cities: Int!
+	firstVisit: Time
+	lastVisit: Time
+}
+`
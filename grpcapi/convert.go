@@ -0,0 +1,70 @@
+package grpcapi
+
+import (
+	"time"
+
+	"github.com/nstogner/beenthere-ws/grpcapi/visitspb"
+	"github.com/nstogner/beenthere-ws/visits"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toProto converts a visit of the service layer to its message.
+func toProto(v *visits.Visit) *visitspb.Visit {
+	return &visitspb.Visit{
+		Id:         v.ID,
+		City:       v.City,
+		State:      v.State,
+		User:       v.User,
+		Timestamp:  toTimestamp(v.Timestamp),
+		Trip:       v.TripID,
+		ArrivedAt:  toTimestampPtr(v.ArrivedAt),
+		DepartedAt: toTimestampPtr(v.DepartedAt),
+		TimeZone:   v.TimeZone,
+		Private:    v.Private,
+	}
+}
+
+// fromProto converts a visit message to the service layer's visit. The id,
+// user & trip are left to the service to set.
+func fromProto(v *visitspb.Visit) *visits.Visit {
+	return &visits.Visit{
+		City:       v.GetCity(),
+		State:      v.GetState(),
+		Timestamp:  fromTimestamp(v.GetTimestamp()),
+		ArrivedAt:  fromTimestampPtr(v.GetArrivedAt()),
+		DepartedAt: fromTimestampPtr(v.GetDepartedAt()),
+		TimeZone:   v.GetTimeZone(),
+		Private:    v.GetPrivate(),
+	}
+}
+
+// toTimestamp converts a time, leaving zero times unset.
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func toTimestampPtr(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return toTimestamp(*t)
+}
+
+// fromTimestamp converts a timestamp, returning the zero time when unset.
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func fromTimestampPtr(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
@@ -0,0 +1,6 @@
+// Package grpcapi serves the Visits gRPC service (see visits.proto) on top
+// of the same service layer as the REST API. The messages & service stubs are
+// generated into the visitspb package.
+package grpcapi
+
+//go:generate protoc --go_out=visitspb --go_opt=paths=source_relative --go-grpc_out=visitspb --go-grpc_opt=paths=source_relative visits.proto
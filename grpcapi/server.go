@@ -0,0 +1,236 @@
+package grpcapi
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/grpcapi/visitspb"
+	"github.com/nstogner/beenthere-ws/outbox"
+	"github.com/nstogner/beenthere-ws/service"
+	"github.com/nstogner/beenthere-ws/visits"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Page sizes of ListVisits.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// Server implements the Visits gRPC service (see visits.proto) on top of the
+// same service layer as the REST API.
+type Server struct {
+	visitspb.UnimplementedVisitsServer
+
+	service    *service.Service
+	events     *outbox.Hub
+	authHeader string
+}
+
+// Config is used to create a new instance of Server in NewServer(...).
+type Config struct {
+	Service *service.Service
+	// Events is the outbox sink which WatchVisits streams from.
+	Events *outbox.Hub
+	// AuthHeader names the request metadata which identifies the calling
+	// user, like the REST API's header. It defaults to "X-Auth-User".
+	AuthHeader string
+}
+
+// NewServer returns a new instance of Server.
+func NewServer(conf Config) *Server {
+	s := &Server{
+		service:    conf.Service,
+		events:     conf.Events,
+		authHeader: conf.AuthHeader,
+	}
+	if s.authHeader == "" {
+		s.authHeader = "X-Auth-User"
+	}
+	// Metadata keys are always lowercase.
+	s.authHeader = strings.ToLower(s.authHeader)
+	return s
+}
+
+// Register registers the Visits service with a gRPC server.
+func (s *Server) Register(gs *grpc.Server) {
+	visitspb.RegisterVisitsServer(gs, s)
+}
+
+// caller returns the user making a call as identified by the auth metadata.
+// An empty string is returned for unauthenticated calls.
+func (s *Server) caller(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if vals := md.Get(s.authHeader); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// actor returns who is making a call, for the audit log. The request id is
+// read from the "x-request-id" metadata when set.
+func (s *Server) actor(ctx context.Context) visits.Actor {
+	by := visits.Actor{User: s.caller(ctx)}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get("x-request-id"); len(vals) > 0 {
+			by.RequestID = vals[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		by.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(by.IP); err == nil {
+			by.IP = host
+		}
+	}
+	return by
+}
+
+// AddVisit adds a city/state that a user has visited.
+// Only the calling user may add their visits.
+func (s *Server) AddVisit(ctx context.Context, req *visitspb.AddVisitRequest) (*visitspb.Visit, error) {
+	if req.Visit == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing 'visit' field")
+	}
+	visit := fromProto(req.Visit)
+	if visit.Timestamp.IsZero() {
+		visit.Timestamp = time.Now()
+	}
+	if err := s.service.AddVisit(s.actor(ctx), req.User, visit); err != nil {
+		return nil, apiErr(err)
+	}
+	return toProto(visit), nil
+}
+
+// DeleteVisit removes a given user's previously added visit. Only the calling
+// user may delete their visits.
+func (s *Server) DeleteVisit(ctx context.Context, req *visitspb.DeleteVisitRequest) (*visitspb.DeleteVisitResponse, error) {
+	if err := s.service.DeleteVisit(s.actor(ctx), req.User, req.Visit); err != nil {
+		return nil, apiErr(err)
+	}
+	return &visitspb.DeleteVisitResponse{}, nil
+}
+
+// ListVisits lists a user's visits, filtered & sorted like the REST API.
+func (s *Server) ListVisits(ctx context.Context, req *visitspb.ListVisitsRequest) (*visitspb.ListVisitsResponse, error) {
+	public, err := s.service.Viewer(s.caller(ctx), req.User)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+	q := visits.Query{
+		User:   req.User,
+		State:  req.State,
+		City:   req.City,
+		Trip:   req.Trip,
+		From:   fromTimestamp(req.From),
+		To:     fromTimestamp(req.To),
+		Sort:   req.Sort,
+		Start:  int(req.Start),
+		Limit:  int(req.Limit),
+		Public: public,
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultListLimit
+	}
+	if q.Start < 0 || q.Limit < 0 || q.Limit > maxListLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "'start' must not be negative & 'limit' must be at most %d", maxListLimit)
+	}
+	if req.Cursor != "" {
+		if q.After, err = visits.DecodeCursor(req.Cursor); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid 'cursor': "+err.Error())
+		}
+	}
+	dbVisits, err := s.service.ListVisits(q)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+
+	rsp := &visitspb.ListVisitsResponse{}
+	for i := range dbVisits {
+		rsp.Visits = append(rsp.Visits, toProto(&dbVisits[i]))
+	}
+	if q.Cursored() && len(dbVisits) > 0 && len(dbVisits) == q.Limit {
+		rsp.NextCursor = visits.CursorAfter(dbVisits[len(dbVisits)-1]).Encode()
+	}
+	return rsp, nil
+}
+
+// ListVisitedStates lists the unique states (as abbreviations) visited by a
+// user.
+func (s *Server) ListVisitedStates(ctx context.Context, req *visitspb.ListVisitedStatesRequest) (*visitspb.ListVisitedStatesResponse, error) {
+	public, err := s.service.Viewer(s.caller(ctx), req.User)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+	states, err := s.service.StatesVisited(req.User, public)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+	return &visitspb.ListVisitedStatesResponse{States: states}, nil
+}
+
+// ListCities lists the known cities in a state.
+func (s *Server) ListCities(ctx context.Context, req *visitspb.ListCitiesRequest) (*visitspb.ListCitiesResponse, error) {
+	cities, err := s.service.CityNames(req.State)
+	if err != nil {
+		return nil, apiErr(err)
+	}
+	return &visitspb.ListCitiesResponse{Cities: cities}, nil
+}
+
+// WatchVisits streams visits as they are added. Only visits which the caller
+// may view are sent.
+func (s *Server) WatchVisits(req *visitspb.WatchVisitsRequest, stream visitspb.Visits_WatchVisitsServer) error {
+	ctx := stream.Context()
+	caller := s.caller(ctx)
+	live, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-live:
+			if !ok {
+				return status.Error(codes.Unavailable, "fell too far behind, watch again")
+			}
+			if e.Type != visits.EventCreated || (req.User != "" && e.Visit.User != req.User) {
+				continue
+			}
+			ok, err := s.service.CanViewVisit(caller, e.Visit)
+			if err != nil {
+				return apiErr(err)
+			}
+			if !ok {
+				continue
+			}
+			if err := stream.Send(toProto(e.Visit)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// apiErr maps errors from the service layer to gRPC status errors.
+func apiErr(err error) error {
+	e, ok := err.(*service.Error)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	switch e.Kind {
+	case service.KindInvalid:
+		return status.Error(codes.InvalidArgument, e.Error())
+	case service.KindForbidden:
+		return status.Error(codes.PermissionDenied, e.Error())
+	case service.KindNotFound:
+		return status.Error(codes.NotFound, e.Error())
+	}
+	return status.Error(codes.Internal, e.Error())
+}
@@ -0,0 +1,810 @@
+// The Visits service, served alongside the REST API on GRPC_PORT. Go code is
+// generated into the visitspb package (see grpcapi/generate.go).
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: visits.proto
+
+package visitspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Visit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	City          string                 `protobuf:"bytes,2,opt,name=city,proto3" json:"city,omitempty"`
+	State         string                 `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
+	User          string                 `protobuf:"bytes,4,opt,name=user,proto3" json:"user,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Trip          string                 `protobuf:"bytes,6,opt,name=trip,proto3" json:"trip,omitempty"`
+	ArrivedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=arrived_at,json=arrivedAt,proto3" json:"arrived_at,omitempty"`
+	DepartedAt    *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=departed_at,json=departedAt,proto3" json:"departed_at,omitempty"`
+	TimeZone      string                 `protobuf:"bytes,9,opt,name=time_zone,json=timeZone,proto3" json:"time_zone,omitempty"`
+	Private       bool                   `protobuf:"varint,10,opt,name=private,proto3" json:"private,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Visit) Reset() {
+	*x = Visit{}
+	mi := &file_visits_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Visit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Visit) ProtoMessage() {}
+
+func (x *Visit) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Visit.ProtoReflect.Descriptor instead.
+func (*Visit) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Visit) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Visit) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Visit) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Visit) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *Visit) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Visit) GetTrip() string {
+	if x != nil {
+		return x.Trip
+	}
+	return ""
+}
+
+func (x *Visit) GetArrivedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ArrivedAt
+	}
+	return nil
+}
+
+func (x *Visit) GetDepartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DepartedAt
+	}
+	return nil
+}
+
+func (x *Visit) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+func (x *Visit) GetPrivate() bool {
+	if x != nil {
+		return x.Private
+	}
+	return false
+}
+
+type AddVisitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Visit         *Visit                 `protobuf:"bytes,2,opt,name=visit,proto3" json:"visit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddVisitRequest) Reset() {
+	*x = AddVisitRequest{}
+	mi := &file_visits_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddVisitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddVisitRequest) ProtoMessage() {}
+
+func (x *AddVisitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddVisitRequest.ProtoReflect.Descriptor instead.
+func (*AddVisitRequest) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AddVisitRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *AddVisitRequest) GetVisit() *Visit {
+	if x != nil {
+		return x.Visit
+	}
+	return nil
+}
+
+type DeleteVisitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Visit         string                 `protobuf:"bytes,2,opt,name=visit,proto3" json:"visit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteVisitRequest) Reset() {
+	*x = DeleteVisitRequest{}
+	mi := &file_visits_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteVisitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteVisitRequest) ProtoMessage() {}
+
+func (x *DeleteVisitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteVisitRequest.ProtoReflect.Descriptor instead.
+func (*DeleteVisitRequest) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DeleteVisitRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *DeleteVisitRequest) GetVisit() string {
+	if x != nil {
+		return x.Visit
+	}
+	return ""
+}
+
+type DeleteVisitResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteVisitResponse) Reset() {
+	*x = DeleteVisitResponse{}
+	mi := &file_visits_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteVisitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteVisitResponse) ProtoMessage() {}
+
+func (x *DeleteVisitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteVisitResponse.ProtoReflect.Descriptor instead.
+func (*DeleteVisitResponse) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{3}
+}
+
+type ListVisitsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	State         string                 `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	City          string                 `protobuf:"bytes,3,opt,name=city,proto3" json:"city,omitempty"`
+	Trip          string                 `protobuf:"bytes,4,opt,name=trip,proto3" json:"trip,omitempty"`
+	From          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=from,proto3" json:"from,omitempty"`
+	To            *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=to,proto3" json:"to,omitempty"`
+	Sort          string                 `protobuf:"bytes,7,opt,name=sort,proto3" json:"sort,omitempty"`
+	Start         int32                  `protobuf:"varint,8,opt,name=start,proto3" json:"start,omitempty"`
+	Limit         int32                  `protobuf:"varint,9,opt,name=limit,proto3" json:"limit,omitempty"`
+	Cursor        string                 `protobuf:"bytes,10,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVisitsRequest) Reset() {
+	*x = ListVisitsRequest{}
+	mi := &file_visits_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVisitsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVisitsRequest) ProtoMessage() {}
+
+func (x *ListVisitsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVisitsRequest.ProtoReflect.Descriptor instead.
+func (*ListVisitsRequest) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListVisitsRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *ListVisitsRequest) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *ListVisitsRequest) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *ListVisitsRequest) GetTrip() string {
+	if x != nil {
+		return x.Trip
+	}
+	return ""
+}
+
+func (x *ListVisitsRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *ListVisitsRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *ListVisitsRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListVisitsRequest) GetStart() int32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *ListVisitsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListVisitsRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type ListVisitsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Visits        []*Visit               `protobuf:"bytes,1,rep,name=visits,proto3" json:"visits,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVisitsResponse) Reset() {
+	*x = ListVisitsResponse{}
+	mi := &file_visits_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVisitsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVisitsResponse) ProtoMessage() {}
+
+func (x *ListVisitsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVisitsResponse.ProtoReflect.Descriptor instead.
+func (*ListVisitsResponse) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListVisitsResponse) GetVisits() []*Visit {
+	if x != nil {
+		return x.Visits
+	}
+	return nil
+}
+
+func (x *ListVisitsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type ListVisitedStatesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVisitedStatesRequest) Reset() {
+	*x = ListVisitedStatesRequest{}
+	mi := &file_visits_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVisitedStatesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVisitedStatesRequest) ProtoMessage() {}
+
+func (x *ListVisitedStatesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVisitedStatesRequest.ProtoReflect.Descriptor instead.
+func (*ListVisitedStatesRequest) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListVisitedStatesRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+type ListVisitedStatesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	States        []string               `protobuf:"bytes,1,rep,name=states,proto3" json:"states,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVisitedStatesResponse) Reset() {
+	*x = ListVisitedStatesResponse{}
+	mi := &file_visits_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVisitedStatesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVisitedStatesResponse) ProtoMessage() {}
+
+func (x *ListVisitedStatesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVisitedStatesResponse.ProtoReflect.Descriptor instead.
+func (*ListVisitedStatesResponse) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListVisitedStatesResponse) GetStates() []string {
+	if x != nil {
+		return x.States
+	}
+	return nil
+}
+
+type ListCitiesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         string                 `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCitiesRequest) Reset() {
+	*x = ListCitiesRequest{}
+	mi := &file_visits_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCitiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCitiesRequest) ProtoMessage() {}
+
+func (x *ListCitiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCitiesRequest.ProtoReflect.Descriptor instead.
+func (*ListCitiesRequest) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListCitiesRequest) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+type ListCitiesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cities        []string               `protobuf:"bytes,1,rep,name=cities,proto3" json:"cities,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCitiesResponse) Reset() {
+	*x = ListCitiesResponse{}
+	mi := &file_visits_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCitiesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCitiesResponse) ProtoMessage() {}
+
+func (x *ListCitiesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCitiesResponse.ProtoReflect.Descriptor instead.
+func (*ListCitiesResponse) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListCitiesResponse) GetCities() []string {
+	if x != nil {
+		return x.Cities
+	}
+	return nil
+}
+
+type WatchVisitsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchVisitsRequest) Reset() {
+	*x = WatchVisitsRequest{}
+	mi := &file_visits_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchVisitsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchVisitsRequest) ProtoMessage() {}
+
+func (x *WatchVisitsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_visits_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchVisitsRequest.ProtoReflect.Descriptor instead.
+func (*WatchVisitsRequest) Descriptor() ([]byte, []int) {
+	return file_visits_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WatchVisitsRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+var File_visits_proto protoreflect.FileDescriptor
+
+const file_visits_proto_rawDesc = "" +
+	"\n" +
+	"\fvisits.proto\x12\tbeenthere\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd2\x02\n" +
+	"\x05Visit\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04city\x18\x02 \x01(\tR\x04city\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\tR\x05state\x12\x12\n" +
+	"\x04user\x18\x04 \x01(\tR\x04user\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x12\n" +
+	"\x04trip\x18\x06 \x01(\tR\x04trip\x129\n" +
+	"\n" +
+	"arrived_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tarrivedAt\x12;\n" +
+	"\vdeparted_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"departedAt\x12\x1b\n" +
+	"\ttime_zone\x18\t \x01(\tR\btimeZone\x12\x18\n" +
+	"\aprivate\x18\n" +
+	" \x01(\bR\aprivate\"M\n" +
+	"\x0fAddVisitRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12&\n" +
+	"\x05visit\x18\x02 \x01(\v2\x10.beenthere.VisitR\x05visit\">\n" +
+	"\x12DeleteVisitRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12\x14\n" +
+	"\x05visit\x18\x02 \x01(\tR\x05visit\"\x15\n" +
+	"\x13DeleteVisitResponse\"\x99\x02\n" +
+	"\x11ListVisitsRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\tR\x05state\x12\x12\n" +
+	"\x04city\x18\x03 \x01(\tR\x04city\x12\x12\n" +
+	"\x04trip\x18\x04 \x01(\tR\x04trip\x12.\n" +
+	"\x04from\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12\x12\n" +
+	"\x04sort\x18\a \x01(\tR\x04sort\x12\x14\n" +
+	"\x05start\x18\b \x01(\x05R\x05start\x12\x14\n" +
+	"\x05limit\x18\t \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\n" +
+	" \x01(\tR\x06cursor\"_\n" +
+	"\x12ListVisitsResponse\x12(\n" +
+	"\x06visits\x18\x01 \x03(\v2\x10.beenthere.VisitR\x06visits\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\".\n" +
+	"\x18ListVisitedStatesRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\"3\n" +
+	"\x19ListVisitedStatesResponse\x12\x16\n" +
+	"\x06states\x18\x01 \x03(\tR\x06states\")\n" +
+	"\x11ListCitiesRequest\x12\x14\n" +
+	"\x05state\x18\x01 \x01(\tR\x05state\",\n" +
+	"\x12ListCitiesResponse\x12\x16\n" +
+	"\x06cities\x18\x01 \x03(\tR\x06cities\"(\n" +
+	"\x12WatchVisitsRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user2\xc8\x03\n" +
+	"\x06Visits\x128\n" +
+	"\bAddVisit\x12\x1a.beenthere.AddVisitRequest\x1a\x10.beenthere.Visit\x12L\n" +
+	"\vDeleteVisit\x12\x1d.beenthere.DeleteVisitRequest\x1a\x1e.beenthere.DeleteVisitResponse\x12I\n" +
+	"\n" +
+	"ListVisits\x12\x1c.beenthere.ListVisitsRequest\x1a\x1d.beenthere.ListVisitsResponse\x12^\n" +
+	"\x11ListVisitedStates\x12#.beenthere.ListVisitedStatesRequest\x1a$.beenthere.ListVisitedStatesResponse\x12I\n" +
+	"\n" +
+	"ListCities\x12\x1c.beenthere.ListCitiesRequest\x1a\x1d.beenthere.ListCitiesResponse\x12@\n" +
+	"\vWatchVisits\x12\x1d.beenthere.WatchVisitsRequest\x1a\x10.beenthere.Visit0\x01B3Z1github.com/nstogner/beenthere-ws/grpcapi/visitspbb\x06proto3"
+
+var (
+	file_visits_proto_rawDescOnce sync.Once
+	file_visits_proto_rawDescData []byte
+)
+
+func file_visits_proto_rawDescGZIP() []byte {
+	file_visits_proto_rawDescOnce.Do(func() {
+		file_visits_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_visits_proto_rawDesc), len(file_visits_proto_rawDesc)))
+	})
+	return file_visits_proto_rawDescData
+}
+
+var file_visits_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_visits_proto_goTypes = []any{
+	(*Visit)(nil),                     // 0: beenthere.Visit
+	(*AddVisitRequest)(nil),           // 1: beenthere.AddVisitRequest
+	(*DeleteVisitRequest)(nil),        // 2: beenthere.DeleteVisitRequest
+	(*DeleteVisitResponse)(nil),       // 3: beenthere.DeleteVisitResponse
+	(*ListVisitsRequest)(nil),         // 4: beenthere.ListVisitsRequest
+	(*ListVisitsResponse)(nil),        // 5: beenthere.ListVisitsResponse
+	(*ListVisitedStatesRequest)(nil),  // 6: beenthere.ListVisitedStatesRequest
+	(*ListVisitedStatesResponse)(nil), // 7: beenthere.ListVisitedStatesResponse
+	(*ListCitiesRequest)(nil),         // 8: beenthere.ListCitiesRequest
+	(*ListCitiesResponse)(nil),        // 9: beenthere.ListCitiesResponse
+	(*WatchVisitsRequest)(nil),        // 10: beenthere.WatchVisitsRequest
+	(*timestamppb.Timestamp)(nil),     // 11: google.protobuf.Timestamp
+}
+var file_visits_proto_depIdxs = []int32{
+	11, // 0: beenthere.Visit.timestamp:type_name -> google.protobuf.Timestamp
+	11, // 1: beenthere.Visit.arrived_at:type_name -> google.protobuf.Timestamp
+	11, // 2: beenthere.Visit.departed_at:type_name -> google.protobuf.Timestamp
+	0,  // 3: beenthere.AddVisitRequest.visit:type_name -> beenthere.Visit
+	11, // 4: beenthere.ListVisitsRequest.from:type_name -> google.protobuf.Timestamp
+	11, // 5: beenthere.ListVisitsRequest.to:type_name -> google.protobuf.Timestamp
+	0,  // 6: beenthere.ListVisitsResponse.visits:type_name -> beenthere.Visit
+	1,  // 7: beenthere.Visits.AddVisit:input_type -> beenthere.AddVisitRequest
+	2,  // 8: beenthere.Visits.DeleteVisit:input_type -> beenthere.DeleteVisitRequest
+	4,  // 9: beenthere.Visits.ListVisits:input_type -> beenthere.ListVisitsRequest
+	6,  // 10: beenthere.Visits.ListVisitedStates:input_type -> beenthere.ListVisitedStatesRequest
+	8,  // 11: beenthere.Visits.ListCities:input_type -> beenthere.ListCitiesRequest
+	10, // 12: beenthere.Visits.WatchVisits:input_type -> beenthere.WatchVisitsRequest
+	0,  // 13: beenthere.Visits.AddVisit:output_type -> beenthere.Visit
+	3,  // 14: beenthere.Visits.DeleteVisit:output_type -> beenthere.DeleteVisitResponse
+	5,  // 15: beenthere.Visits.ListVisits:output_type -> beenthere.ListVisitsResponse
+	7,  // 16: beenthere.Visits.ListVisitedStates:output_type -> beenthere.ListVisitedStatesResponse
+	9,  // 17: beenthere.Visits.ListCities:output_type -> beenthere.ListCitiesResponse
+	0,  // 18: beenthere.Visits.WatchVisits:output_type -> beenthere.Visit
+	13, // [13:19] is the sub-list for method output_type
+	7,  // [7:13] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_visits_proto_init() }
+func file_visits_proto_init() {
+	if File_visits_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_visits_proto_rawDesc), len(file_visits_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_visits_proto_goTypes,
+		DependencyIndexes: file_visits_proto_depIdxs,
+		MessageInfos:      file_visits_proto_msgTypes,
+	}.Build()
+	File_visits_proto = out.File
+	file_visits_proto_goTypes = nil
+	file_visits_proto_depIdxs = nil
+}
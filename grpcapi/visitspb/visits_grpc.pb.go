@@ -0,0 +1,320 @@
+// The Visits service, served alongside the REST API on GRPC_PORT. Go code is
+// generated into the visitspb package (see grpcapi/generate.go).
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: visits.proto
+
+package visitspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Visits_AddVisit_FullMethodName          = "/beenthere.Visits/AddVisit"
+	Visits_DeleteVisit_FullMethodName       = "/beenthere.Visits/DeleteVisit"
+	Visits_ListVisits_FullMethodName        = "/beenthere.Visits/ListVisits"
+	Visits_ListVisitedStates_FullMethodName = "/beenthere.Visits/ListVisitedStates"
+	Visits_ListCities_FullMethodName        = "/beenthere.Visits/ListCities"
+	Visits_WatchVisits_FullMethodName       = "/beenthere.Visits/WatchVisits"
+)
+
+// VisitsClient is the client API for Visits service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type VisitsClient interface {
+	AddVisit(ctx context.Context, in *AddVisitRequest, opts ...grpc.CallOption) (*Visit, error)
+	DeleteVisit(ctx context.Context, in *DeleteVisitRequest, opts ...grpc.CallOption) (*DeleteVisitResponse, error)
+	ListVisits(ctx context.Context, in *ListVisitsRequest, opts ...grpc.CallOption) (*ListVisitsResponse, error)
+	ListVisitedStates(ctx context.Context, in *ListVisitedStatesRequest, opts ...grpc.CallOption) (*ListVisitedStatesResponse, error)
+	ListCities(ctx context.Context, in *ListCitiesRequest, opts ...grpc.CallOption) (*ListCitiesResponse, error)
+	// WatchVisits streams visits as they are added.
+	WatchVisits(ctx context.Context, in *WatchVisitsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Visit], error)
+}
+
+type visitsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVisitsClient(cc grpc.ClientConnInterface) VisitsClient {
+	return &visitsClient{cc}
+}
+
+func (c *visitsClient) AddVisit(ctx context.Context, in *AddVisitRequest, opts ...grpc.CallOption) (*Visit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Visit)
+	err := c.cc.Invoke(ctx, Visits_AddVisit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *visitsClient) DeleteVisit(ctx context.Context, in *DeleteVisitRequest, opts ...grpc.CallOption) (*DeleteVisitResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteVisitResponse)
+	err := c.cc.Invoke(ctx, Visits_DeleteVisit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *visitsClient) ListVisits(ctx context.Context, in *ListVisitsRequest, opts ...grpc.CallOption) (*ListVisitsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVisitsResponse)
+	err := c.cc.Invoke(ctx, Visits_ListVisits_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *visitsClient) ListVisitedStates(ctx context.Context, in *ListVisitedStatesRequest, opts ...grpc.CallOption) (*ListVisitedStatesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVisitedStatesResponse)
+	err := c.cc.Invoke(ctx, Visits_ListVisitedStates_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *visitsClient) ListCities(ctx context.Context, in *ListCitiesRequest, opts ...grpc.CallOption) (*ListCitiesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListCitiesResponse)
+	err := c.cc.Invoke(ctx, Visits_ListCities_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *visitsClient) WatchVisits(ctx context.Context, in *WatchVisitsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Visit], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Visits_ServiceDesc.Streams[0], Visits_WatchVisits_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchVisitsRequest, Visit]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Visits_WatchVisitsClient = grpc.ServerStreamingClient[Visit]
+
+// VisitsServer is the server API for Visits service.
+// All implementations must embed UnimplementedVisitsServer
+// for forward compatibility.
+type VisitsServer interface {
+	AddVisit(context.Context, *AddVisitRequest) (*Visit, error)
+	DeleteVisit(context.Context, *DeleteVisitRequest) (*DeleteVisitResponse, error)
+	ListVisits(context.Context, *ListVisitsRequest) (*ListVisitsResponse, error)
+	ListVisitedStates(context.Context, *ListVisitedStatesRequest) (*ListVisitedStatesResponse, error)
+	ListCities(context.Context, *ListCitiesRequest) (*ListCitiesResponse, error)
+	// WatchVisits streams visits as they are added.
+	WatchVisits(*WatchVisitsRequest, grpc.ServerStreamingServer[Visit]) error
+	mustEmbedUnimplementedVisitsServer()
+}
+
+// UnimplementedVisitsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVisitsServer struct{}
+
+func (UnimplementedVisitsServer) AddVisit(context.Context, *AddVisitRequest) (*Visit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddVisit not implemented")
+}
+func (UnimplementedVisitsServer) DeleteVisit(context.Context, *DeleteVisitRequest) (*DeleteVisitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteVisit not implemented")
+}
+func (UnimplementedVisitsServer) ListVisits(context.Context, *ListVisitsRequest) (*ListVisitsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVisits not implemented")
+}
+func (UnimplementedVisitsServer) ListVisitedStates(context.Context, *ListVisitedStatesRequest) (*ListVisitedStatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVisitedStates not implemented")
+}
+func (UnimplementedVisitsServer) ListCities(context.Context, *ListCitiesRequest) (*ListCitiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCities not implemented")
+}
+func (UnimplementedVisitsServer) WatchVisits(*WatchVisitsRequest, grpc.ServerStreamingServer[Visit]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchVisits not implemented")
+}
+func (UnimplementedVisitsServer) mustEmbedUnimplementedVisitsServer() {}
+func (UnimplementedVisitsServer) testEmbeddedByValue()                {}
+
+// UnsafeVisitsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VisitsServer will
+// result in compilation errors.
+type UnsafeVisitsServer interface {
+	mustEmbedUnimplementedVisitsServer()
+}
+
+func RegisterVisitsServer(s grpc.ServiceRegistrar, srv VisitsServer) {
+	// If the following call pancis, it indicates UnimplementedVisitsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Visits_ServiceDesc, srv)
+}
+
+func _Visits_AddVisit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddVisitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VisitsServer).AddVisit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Visits_AddVisit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VisitsServer).AddVisit(ctx, req.(*AddVisitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Visits_DeleteVisit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteVisitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VisitsServer).DeleteVisit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Visits_DeleteVisit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VisitsServer).DeleteVisit(ctx, req.(*DeleteVisitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Visits_ListVisits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVisitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VisitsServer).ListVisits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Visits_ListVisits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VisitsServer).ListVisits(ctx, req.(*ListVisitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Visits_ListVisitedStates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVisitedStatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VisitsServer).ListVisitedStates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Visits_ListVisitedStates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VisitsServer).ListVisitedStates(ctx, req.(*ListVisitedStatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Visits_ListCities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VisitsServer).ListCities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Visits_ListCities_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VisitsServer).ListCities(ctx, req.(*ListCitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Visits_WatchVisits_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchVisitsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VisitsServer).WatchVisits(m, &grpc.GenericServerStream[WatchVisitsRequest, Visit]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Visits_WatchVisitsServer = grpc.ServerStreamingServer[Visit]
+
+// Visits_ServiceDesc is the grpc.ServiceDesc for Visits service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Visits_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "beenthere.Visits",
+	HandlerType: (*VisitsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddVisit",
+			Handler:    _Visits_AddVisit_Handler,
+		},
+		{
+			MethodName: "DeleteVisit",
+			Handler:    _Visits_DeleteVisit_Handler,
+		},
+		{
+			MethodName: "ListVisits",
+			Handler:    _Visits_ListVisits_Handler,
+		},
+		{
+			MethodName: "ListVisitedStates",
+			Handler:    _Visits_ListVisitedStates_Handler,
+		},
+		{
+			MethodName: "ListCities",
+			Handler:    _Visits_ListCities_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchVisits",
+			Handler:       _Visits_WatchVisits_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "visits.proto",
+}
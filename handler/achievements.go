@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/achievements"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/routeradapt"
+	"github.com/nstogner/httpware/streamware"
+	"golang.org/x/net/context"
+)
+
+// badge reports a user's progress towards an achievement.
+type badge struct {
+	ID          string     `json:"achievement" xml:"achievement"`
+	Name        string     `json:"name" xml:"name"`
+	Description string     `json:"description" xml:"description"`
+	Goal        int        `json:"goal" xml:"goal"`
+	Progress    int        `json:"progress" xml:"progress"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty" xml:"unlocked_at,omitempty"`
+}
+
+// GetAchievements serves every achievement along with a given user's progress
+// towards it. Achievements which are only unlocked by private visits are
+// only shown to the user.
+func (h *Handler) GetAchievements(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	public, err := h.viewer(req, userId)
+	if err != nil {
+		return err
+	}
+	states, err := h.service.StatesVisited(userId, public)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	cities, err := h.citiesVisited(userId, public)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	unlocked, err := h.achievements.Get(userId)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	unlockedAt := make(map[string]time.Time)
+	for _, a := range unlocked {
+		if !(public && a.Private) {
+			unlockedAt[a.Rule] = a.UnlockedAt
+		}
+	}
+
+	badges := make([]badge, 0)
+	for _, rl := range h.achievements.Rules() {
+		b := badge{
+			ID:          rl.ID,
+			Name:        rl.Name,
+			Description: rl.Description,
+			Goal:        rl.Goal(),
+			Progress:    rl.Progress(states, cities),
+		}
+		if t, ok := unlockedAt[rl.ID]; ok {
+			b.UnlockedAt = &t
+		}
+		badges = append(badges, b)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Achievements []badge `json:"achievements" xml:"achievements"`
+	}{badges})
+	return nil
+}
+
+// StreamAchievements opens a connection for sending achievements as they are
+// unlocked via Server Sent Events (SSE). Only achievements which the caller
+// may view are sent, so achievements which were unlocked privately are sent
+// to everyone but their user once they are unlocked publicly.
+func (h *Handler) StreamAchievements(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	sender := streamware.SenderFromCtx(ctx)
+	caller := h.caller(req)
+	stream, err := h.achievements.Unlocks()
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	defer stream.Close()
+	a := &achievements.Achievement{}
+	for stream.Next(a) {
+		if a.User == caller && stream.Repeat() {
+			a = &achievements.Achievement{}
+			continue
+		}
+		if a.User != caller {
+			if a.Private {
+				a = &achievements.Achievement{}
+				continue
+			}
+			p, err := h.profiles.Get(a.User)
+			if err != nil {
+				return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+			}
+			ok, err := h.canView(caller, p)
+			if err != nil {
+				return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+			}
+			if !ok {
+				a = &achievements.Achievement{}
+				continue
+			}
+		}
+		js, err := json.Marshal(a)
+		if err != nil {
+			return httpware.NewErr("unable to marshal achievement into json: "+err.Error(), http.StatusInternalServerError)
+		}
+		sender.Send(string(js))
+		a = &achievements.Achievement{}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/pageware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// RequestIDHeader identifies a request in the audit log. It is taken from
+// the request when set (ie: by a proxy) & generated otherwise, and is echoed
+// in the response either way.
+const RequestIDHeader = "X-Request-ID"
+
+// identify ensures that a request has an id (see RequestIDHeader).
+func identify(res http.ResponseWriter, req *http.Request) {
+	id := req.Header.Get(RequestIDHeader)
+	if id == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+		req.Header.Set(RequestIDHeader, id)
+	}
+	res.Header().Set(RequestIDHeader, id)
+}
+
+// actor returns who is making a request, for the audit log (see clientIP).
+func (h *Handler) actor(req *http.Request) visits.Actor {
+	return visits.Actor{
+		User:      h.caller(req),
+		RequestID: req.Header.Get(RequestIDHeader),
+		IP:        h.clientIP(req),
+	}
+}
+
+// clientIP returns the IP of the client making a request. Requests from the
+// trusted proxies are traced back through their "X-Forwarded-For" header,
+// from the right, to the first address which is not a trusted proxy, since
+// any addresses before it may have been set by the client.
+func (h *Handler) clientIP(req *http.Request) string {
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	hops := make([]string, 0)
+	for _, fwd := range req.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(fwd, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && h.trusted(ip); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+// trusted reports whether an IP belongs to one of the trusted proxies.
+func (h *Handler) trusted(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range h.trustedProxies {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVisitHistory serves every change made to one of a user's visits, oldest
+// first.
+func (h *Handler) GetVisitHistory(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	entries, err := h.service.VisitHistory(h.caller(req), ps.ByName("user"), ps.ByName("visit"))
+	if err != nil {
+		return apiErr(err)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		History []visits.AuditEntry `json:"history" xml:"history"`
+	}{entries})
+	return nil
+}
+
+// GetAudit serves the audit log of every visit, most recent first, filtered
+// via query parameters (see visits.AuditQuery).
+func (h *Handler) GetAudit(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	page := pageware.PageFromCtx(ctx)
+	query := req.URL.Query()
+
+	q := visits.AuditQuery{
+		User:   query.Get("user"),
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Start:  page.Start,
+		Limit:  page.Limit,
+	}
+	var err error
+	if q.From, err = timeParam(query.Get("from"), false); err != nil {
+		return httpware.NewErr("invalid 'from' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	if q.To, err = timeParam(query.Get("to"), true); err != nil {
+		return httpware.NewErr("invalid 'to' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	entries, err := h.service.Audit(h.caller(req), q)
+	if err != nil {
+		return apiErr(err)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Entries []visits.AuditEntry `json:"entries" xml:"entries"`
+	}{entries})
+	return nil
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// GetComparison serves the states & cities which two users have both
+// visited, those which only one of them has visited and how similar their
+// travels are. The caller must be able to view both users' visits.
+func (h *Handler) GetComparison(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId, otherId := ps.ByName("user"), ps.ByName("other")
+
+	userPublic, err := h.viewer(req, userId)
+	if err != nil {
+		return err
+	}
+	otherPublic, err := h.viewer(req, otherId)
+	if err != nil {
+		return err
+	}
+
+	userStates, userCities, err := h.placesVisited(userId, userPublic)
+	if err != nil {
+		return err
+	}
+	otherStates, otherCities, err := h.placesVisited(otherId, otherPublic)
+	if err != nil {
+		return err
+	}
+	states := visits.Compare(userStates, otherStates)
+	cities := visits.Compare(userCities, otherCities)
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		User   string             `json:"user" xml:"user"`
+		Other  string             `json:"other" xml:"other"`
+		States *visits.Comparison `json:"states" xml:"states"`
+		Cities *visits.Comparison `json:"cities" xml:"cities"`
+		// Similarity averages the similarity of states & cities.
+		Similarity float64 `json:"similarity" xml:"similarity"`
+	}{
+		User:       userId,
+		Other:      otherId,
+		States:     states,
+		Cities:     cities,
+		Similarity: (states.Similarity + cities.Similarity) / 2,
+	})
+	return nil
+}
+
+// placesVisited returns the states & city ids ("City,ST") visited by a given
+// user. City ids are compared since city names are not unique across states.
+func (h *Handler) placesVisited(userId string, public bool) ([]string, []string, error) {
+	states, err := h.service.StatesVisited(userId, public)
+	if err != nil {
+		return nil, nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	cities, err := h.citiesVisited(userId, public)
+	if err != nil {
+		return nil, nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	return states, cities, nil
+}
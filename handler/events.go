@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nstogner/beenthere-ws/outbox"
+	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/streamware"
+	"golang.org/x/net/context"
+)
+
+// StreamEvents opens a connection for sending visit events from the outbox
+// via Server Sent Events (SSE). Passing the id of the last event received as
+// the "after" query parameter resumes the stream without missing any events.
+// Only events which the caller may view are sent.
+func (h *Handler) StreamEvents(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	caller := h.caller(req)
+
+	var last *visits.Event
+	if after := req.URL.Query().Get("after"); after != "" {
+		e, err := h.outbox.Get(after)
+		if err == outbox.ErrNotFound {
+			return httpware.NewErr("no such event", http.StatusNotFound)
+		}
+		if err != nil {
+			return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		last = e
+	}
+
+	// Subscribe before catching up so that no events fall in between.
+	live, unsubscribe := h.events.Subscribe()
+	defer unsubscribe()
+
+	sender := streamware.SenderFromCtx(ctx)
+	send := func(e *visits.Event) error {
+		if e.Visit == nil {
+			return nil
+		}
+		ok, err := h.service.CanViewVisit(caller, e.Visit)
+		if err != nil {
+			return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		if !ok {
+			return nil
+		}
+		js, err := json.Marshal(e)
+		if err != nil {
+			return httpware.NewErr("unable to marshal event into json: "+err.Error(), http.StatusInternalServerError)
+		}
+		sender.Send(string(js))
+		return nil
+	}
+
+	for last != nil {
+		events, err := h.outbox.GetEvents(last, 100)
+		if err != nil {
+			return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		if len(events) == 0 {
+			break
+		}
+		for i := range events {
+			if err := send(&events[i]); err != nil {
+				return err
+			}
+		}
+		last = &events[len(events)-1]
+	}
+
+	for e := range live {
+		// Skip events which were already sent while catching up.
+		if last != nil && (e.Created.Before(last.Created) || (e.Created.Equal(last.Created) && e.ID <= last.ID)) {
+			continue
+		}
+		if err := send(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
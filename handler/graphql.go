@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nstogner/beenthere-ws/graphqlapi"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/streamware"
+	"golang.org/x/net/context"
+)
+
+// graphQLRequest reads a GraphQL request from either a JSON body (POST) or
+// the "query", "operationName" & "variables" query parameters (GET).
+func graphQLRequest(req *http.Request) (*graphqlapi.Request, error) {
+	gr := &graphqlapi.Request{}
+	if req.Method == "POST" {
+		if err := json.NewDecoder(req.Body).Decode(gr); err != nil {
+			return nil, httpware.NewErr("unable to parse body: "+err.Error(), http.StatusBadRequest)
+		}
+	} else {
+		query := req.URL.Query()
+		gr.Query = query.Get("query")
+		gr.OperationName = query.Get("operationName")
+		if vars := query.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &gr.Variables); err != nil {
+				return nil, httpware.NewErr("unable to parse 'variables': "+err.Error(), http.StatusBadRequest).WithField("invalid", "variables")
+			}
+		}
+	}
+	if gr.Query == "" {
+		return nil, httpware.NewErr("missing 'query' field", http.StatusBadRequest)
+	}
+	return gr, nil
+}
+
+// PostGraphQL executes a GraphQL query. Query errors are reported in the
+// "errors" field of the response, as GraphQL clients expect, rather than by
+// status code. Responses are always JSON.
+func (h *Handler) PostGraphQL(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	gr, err := graphQLRequest(req)
+	if err != nil {
+		return err
+	}
+	rsp := h.graphql.Exec(ctx, h.caller(req), gr)
+
+	js, err := json.Marshal(rsp)
+	if err != nil {
+		return httpware.NewErr("unable to marshal response into json: "+err.Error(), http.StatusInternalServerError)
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(js)
+	return nil
+}
+
+// StreamGraphQL runs a GraphQL subscription (ie: visitAdded), sending each
+// result via Server Sent Events (SSE).
+func (h *Handler) StreamGraphQL(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	gr, err := graphQLRequest(req)
+	if err != nil {
+		return err
+	}
+	results, err := h.graphql.Subscribe(ctx, h.caller(req), gr)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusBadRequest)
+	}
+
+	sender := streamware.SenderFromCtx(ctx)
+	for rsp := range results {
+		js, err := json.Marshal(rsp)
+		if err != nil {
+			return httpware.NewErr("unable to marshal response into json: "+err.Error(), http.StatusInternalServerError)
+		}
+		sender.Send(string(js))
+	}
+	return nil
+}
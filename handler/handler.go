@@ -2,12 +2,28 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/julienschmidt/httprouter"
+	"github.com/nstogner/beenthere-ws/achievements"
+	"github.com/nstogner/beenthere-ws/graphqlapi"
 	"github.com/nstogner/beenthere-ws/locations"
+	"github.com/nstogner/beenthere-ws/openapi"
+	"github.com/nstogner/beenthere-ws/outbox"
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/service"
+	"github.com/nstogner/beenthere-ws/shares"
+	"github.com/nstogner/beenthere-ws/social"
+	"github.com/nstogner/beenthere-ws/summaries"
+	"github.com/nstogner/beenthere-ws/trips"
 	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/beenthere-ws/webhooks"
 	"github.com/nstogner/httpware"
 	"github.com/nstogner/httpware/contentware"
 	"github.com/nstogner/httpware/logware"
@@ -20,11 +36,30 @@ import (
 // Handler maintains a database clients and fulfills the http.Handler
 // interface.
 type Handler struct {
-	middleware *httpware.Composite
-	visits     *visits.Client
-	locations  *locations.Client
-	router     *httprouter.Router
-	logger     *logrus.Logger
+	middleware   *httpware.Composite
+	visits       *visits.Client
+	locations    *locations.Client
+	trips        *trips.Client
+	summaries    *summaries.Client
+	profiles     *profiles.Client
+	social       *social.Client
+	shares       *shares.Client
+	achievements *achievements.Client
+	webhooks     *webhooks.Client
+	outbox       *outbox.Client
+	events       *outbox.Hub
+	service      *service.Service
+	graphql      *graphqlapi.API
+	maps         *mapCache
+	router       *httprouter.Router
+	customs      []customRoute
+	routes       []Route
+	spec         *openapi.Spec
+	logger       *logrus.Logger
+	authHeader   string
+	// validateResponses checks responses against the spec as well.
+	validateResponses bool
+	trustedProxies    []*net.IPNet
 }
 
 // Config is used to create a new instance of Handler in New(...).
@@ -32,15 +67,72 @@ type Config struct {
 	Logger       *logrus.Logger
 	VisitsClient *visits.Client
 	LocsClient   *locations.Client
+	TripsClient  *trips.Client
+	SummsClient  *summaries.Client
+	ProfsClient  *profiles.Client
+	SocialClient *social.Client
+	SharesClient *shares.Client
+	AchvsClient  *achievements.Client
+	HooksClient  *webhooks.Client
+	OutboxClient *outbox.Client
+	// EventHub is the outbox sink which events are streamed from.
+	EventHub *outbox.Hub
+	// AuthHeader names the request header which identifies the calling
+	// user. It defaults to "X-Auth-User".
+	AuthHeader string
+	// Spec is served at /openapi.json & every request which it describes is
+	// validated against it. Nothing is validated when it is nil.
+	Spec *openapi.Spec
+	// ValidateResponses also validates responses against the Spec. It is
+	// meant for tests, as every response is buffered.
+	ValidateResponses bool
+	// Admins are the users who may query the audit log of every visit.
+	Admins []string
+	// TrustedProxies are the addresses of the proxies in front of the
+	// service, whose "X-Forwarded-For" headers are trusted to name the
+	// client's IP.
+	TrustedProxies []*net.IPNet
 }
 
 // New returns an instance of Handler with registered routes.
 func New(conf Config) *Handler {
 	h := &Handler{
-		logger:    conf.Logger,
-		visits:    conf.VisitsClient,
-		locations: conf.LocsClient,
+		logger:            conf.Logger,
+		visits:            conf.VisitsClient,
+		locations:         conf.LocsClient,
+		trips:             conf.TripsClient,
+		summaries:         conf.SummsClient,
+		profiles:          conf.ProfsClient,
+		social:            conf.SocialClient,
+		shares:            conf.SharesClient,
+		achievements:      conf.AchvsClient,
+		webhooks:          conf.HooksClient,
+		outbox:            conf.OutboxClient,
+		events:            conf.EventHub,
+		maps:              newMapCache(mapCacheSize),
+		authHeader:        conf.AuthHeader,
+		spec:              conf.Spec,
+		validateResponses: conf.ValidateResponses,
+		trustedProxies:    conf.TrustedProxies,
 	}
+	if h.authHeader == "" {
+		h.authHeader = "X-Auth-User"
+	}
+	h.service = service.New(service.Config{
+		VisitsClient: h.visits,
+		LocsClient:   h.locations,
+		TripsClient:  h.trips,
+		SummsClient:  h.summaries,
+		ProfsClient:  h.profiles,
+		SocialClient: h.social,
+		Admins:       conf.Admins,
+	})
+	h.graphql = graphqlapi.New(graphqlapi.Config{
+		Service:      h.service,
+		VisitsClient: h.visits,
+		LocsClient:   h.locations,
+		Events:       h.events,
+	})
 
 	// Configure any needed middleware.
 	h.middleware = httpware.Compose(
@@ -56,10 +148,22 @@ func New(conf Config) *Handler {
 	streaming := h.middleware.With(
 		streamware.New(streamware.Defaults),
 	)
+	// Rendered images (& GraphQL responses) are not subject to content
+	// negotiation.
+	rendering := httpware.Compose(
+		httpware.DefaultErrHandler,
+		logware.New(logware.Config{
+			Logger: h.logger,
+		}),
+	)
 
 	// Register all http routes. Note: plural names are used to adhere with
 	// RESTful conventions.
-	rtr := httprouter.New()
+	rtr := &recorder{Router: httprouter.New(), routes: &h.routes}
+	rtr.GET(
+		"/openapi.json",
+		routeradapt.Adapt(rendering.ThenFunc(h.GetOpenAPI)),
+	)
 	rtr.GET("/states/:state/cities", h.wrap(h.GetCities))
 	rtr.POST("/users/:user/visits", h.wrap(h.PostUserVisit))
 	rtr.DELETE("/users/:user/visits/:visit", h.wrap(h.DeleteVisit))
@@ -70,11 +174,123 @@ func New(conf Config) *Handler {
 	)
 	rtr.GET("/users/:user/visits/cities", h.wrap(h.GetCitiesVisited))
 	rtr.GET("/users/:user/visits/states", h.wrap(h.GetStatesVisited))
+	rtr.GET("/users/:user/visits/days", h.wrap(h.GetDaysVisited))
+	rtr.GET(
+		"/users/:user/visits/trash",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetTrash)),
+	)
+	rtr.GET(
+		"/audit",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetAudit)),
+	)
+	rtr.GET("/users/:user/stats", h.wrap(h.GetStats))
+	rtr.GET("/users/:user/compare/:other", h.wrap(h.GetComparison))
+	rtr.GET("/users/:user/achievements", h.wrap(h.GetAchievements))
+	rtr.GET("/users/:user/profile", h.wrap(h.GetProfile))
+	rtr.PUT("/users/:user/profile", h.wrap(h.PutProfile))
+	rtr.GET(
+		"/users/:user/map.svg",
+		routeradapt.Adapt(rendering.ThenFunc(h.GetMapSVG)),
+	)
+	rtr.GET(
+		"/users/:user/map.png",
+		routeradapt.Adapt(rendering.ThenFunc(h.GetMapPNG)),
+	)
+	rtr.POST("/users/:user/trips", h.wrap(h.PostUserTrip))
+	rtr.GET(
+		"/users/:user/trips",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetTrips)),
+	)
+	rtr.GET("/users/:user/trips/:trip", h.wrap(h.GetTrip))
+	rtr.DELETE("/users/:user/trips/:trip", h.wrap(h.DeleteTrip))
+	rtr.GET("/users/:user/trips/:trip/visits", h.wrap(h.GetTripVisits))
+	rtr.POST("/users/:user/trips/:trip/visits", h.wrap(h.PostTripVisits))
+	rtr.DELETE("/users/:user/trips/:trip/visits/:visit", h.wrap(h.DeleteTripVisit))
+	rtr.PUT("/users/:user/following/:followee", h.wrap(h.PutFollowing))
+	rtr.DELETE("/users/:user/following/:followee", h.wrap(h.DeleteFollowing))
+	rtr.PUT("/users/:user/followers/:follower", h.wrap(h.PutFollower))
+	rtr.DELETE("/users/:user/followers/:follower", h.wrap(h.DeleteFollower))
+	rtr.GET(
+		"/users/:user/following",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetFollowing)),
+	)
+	rtr.GET(
+		"/users/:user/followers",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetFollowers)),
+	)
+	rtr.GET(
+		"/users/:user/feed",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetFeed)),
+	)
+	rtr.POST("/users/:user/shares", h.wrap(h.PostShare))
+	rtr.GET("/users/:user/shares", h.wrap(h.GetShares))
+	rtr.DELETE("/users/:user/shares/:share", h.wrap(h.DeleteShare))
+	rtr.POST("/webhooks", h.wrap(h.PostWebhook))
+	rtr.GET("/webhooks", h.wrap(h.GetWebhooks))
+	rtr.DELETE("/webhooks/:webhook", h.wrap(h.DeleteWebhook))
+	rtr.GET(
+		"/webhooks/:webhook/deliveries",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetDeliveries)),
+	)
+	rtr.GET(
+		"/leaderboards/:board",
+		routeradapt.Adapt(paginated.ThenFunc(h.GetLeaderboard)),
+	)
+	rtr.GET(
+		"/graphql",
+		routeradapt.Adapt(rendering.ThenFunc(h.PostGraphQL)),
+	)
+	rtr.POST(
+		"/graphql",
+		routeradapt.Adapt(rendering.ThenFunc(h.PostGraphQL)),
+	)
+	// Shared routes serve the visit & map routes above, read-only.
+	rtr.GET("/shared/:token", h.wrap(h.GetShare))
+	rtr.GET(
+		"/shared/:token/visits",
+		routeradapt.Adapt(paginated.ThenFunc(h.shared(shares.ScopeVisits, h.GetVisits))),
+	)
+	rtr.GET("/shared/:token/visits/cities", h.wrap(h.shared(shares.ScopeCities, h.GetCitiesVisited)))
+	rtr.GET("/shared/:token/visits/states", h.wrap(h.shared(shares.ScopeStates, h.GetStatesVisited)))
+	rtr.GET("/shared/:token/visits/days", h.wrap(h.shared(shares.ScopeVisits, h.GetDaysVisited)))
+	rtr.GET("/shared/:token/stats", h.wrap(h.shared(shares.ScopeVisits, h.GetStats)))
+	rtr.GET(
+		"/shared/:token/map.svg",
+		routeradapt.Adapt(rendering.ThenFunc(h.shared(shares.ScopeStates, h.GetMapSVG))),
+	)
+	rtr.GET(
+		"/shared/:token/map.png",
+		routeradapt.Adapt(rendering.ThenFunc(h.shared(shares.ScopeStates, h.GetMapPNG))),
+	)
 	rtr.GET(
 		"/stream/visits",
 		routeradapt.Adapt(streaming.ThenFunc(h.StreamVisits)),
 	)
-	h.router = rtr
+	rtr.GET(
+		"/stream/users/:user/feed",
+		routeradapt.Adapt(streaming.ThenFunc(h.StreamFeed)),
+	)
+	rtr.GET(
+		"/stream/events",
+		routeradapt.Adapt(streaming.ThenFunc(h.StreamEvents)),
+	)
+	rtr.GET(
+		"/stream/achievements",
+		routeradapt.Adapt(streaming.ThenFunc(h.StreamAchievements)),
+	)
+	rtr.GET(
+		"/stream/graphql",
+		routeradapt.Adapt(streaming.ThenFunc(h.StreamGraphQL)),
+	)
+	h.router = rtr.Router
+
+	// Custom methods of resources (see customRoute).
+	h.custom("POST", "/users/:user/visits", "dedupe", h.wrap(h.DedupeVisits))
+	h.custom("POST", "/users/:user/visits/:visit", "restore", h.wrap(h.RestoreVisit))
+	// A visit's history can not be registered alongside the static routes
+	// under /users/:user/visits (ie: trash) either, so it is matched the same
+	// way.
+	h.suffixed("GET", "/users/:user/visits/:visit", "/history", h.wrap(h.GetVisitHistory))
 
 	return h
 }
@@ -87,22 +303,96 @@ func (h *Handler) wrap(hf httpware.HandlerFunc) httprouter.Handle {
 
 // ServeHTTP fulfills the http.Handler interface.
 func (h *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	identify(res, req)
+	if h.spec != nil {
+		h.serveValidated(res, req)
+		return
+	}
+	h.route(res, req)
+}
+
+// route serves a request with the matching route.
+func (h *Handler) route(res http.ResponseWriter, req *http.Request) {
+	allowed := false
+	for _, c := range h.customs {
+		ps, ok := c.match(req.URL.Path)
+		if !ok {
+			continue
+		}
+		if c.method == req.Method {
+			c.handle(res, req, ps)
+			return
+		}
+		allowed = true
+	}
+	if allowed {
+		http.Error(res, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
 	h.router.ServeHTTP(res, req)
 }
 
+// customRoute is a route matched by a fixed suffix after a resource's path,
+// such as a custom method named after a colon at the end of the path (ie:
+// POST /users/:user/visits:dedupe). The router can not match a path segment
+// which continues after a wildcard, nor a wildcard alongside static
+// segments, so these routes are matched before it (see route).
+type customRoute struct {
+	method   string
+	resource string
+	suffix   string
+	handle   httprouter.Handle
+}
+
+// custom registers a custom method of a resource.
+func (h *Handler) custom(method, resource, verb string, handle httprouter.Handle) {
+	h.suffixed(method, resource, ":"+verb, handle)
+}
+
+// suffixed registers a route matched by a suffix after a resource's path.
+func (h *Handler) suffixed(method, resource, suffix string, handle httprouter.Handle) {
+	h.routes = append(h.routes, Route{Method: method, Path: resource + suffix})
+	h.customs = append(h.customs, customRoute{
+		method:   method,
+		resource: resource,
+		suffix:   suffix,
+		handle:   handle,
+	})
+}
+
+// match returns the params of a path when it names the route.
+func (c *customRoute) match(path string) (httprouter.Params, bool) {
+	if !strings.HasSuffix(path, c.suffix) {
+		return nil, false
+	}
+	want := strings.Split(c.resource, "/")
+	got := strings.Split(strings.TrimSuffix(path, c.suffix), "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+	ps := httprouter.Params{}
+	for i := range want {
+		switch {
+		case strings.HasPrefix(want[i], ":"):
+			if got[i] == "" {
+				return nil, false
+			}
+			ps = append(ps, httprouter.Param{Key: want[i][1:], Value: got[i]})
+		case want[i] != got[i]:
+			return nil, false
+		}
+	}
+	return ps, true
+}
+
 // GetCities serves a list of cities in a given state.
 func (h *Handler) GetCities(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
 	ps := routeradapt.ParamsFromCtx(ctx)
 	state := ps.ByName("state")
 
-	stateName := h.locations.StateName(state)
-	if stateName == "" {
-		return httpware.NewErr("no such state", http.StatusNotFound)
-	}
-
-	dbCities, err := h.locations.GetCityNames(state)
+	dbCities, err := h.service.CityNames(state)
 	if err != nil {
-		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		return apiErr(err)
 	}
 
 	rst := contentware.ResponseTypeFromCtx(ctx)
@@ -112,34 +402,25 @@ func (h *Handler) GetCities(ctx context.Context, res http.ResponseWriter, req *h
 	return nil
 }
 
-// PostUserVisit adds a city/state that a user has visited.
+// PostUserVisit adds a city/state that a user has visited. Only the user may
+// add their visits.
 func (h *Handler) PostUserVisit(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
 	ps := routeradapt.ParamsFromCtx(ctx)
 	userId := ps.ByName("user")
 
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may add their visits", http.StatusForbidden)
+	}
+
 	// Grab the visit details from the http body.
 	visit := visits.NewVisit()
 	rqt := contentware.RequestTypeFromCtx(ctx)
 	if err := rqt.Decode(req.Body, visit); err != nil {
 		return httpware.NewErr("unable to parse body: "+err.Error(), http.StatusBadRequest)
 	}
-	if err := h.visits.Validate(visit); err != nil {
-		return httpware.NewErr("invalid visit", http.StatusBadRequest).WithField("invalid", err.Error())
-	}
-	visit.User = userId
-
-	// Check and see if the given State exists.
-	// TODO: How should City verification work?
-	//       Should a new visit be rejected if the given city doesnt exist in db?
-	//       Should unknown cities be accepted and verified offline?
-	city := locations.CityFromVisit(visit)
-	if err := h.locations.ValidateCity(city); err != nil {
-		return httpware.NewErr("invalid visit", http.StatusBadRequest).WithField("invalid", err.Error())
-	}
-
-	// Save the visit to the database.
-	if err := h.visits.Add(visit); err != nil {
-		return httpware.NewErr("unable to save user visit", http.StatusInternalServerError).WithField("error", err.Error())
+	// Validate & save the visit.
+	if err := h.service.AddVisit(h.actor(req), userId, visit); err != nil {
+		return apiErr(err)
 	}
 
 	// Pass the saved entity back to the client.
@@ -149,46 +430,169 @@ func (h *Handler) PostUserVisit(ctx context.Context, res http.ResponseWriter, re
 	return nil
 }
 
-// DeleteVisit removes a given user's previously added visit.
+// DeleteVisit removes a given user's previously added visit. Only the user
+// may delete their visits.
 func (h *Handler) DeleteVisit(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
 	ps := routeradapt.ParamsFromCtx(ctx)
-	visitId := ps.ByName("visit")
 
 	// Delete the visit from the database.
-	if err := h.visits.Delete(visitId); err != nil {
-		return httpware.NewErr("unable to delete user visit", http.StatusInternalServerError).WithField("error", err.Error())
+	if err := h.service.DeleteVisit(h.actor(req), ps.ByName("user"), ps.ByName("visit")); err != nil {
+		return apiErr(err)
 	}
 
 	res.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-// GetVisits serves a list of visit info for a given user.
-func (h *Handler) GetVisits(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+// DedupeVisits merges a user's historical duplicate visits. The "window"
+// query parameter overrides the configured dedup window and "preview=true"
+// reports what would be merged without removing anything.
+func (h *Handler) DedupeVisits(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
 	ps := routeradapt.ParamsFromCtx(ctx)
 	userId := ps.ByName("user")
+	query := req.URL.Query()
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may dedupe their visits", http.StatusForbidden)
+	}
+	window := h.visits.DedupWindow()
+	if w := query.Get("window"); w != "" {
+		var err error
+		if window, err = time.ParseDuration(w); err != nil {
+			return httpware.NewErr("invalid 'window' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+		}
+	}
+	if window <= 0 {
+		return httpware.NewErr("a positive dedup 'window' is required", http.StatusBadRequest)
+	}
+	preview := false
+	if p := query.Get("preview"); p != "" {
+		var err error
+		if preview, err = strconv.ParseBool(p); err != nil {
+			return httpware.NewErr("invalid 'preview' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+		}
+	}
+
+	merges, err := h.visits.Dedupe(h.actor(req), userId, window, preview)
+	if err != nil {
+		return httpware.NewErr("unable to dedupe user visits", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+	removedIds := make([]string, 0)
+	for _, m := range merges {
+		for _, v := range m.Removed {
+			removedIds = append(removedIds, v.ID)
+		}
+	}
+	removed := len(removedIds)
+	if !preview {
+		if err := h.trips.RemoveVisits(removedIds...); err != nil {
+			return httpware.NewErr("unable to remove visits from trips", http.StatusInternalServerError).WithField("error", err.Error())
+		}
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Preview bool           `json:"preview" xml:"preview"`
+		Removed int            `json:"removed" xml:"removed"`
+		Merges  []visits.Merge `json:"merges" xml:"merges"`
+	}{preview, removed, merges})
+	return nil
+}
+
+// GetVisits serves a list of visit info for a given user. The list may be
+// filtered & sorted via query parameters (see visits.Query). Pages may be
+// requested by offset ("start") or by the opaque "cursor" handed back as
+// "next_cursor" & in the Link header.
+func (h *Handler) GetVisits(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
 	page := pageware.PageFromCtx(ctx)
+	query := req.URL.Query()
 
-	dbVisits, err := h.visits.GetVisits(userId, page.Start, page.Limit)
+	a, err := h.readAccess(ctx, req)
 	if err != nil {
-		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	q := visits.Query{
+		User:   a.user,
+		State:  query.Get("state"),
+		City:   query.Get("city"),
+		Trip:   query.Get("trip"),
+		Sort:   query.Get("sort"),
+		Start:  page.Start,
+		Limit:  page.Limit,
+		Public: a.public,
+	}
+	if q.From, err = timeParam(query.Get("from"), false); err != nil {
+		return httpware.NewErr("invalid 'from' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	if q.To, err = timeParam(query.Get("to"), true); err != nil {
+		return httpware.NewErr("invalid 'to' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	if c := query.Get("cursor"); c != "" {
+		if q.After, err = visits.DecodeCursor(c); err != nil {
+			return httpware.NewErr("invalid 'cursor' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+		}
+	}
+	dbVisits, err := h.service.ListVisits(q)
+	if err != nil {
+		return apiErr(err)
+	}
+
+	// Offer a cursor to the next page when this one is full.
+	nextCursor := ""
+	if q.Cursored() && len(dbVisits) > 0 && len(dbVisits) == q.Limit {
+		nextCursor = visits.CursorAfter(dbVisits[len(dbVisits)-1]).Encode()
+		next := req.URL.Query()
+		next.Del("start")
+		next.Set("cursor", nextCursor)
+		res.Header().Set("Link", "<"+req.URL.Path+"?"+next.Encode()+">; rel=\"next\"")
 	}
 
 	rsp := contentware.ResponseTypeFromCtx(ctx)
 	rsp.Encode(res, struct {
-		Visits []visits.Visit `json:"visits" xml:"visits"`
-	}{dbVisits})
+		Visits     []visits.Visit `json:"visits" xml:"visits"`
+		NextCursor string         `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+	}{dbVisits, nextCursor})
 	return nil
 }
 
+// timeParam parses a time query parameter given as either an RFC 3339 time or
+// a "YYYY-MM-DD" date. When endOfDay is true, dates refer to the last moment
+// of the day rather than the first. An empty value results in a zero time.
+func timeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("expected an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
 // GetCitiesVisited serves a unique list of cities that have been visited by a
 // given user.
 func (h *Handler) GetCitiesVisited(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
-	ps := routeradapt.ParamsFromCtx(ctx)
-	userId := ps.ByName("user")
-
-	// Grab a unique list of cities visited by the given user.
-	dbCities, err := h.visits.GetCities(userId)
+	a, err := h.readAccess(ctx, req)
+	if err != nil {
+		return err
+	}
+	userId, public := a.user, a.public
+
+	// Grab a unique list of cities visited by the given user, preferring the
+	// user's projected summary unless it includes hidden private visits.
+	var dbCities []string
+	summary, err := h.summaries.Get(userId)
+	if err == nil && !(public && summary.Private > 0) {
+		dbCities = summary.CityNames()
+	} else if err == nil || err == summaries.ErrNotFound {
+		dbCities, err = h.visits.GetCities(userId, public)
+	}
 	if err != nil {
 		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
 	}
@@ -203,11 +607,14 @@ func (h *Handler) GetCitiesVisited(ctx context.Context, res http.ResponseWriter,
 // GetStatesVisited serves a unique list of states that have been visited by a
 // given user.
 func (h *Handler) GetStatesVisited(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
-	ps := routeradapt.ParamsFromCtx(ctx)
-	userId := ps.ByName("user")
+	a, err := h.readAccess(ctx, req)
+	if err != nil {
+		return err
+	}
+	userId, public := a.user, a.public
 
 	// Grab a unique list of states visited by the given user.
-	dbStates, err := h.visits.GetStates(userId)
+	dbStates, err := h.service.StatesVisited(userId, public)
 	if err != nil {
 		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
 	}
@@ -223,16 +630,83 @@ func (h *Handler) GetStatesVisited(ctx context.Context, res http.ResponseWriter,
 	return nil
 }
 
+// GetDaysVisited serves the total number of days a given user has spent in
+// each state & city.
+func (h *Handler) GetDaysVisited(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	a, err := h.readAccess(ctx, req)
+	if err != nil {
+		return err
+	}
+	userId, public := a.user, a.public
+	days, err := h.visits.GetDays(userId, public)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, days)
+	return nil
+}
+
+// GetStats serves travel statistics for a given user.
+func (h *Handler) GetStats(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	a, err := h.readAccess(ctx, req)
+	if err != nil {
+		return err
+	}
+	userId, public := a.user, a.public
+	stats, err := h.visits.GetStats(userId, public)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	// Only count known states towards the percentage of states visited, and
+	// the countries of known states towards the countries visited.
+	known := 0
+	countries := make(map[string]bool)
+	for _, s := range stats.States {
+		if h.locations.StateName(s) != "" {
+			known++
+		}
+		if c := h.locations.Country(s); c != "" {
+			countries[c] = true
+		}
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		*visits.Stats
+		States        int     `json:"states" xml:"states"`
+		Countries     int     `json:"countries" xml:"countries"`
+		StatesPercent float64 `json:"states_percent" xml:"states_percent"`
+	}{
+		Stats:         stats,
+		States:        len(stats.States),
+		Countries:     len(countries),
+		StatesPercent: 100 * float64(known) / float64(h.locations.StateCount()),
+	})
+	return nil
+}
+
 // StreamVisits opens a connection for sending live user visit updates via
-// Server Sent Events (SSE).
+// Server Sent Events (SSE). Only visits which the caller may view are sent.
 func (h *Handler) StreamVisits(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
 	sender := streamware.SenderFromCtx(ctx)
+	caller := h.caller(req)
 	stream, err := h.visits.Stream()
 	if err != nil {
 		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
 	}
 	visit := &visits.Visit{}
 	for stream.Next(visit) {
+		ok, err := h.service.CanViewVisit(caller, visit)
+		if err != nil {
+			return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		if !ok {
+			visit = &visits.Visit{}
+			continue
+		}
 		js, err := json.Marshal(visit)
 		if err != nil {
 			return httpware.NewErr("unable to marshal visit into json: "+err.Error(), http.StatusInternalServerError)
@@ -242,3 +716,301 @@ func (h *Handler) StreamVisits(ctx context.Context, res http.ResponseWriter, req
 	}
 	return nil
 }
+
+// PostUserTrip adds a named trip for a user. When the "auto" query parameter
+// is true, the trip is populated with all of the user's existing visits
+// between the trip's start and end dates. Only the user may add their trips.
+func (h *Handler) PostUserTrip(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may add their trips", http.StatusForbidden)
+	}
+	auto := false
+	if a := req.URL.Query().Get("auto"); a != "" {
+		var err error
+		if auto, err = strconv.ParseBool(a); err != nil {
+			return httpware.NewErr("invalid 'auto' query parameter", http.StatusBadRequest).WithField("invalid", err.Error())
+		}
+	}
+
+	// Grab the trip details from the http body.
+	trip := trips.NewTrip()
+	rqt := contentware.RequestTypeFromCtx(ctx)
+	if err := rqt.Decode(req.Body, trip); err != nil {
+		return httpware.NewErr("unable to parse body: "+err.Error(), http.StatusBadRequest)
+	}
+	if err := h.trips.Validate(trip); err != nil {
+		return httpware.NewErr("invalid trip", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	trip.User = userId
+
+	var tripVisits []visits.Visit
+	var err error
+	if auto {
+		tripVisits, err = h.visits.GetVisitsBetween(userId, trip.Start, trip.End)
+	} else {
+		tripVisits, err = h.userVisits(userId, trip.Visits)
+	}
+	if err != nil {
+		return err
+	}
+	trip.Visits = make([]string, len(tripVisits))
+	for i, v := range tripVisits {
+		trip.Visits[i] = v.ID
+	}
+
+	// A visit belongs to at most one trip.
+	if err := h.trips.RemoveVisits(trip.Visits...); err != nil {
+		return httpware.NewErr("unable to remove visits from trips", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+	if err := h.trips.Add(trip); err != nil {
+		return httpware.NewErr("unable to save user trip", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+	if err := h.visits.SetTrip(h.actor(req), trip.Visits, trip.ID); err != nil {
+		return httpware.NewErr("unable to add visits to trip", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+
+	rst := contentware.ResponseTypeFromCtx(ctx)
+	rst.Encode(res, trip)
+	return nil
+}
+
+// GetTrips serves a list of trips for a given user.
+func (h *Handler) GetTrips(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+	page := pageware.PageFromCtx(ctx)
+
+	if _, err := h.viewer(req, userId); err != nil {
+		return err
+	}
+	dbTrips, err := h.trips.GetTrips(userId, page.Start, page.Limit)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Trips []trips.Trip `json:"trips" xml:"trips"`
+	}{dbTrips})
+	return nil
+}
+
+// GetTrip serves a single trip for a given user. The ids of private visits
+// are only shown to the user.
+func (h *Handler) GetTrip(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	public, err := h.viewer(req, ps.ByName("user"))
+	if err != nil {
+		return err
+	}
+	trip, err := h.userTrip(ctx)
+	if err != nil {
+		return err
+	}
+	if public {
+		dbVisits, err := h.visits.GetVisitsByIDs(trip.Visits)
+		if err != nil {
+			return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		trip.Visits = make([]string, 0, len(dbVisits))
+		for _, v := range dbVisits {
+			if !v.Private {
+				trip.Visits = append(trip.Visits, v.ID)
+			}
+		}
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, trip)
+	return nil
+}
+
+// DeleteTrip removes a given user's trip. The trip's visits are kept.
+func (h *Handler) DeleteTrip(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	trip, err := h.ownTrip(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if err := h.visits.SetTrip(h.actor(req), trip.Visits, ""); err != nil {
+		return httpware.NewErr("unable to remove visits from trip", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+	if err := h.trips.Delete(trip.ID); err != nil {
+		return h.undoSetTrip(req, map[string][]string{trip.ID: trip.Visits},
+			httpware.NewErr("unable to delete user trip", http.StatusInternalServerError).WithField("error", err.Error()))
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// GetTripVisits serves the ordered list of visits which make up a trip.
+func (h *Handler) GetTripVisits(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	public, err := h.viewer(req, ps.ByName("user"))
+	if err != nil {
+		return err
+	}
+	trip, err := h.userTrip(ctx)
+	if err != nil {
+		return err
+	}
+
+	dbVisits, err := h.visits.GetVisitsByIDs(trip.Visits)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	if public {
+		shown := make([]visits.Visit, 0, len(dbVisits))
+		for _, v := range dbVisits {
+			if !v.Private {
+				shown = append(shown, v)
+			}
+		}
+		dbVisits = shown
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Visits []visits.Visit `json:"visits" xml:"visits"`
+	}{dbVisits})
+	return nil
+}
+
+// PostTripVisits appends existing visits to the end of a trip.
+func (h *Handler) PostTripVisits(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	trip, err := h.ownTrip(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	body := &struct {
+		Visits []string `json:"visits" xml:"visits"`
+	}{}
+	rqt := contentware.RequestTypeFromCtx(ctx)
+	if err := rqt.Decode(req.Body, body); err != nil {
+		return httpware.NewErr("unable to parse body: "+err.Error(), http.StatusBadRequest)
+	}
+	if len(body.Visits) == 0 {
+		return httpware.NewErr("invalid trip visits", http.StatusBadRequest).WithField("invalid", "missing 'visits' field")
+	}
+	dbVisits, err := h.userVisits(trip.User, body.Visits)
+	if err != nil {
+		return err
+	}
+
+	// The visits are moved first, & moved back when the trips can not be
+	// changed, so that trips & visits agree.
+	before := make(map[string][]string)
+	for _, v := range dbVisits {
+		before[v.TripID] = append(before[v.TripID], v.ID)
+	}
+	if err := h.visits.SetTrip(h.actor(req), body.Visits, trip.ID); err != nil {
+		return httpware.NewErr("unable to add visits to trip", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+	if err := h.trips.RemoveVisits(body.Visits...); err != nil {
+		return h.undoSetTrip(req, before,
+			httpware.NewErr("unable to remove visits from trips", http.StatusInternalServerError).WithField("error", err.Error()))
+	}
+	if err := h.trips.AppendVisits(trip.ID, body.Visits...); err != nil {
+		return h.undoSetTrip(req, before, httpware.NewErr(err.Error(), http.StatusInternalServerError))
+	}
+
+	trip, err = h.trips.Get(trip.ID)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, trip)
+	return nil
+}
+
+// DeleteTripVisit removes a visit from a trip. The visit itself is kept.
+func (h *Handler) DeleteTripVisit(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	trip, err := h.ownTrip(ctx, req)
+	if err != nil {
+		return err
+	}
+	ps := routeradapt.ParamsFromCtx(ctx)
+	visitId := ps.ByName("visit")
+
+	found := false
+	for _, id := range trip.Visits {
+		if id == visitId {
+			found = true
+		}
+	}
+	if !found {
+		return httpware.NewErr("no such visit in trip", http.StatusNotFound)
+	}
+
+	if err := h.visits.SetTrip(h.actor(req), []string{visitId}, ""); err != nil {
+		return httpware.NewErr("unable to remove visit from trip", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+	if err := h.trips.RemoveVisits(visitId); err != nil {
+		return h.undoSetTrip(req, map[string][]string{trip.ID: {visitId}},
+			httpware.NewErr("unable to remove visit from trip", http.StatusInternalServerError).WithField("error", err.Error()))
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// undoSetTrip puts visits back in the trips they were in (keyed by trip id,
+// "" for none) after a trip could not be changed to match them, & returns
+// the error of the failed change.
+func (h *Handler) undoSetTrip(req *http.Request, before map[string][]string, failed error) error {
+	for tripId, visitIds := range before {
+		if err := h.visits.SetTrip(h.actor(req), visitIds, tripId); err != nil {
+			h.logger.WithField("error", err.Error()).WithField("trip", tripId).Error("unable to undo a change of visit trips")
+		}
+	}
+	return failed
+}
+
+// userTrip looks up the trip referenced by the ":trip" url parameter and
+// ensures it belongs to the ":user" url parameter.
+func (h *Handler) userTrip(ctx context.Context) (*trips.Trip, error) {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	trip, err := h.trips.Get(ps.ByName("trip"))
+	if err == trips.ErrNotFound {
+		return nil, httpware.NewErr("no such trip", http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	if trip.User != ps.ByName("user") {
+		return nil, httpware.NewErr("no such trip", http.StatusNotFound)
+	}
+	return trip, nil
+}
+
+// ownTrip looks up the trip referenced by the url (see userTrip) and ensures
+// that the caller is its user, who alone may change it.
+func (h *Handler) ownTrip(ctx context.Context, req *http.Request) (*trips.Trip, error) {
+	if h.caller(req) != routeradapt.ParamsFromCtx(ctx).ByName("user") {
+		return nil, httpware.NewErr("only a user may change their trips", http.StatusForbidden)
+	}
+	return h.userTrip(ctx)
+}
+
+// userVisits looks up the given visits and ensures they all exist and belong
+// to the given user.
+func (h *Handler) userVisits(userId string, visitIds []string) ([]visits.Visit, error) {
+	dbVisits, err := h.visits.GetVisitsByIDs(visitIds)
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	if len(dbVisits) != len(visitIds) {
+		return nil, httpware.NewErr("invalid trip visits", http.StatusBadRequest).WithField("invalid", "no such visit")
+	}
+	for _, v := range dbVisits {
+		if v.User != userId {
+			return nil, httpware.NewErr("invalid trip visits", http.StatusBadRequest).WithField("invalid", "no such visit")
+		}
+	}
+	return dbVisits, nil
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/nstogner/beenthere-ws/summaries"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/pageware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// entry is a single ranked user on a leaderboard.
+type entry struct {
+	Rank        int    `json:"rank" xml:"rank"`
+	User        string `json:"user" xml:"user"`
+	DisplayName string `json:"display_name" xml:"display_name"`
+	Score       int    `json:"score" xml:"score"`
+}
+
+// GetLeaderboard serves a page of users ranked by distinct states or cities
+// visited, or by visits this month. The "scope" query parameter may be set
+// to "followers" to only rank the caller & the users they follow.
+func (h *Handler) GetLeaderboard(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	board := ps.ByName("board")
+	page := pageware.PageFromCtx(ctx)
+	caller := h.caller(req)
+
+	switch board {
+	case summaries.BoardStates, summaries.BoardCities, summaries.BoardMonth:
+	default:
+		return httpware.NewErr("no such leaderboard", http.StatusNotFound)
+	}
+
+	var entries []entry
+	var err error
+	switch scope := req.URL.Query().Get("scope"); scope {
+	case "", "global":
+		entries, err = h.globalLeaderboard(board, page.Start, page.Limit)
+	case "followers":
+		if caller == "" {
+			return httpware.NewErr("followers leaderboards require an authenticated caller", http.StatusForbidden)
+		}
+		entries, err = h.followersLeaderboard(board, caller, page.Start, page.Limit)
+	default:
+		return httpware.NewErr("invalid 'scope' query parameter", http.StatusBadRequest).WithField("invalid", "must be 'global' or 'followers'")
+	}
+	if err != nil {
+		return err
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Board   string  `json:"board" xml:"board"`
+		Entries []entry `json:"entries" xml:"entries"`
+	}{board, entries})
+	return nil
+}
+
+// globalLeaderboard reads a page of a leaderboard's index, which only ranks
+// users with public profiles who have not opted out (see
+// summaries.Summary.Listed).
+func (h *Handler) globalLeaderboard(board string, start, limit int) ([]entry, error) {
+	summs, err := h.summaries.Top(board, start, limit)
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	entries := make([]entry, len(summs))
+	for i := range summs {
+		entries[i] = entry{
+			Rank:        start + i + 1,
+			User:        summs[i].User,
+			DisplayName: summs[i].DisplayName,
+			Score:       summs[i].Score(board),
+		}
+	}
+	return entries, nil
+}
+
+// followersLeaderboard ranks the caller & the users they follow. These are
+// few enough to be ranked in memory.
+func (h *Handler) followersLeaderboard(board, caller string, start, limit int) ([]entry, error) {
+	users, err := h.social.FollowingIDs(caller)
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	summs, err := h.summaries.GetMany(append(users, caller))
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	all := make([]entry, 0, len(summs))
+	for i := range summs {
+		e, err := h.leaderboardEntry(caller, board, &summs[i])
+		if err != nil {
+			return nil, err
+		}
+		if e != nil && e.Score > 0 {
+			all = append(all, *e)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Score != all[j].Score {
+			return all[i].Score > all[j].Score
+		}
+		return all[i].User < all[j].User
+	})
+
+	entries := make([]entry, 0)
+	for i := start; i < len(all) && i < start+limit; i++ {
+		all[i].Rank = i + 1
+		entries = append(entries, all[i])
+	}
+	return entries, nil
+}
+
+// leaderboardEntry returns a summary's leaderboard entry, or nil when the
+// user has opted out of leaderboards or the caller may not view them.
+func (h *Handler) leaderboardEntry(caller, board string, s *summaries.Summary) (*entry, error) {
+	p, err := h.profiles.Get(s.User)
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	if p.LeaderboardOptOut {
+		return nil, nil
+	}
+	ok, err := h.canView(caller, p)
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &entry{
+		User:        s.User,
+		DisplayName: p.DisplayName,
+		Score:       s.Score(board),
+	}, nil
+}
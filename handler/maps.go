@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nstogner/beenthere-ws/summaries"
+	"github.com/nstogner/beenthere-ws/usmap"
+	"github.com/nstogner/httpware"
+	"golang.org/x/net/context"
+)
+
+// mapCacheSize is the total size of rendered images which are kept in memory.
+const mapCacheSize = 32 << 20
+
+// GetMapSVG serves a US map with the states visited by a given user filled
+// in. Colors, size & legend are controlled via query parameters. Responses
+// are tagged by the user's state set & the options so clients can cache them.
+func (h *Handler) GetMapSVG(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	opts, err := mapOptions(req.URL.Query(), usmap.DefaultOptions)
+	if err != nil {
+		return httpware.NewErr("invalid map options", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	a, err := h.readAccess(ctx, req)
+	if err != nil {
+		return err
+	}
+	m, err := h.visitedMap(a)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	etag := mapETag("svg", m, opts)
+	res.Header().Set("ETag", etag)
+	res.Header().Set("Cache-Control", "no-cache")
+	if req.Header.Get("If-None-Match") == etag {
+		res.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := usmap.RenderSVG(&buf, m, opts); err != nil {
+		return httpware.NewErr("unable to render map", http.StatusInternalServerError).WithField("error", err.Error())
+	}
+	res.Header().Set("Content-Type", "image/svg+xml")
+	res.Write(buf.Bytes())
+	return nil
+}
+
+// GetMapPNG serves the same map as GetMapSVG as a PNG, suitable for link
+// previews (ie: og:image) where SVG is not supported. Rendered images are
+// cached by ETag since rasterizing is comparatively expensive.
+func (h *Handler) GetMapPNG(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	opts, err := mapOptions(req.URL.Query(), usmap.DefaultPNGOptions)
+	if err == nil {
+		err = opts.ValidateRaster()
+	}
+	if err != nil {
+		return httpware.NewErr("invalid map options", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	a, err := h.readAccess(ctx, req)
+	if err != nil {
+		return err
+	}
+	m, err := h.visitedMap(a)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	etag := mapETag("png", m, opts)
+	res.Header().Set("ETag", etag)
+	res.Header().Set("Cache-Control", "no-cache")
+	if req.Header.Get("If-None-Match") == etag {
+		res.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	img, ok := h.maps.get(etag)
+	if !ok {
+		var buf bytes.Buffer
+		if err := usmap.RenderPNG(&buf, m, opts); err != nil {
+			return httpware.NewErr("unable to render map", http.StatusInternalServerError).WithField("error", err.Error())
+		}
+		img = buf.Bytes()
+		h.maps.put(etag, img)
+	}
+	res.Header().Set("Content-Type", "image/png")
+	res.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	res.Write(img)
+	return nil
+}
+
+// visitedMap builds the map of states & cities visited by a given user.
+// Cities without a known location are not drawn, nor are any cities when the
+// access does not include them.
+func (h *Handler) visitedMap(a *access) (*usmap.Map, error) {
+	states, err := h.service.StatesVisited(a.user, a.public)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(states)
+	names := make(map[string]string)
+	for _, st := range usmap.States() {
+		names[st] = h.locations.StateName(st)
+	}
+
+	m := &usmap.Map{
+		Visited: states,
+		Names:   names,
+		Cities:  make([]usmap.City, 0),
+	}
+	if !a.cities {
+		return m, nil
+	}
+	ids, err := h.citiesVisited(a.user, a.public)
+	if err != nil {
+		return nil, err
+	}
+	cities, err := h.locations.GetCities(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, ct := range cities {
+		if ct.Location.Lon == 0 && ct.Location.Lat == 0 {
+			continue
+		}
+		m.Cities = append(m.Cities, usmap.City{
+			Name:  ct.Name,
+			State: ct.State,
+			Lon:   ct.Location.Lon,
+			Lat:   ct.Location.Lat,
+		})
+	}
+	sort.Slice(m.Cities, func(i, j int) bool {
+		return m.Cities[i].State+m.Cities[i].Name < m.Cities[j].State+m.Cities[j].Name
+	})
+	return m, nil
+}
+
+// citiesVisited returns the ids ("City,ST") of every city visited by a given
+// user, leaving out private visits when public is true.
+func (h *Handler) citiesVisited(userId string, public bool) ([]string, error) {
+	var counts map[string]int
+	summary, err := h.summaries.Get(userId)
+	switch {
+	case err == summaries.ErrNotFound || (err == nil && public && summary.Private > 0):
+		totals, err := h.visits.GetTotals(userId, public)
+		if err != nil {
+			return nil, err
+		}
+		counts = totals.Cities
+	case err != nil:
+		return nil, err
+	default:
+		counts = summary.Cities
+	}
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// mapOptions parses map rendering options from query parameters, falling
+// back to the given defaults.
+func mapOptions(query url.Values, defaults usmap.Options) (usmap.Options, error) {
+	opts := defaults
+	var err error
+	if w := query.Get("width"); w != "" {
+		if opts.Width, err = strconv.Atoi(w); err != nil {
+			return opts, fmt.Errorf("'width' must be an integer")
+		}
+	}
+	if ht := query.Get("height"); ht != "" {
+		if opts.Height, err = strconv.Atoi(ht); err != nil {
+			return opts, fmt.Errorf("'height' must be an integer")
+		}
+	}
+	if l := query.Get("legend"); l != "" {
+		if opts.Legend, err = strconv.ParseBool(l); err != nil {
+			return opts, fmt.Errorf("'legend' must be a boolean")
+		}
+	}
+	for name, field := range map[string]*string{
+		"visited":    &opts.Visited,
+		"unvisited":  &opts.Unvisited,
+		"stroke":     &opts.Stroke,
+		"cities":     &opts.Cities,
+		"background": &opts.Background,
+	} {
+		if c := query.Get(name); c != "" {
+			*field = c
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// mapETag identifies a rendered map by its format, visited states & cities
+// and options.
+func mapETag(format string, m *usmap.Map, opts usmap.Options) string {
+	cities := make([]string, len(m.Cities))
+	for i, ct := range m.Cities {
+		cities[i] = fmt.Sprintf("%s,%s@%v,%v", ct.Name, ct.State, ct.Lon, ct.Lat)
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%v|%s|%+v", format, m.Visited, strings.Join(cities, ";"), opts)))
+	return fmt.Sprintf(`"%x"`, sum)
+}
+
+// mapCache holds rendered images by ETag. Once the total size exceeds the
+// limit the oldest images are evicted.
+type mapCache struct {
+	sync.Mutex
+	limit  int
+	size   int
+	images map[string][]byte
+	order  []string
+}
+
+func newMapCache(limit int) *mapCache {
+	return &mapCache{
+		limit:  limit,
+		images: make(map[string][]byte),
+	}
+}
+
+func (c *mapCache) get(key string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+	img, ok := c.images[key]
+	return img, ok
+}
+
+func (c *mapCache) put(key string, img []byte) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.images[key]; ok || len(img) > c.limit {
+		return
+	}
+	for c.size+len(img) > c.limit {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.size -= len(c.images[oldest])
+		delete(c.images, oldest)
+	}
+	c.images[key] = img
+	c.order = append(c.order, key)
+	c.size += len(img)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// Route is a method & path registered with the router. Paths use the
+// router's syntax (ie: "/users/:user/visits"), custom methods included (ie:
+// "/users/:user/visits:dedupe").
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Routes returns every registered route, so that they can be checked against
+// the api spec.
+func (h *Handler) Routes() []Route {
+	return h.routes
+}
+
+// recorder registers routes with a router while recording them in a list.
+type recorder struct {
+	*httprouter.Router
+	routes *[]Route
+}
+
+func (rr *recorder) Handle(method, path string, handle httprouter.Handle) {
+	*rr.routes = append(*rr.routes, Route{Method: method, Path: path})
+	rr.Router.Handle(method, path, handle)
+}
+
+func (rr *recorder) GET(path string, handle httprouter.Handle) {
+	rr.Handle("GET", path, handle)
+}
+
+func (rr *recorder) POST(path string, handle httprouter.Handle) {
+	rr.Handle("POST", path, handle)
+}
+
+func (rr *recorder) PUT(path string, handle httprouter.Handle) {
+	rr.Handle("PUT", path, handle)
+}
+
+func (rr *recorder) DELETE(path string, handle httprouter.Handle) {
+	rr.Handle("DELETE", path, handle)
+}
+
+// GetOpenAPI serves the api spec as it was loaded.
+func (h *Handler) GetOpenAPI(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	if h.spec == nil {
+		return httpware.NewErr("no api spec is configured", http.StatusNotFound)
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(h.spec.Raw)
+	return nil
+}
+
+// serveValidated validates a request against the api spec before routing it.
+// Responses are also validated when configured (ie: while testing), in which
+// case a response which does not match the spec is replaced by an error.
+// Requests which the spec does not describe are routed as is.
+func (h *Handler) serveValidated(res http.ResponseWriter, req *http.Request) {
+	op, params := h.spec.Find(req.Method, req.URL.Path)
+	if op == nil {
+		h.route(res, req)
+		return
+	}
+	if err := op.ValidateRequest(req, params); err != nil {
+		h.fail(res, req, httpware.NewErr("request does not match the api spec", http.StatusBadRequest).WithField("invalid", err.Error()))
+		return
+	}
+	if !h.validateResponses || op.Streams() {
+		h.route(res, req)
+		return
+	}
+
+	buf := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+	h.route(buf, req)
+	if err := op.ValidateResponse(buf.status, buf.header, buf.body.Bytes()); err != nil {
+		h.logger.WithField("error", err.Error()).WithField("path", req.URL.Path).Error("response does not match the api spec")
+		h.fail(res, req, httpware.NewErr("response does not match the api spec", http.StatusInternalServerError).WithField("invalid", err.Error()))
+		return
+	}
+	for k, v := range buf.header {
+		res.Header()[k] = v
+	}
+	res.WriteHeader(buf.status)
+	res.Write(buf.body.Bytes())
+}
+
+// fail responds with an error, rendered like the errors of every route.
+func (h *Handler) fail(res http.ResponseWriter, req *http.Request, err error) {
+	routeradapt.Adapt(h.middleware.ThenFunc(func(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+		return err
+	}))(res, req, nil)
+}
+
+// bufferedResponse holds a response so that it can be validated before it
+// is sent.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/service"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// GetProfile serves a given user's profile.
+func (h *Handler) GetProfile(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if _, err := h.viewer(req, userId); err != nil {
+		return err
+	}
+	p, err := h.profiles.Get(userId)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, p)
+	return nil
+}
+
+// PutProfile saves a given user's profile. Only the user may change their
+// own profile.
+func (h *Handler) PutProfile(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may change their profile", http.StatusForbidden)
+	}
+
+	p := &profiles.Profile{}
+	rqt := contentware.RequestTypeFromCtx(ctx)
+	if err := rqt.Decode(req.Body, p); err != nil {
+		return httpware.NewErr("unable to parse body: "+err.Error(), http.StatusBadRequest)
+	}
+	if err := h.profiles.Validate(p); err != nil {
+		return httpware.NewErr("invalid profile", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	p.User = userId
+	if p.DisplayName == "" {
+		p.DisplayName = userId
+	}
+
+	// Follows made while the profile was public were never approved, so
+	// they must be before the profile stops being public.
+	prev, err := h.profiles.Get(userId)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	if prev.Visibility == profiles.VisibilityPublic && p.Visibility != profiles.VisibilityPublic {
+		if err := h.social.RequireApproval(userId); err != nil {
+			return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+	}
+	if err := h.profiles.Put(p); err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	// Leaderboards read the profile from the user's summary.
+	if err := h.summaries.Rebuild(userId); err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, p)
+	return nil
+}
+
+// caller returns the user making a request as identified by the configured
+// auth header, which is expected to be set by an authenticating proxy. An
+// empty string is returned for unauthenticated requests.
+func (h *Handler) caller(req *http.Request) string {
+	return req.Header.Get(h.authHeader)
+}
+
+// viewer checks that the caller may read a given user's visits (see
+// service.Service.Viewer). The returned bool is true when the caller is not
+// the user, in which case private visits must be hidden.
+func (h *Handler) viewer(req *http.Request, userId string) (bool, error) {
+	public, err := h.service.Viewer(h.caller(req), userId)
+	if err != nil {
+		return public, apiErr(err)
+	}
+	return public, nil
+}
+
+// canView reports whether the caller may read the visits of the profile's
+// user.
+func (h *Handler) canView(caller string, p *profiles.Profile) (bool, error) {
+	return h.service.CanView(caller, p)
+}
+
+// apiErr maps errors from the service layer to http errors.
+func apiErr(err error) error {
+	e, ok := err.(*service.Error)
+	if !ok {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	status := http.StatusInternalServerError
+	switch e.Kind {
+	case service.KindInvalid:
+		status = http.StatusBadRequest
+	case service.KindForbidden:
+		status = http.StatusForbidden
+	case service.KindNotFound:
+		status = http.StatusNotFound
+	}
+	if e.Reason != "" {
+		return httpware.NewErr(e.Msg, status).WithField("invalid", e.Reason)
+	}
+	return httpware.NewErr(e.Msg, status)
+}
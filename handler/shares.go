@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/shares"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// defaultShareLifetime is used for shares created without an expiry.
+const defaultShareLifetime = 7 * 24 * time.Hour
+
+// access describes whose visits a request reads & how much of them.
+type access struct {
+	user string
+	// public hides private visits.
+	public bool
+	// cities includes visited cities on maps.
+	cities bool
+}
+
+type accessKey struct{}
+
+// readAccess returns what a request may read. Shared routes carry the access
+// granted by their share, otherwise the ":user" url parameter is read as the
+// caller (see viewer).
+func (h *Handler) readAccess(ctx context.Context, req *http.Request) (*access, error) {
+	if a, ok := ctx.Value(accessKey{}).(*access); ok {
+		return a, nil
+	}
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+	public, err := h.viewer(req, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &access{user: userId, public: public, cities: true}, nil
+}
+
+// shared serves a read-only route on behalf of the user who created the
+// share referenced by the ":token" url parameter. The share must include the
+// given scope. Private visits are never shared.
+func (h *Handler) shared(scope string, hf httpware.HandlerFunc) httpware.HandlerFunc {
+	return func(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+		s, err := h.share(ctx)
+		if err != nil {
+			return err
+		}
+		if !s.Allows(scope) {
+			return httpware.NewErr("share does not include "+scope, http.StatusForbidden)
+		}
+		ctx = context.WithValue(ctx, accessKey{}, &access{
+			user:   s.User,
+			public: true,
+			cities: s.Allows(shares.ScopeCities),
+		})
+		return hf(ctx, res, req)
+	}
+}
+
+// share verifies the token referenced by the ":token" url parameter.
+func (h *Handler) share(ctx context.Context) (*shares.Share, error) {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	s, err := h.shares.Verify(ps.ByName("token"))
+	switch {
+	case err == shares.ErrNotFound:
+		return nil, httpware.NewErr("no such share", http.StatusNotFound)
+	case err == shares.ErrExpired:
+		return nil, httpware.NewErr("share has expired", http.StatusGone)
+	case err != nil:
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	return s, nil
+}
+
+// GetShare serves the details of the share referenced by a token.
+func (h *Handler) GetShare(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	s, err := h.share(ctx)
+	if err != nil {
+		return err
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, s)
+	return nil
+}
+
+// PostShare creates a share of a user's visits. Only the user may share
+// their own visits.
+func (h *Handler) PostShare(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may share their visits", http.StatusForbidden)
+	}
+
+	s := &shares.Share{}
+	rqt := contentware.RequestTypeFromCtx(ctx)
+	if err := rqt.Decode(req.Body, s); err != nil {
+		return httpware.NewErr("unable to parse body: "+err.Error(), http.StatusBadRequest)
+	}
+	if s.Expires.IsZero() {
+		s.Expires = time.Now().Add(defaultShareLifetime)
+	}
+	if err := h.shares.Validate(s); err != nil {
+		return httpware.NewErr("invalid share", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	s.User = userId
+
+	if err := h.shares.Add(s); err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, s)
+	return nil
+}
+
+// GetShares serves a user's active shares. Only the user may list their
+// shares since they include the tokens.
+func (h *Handler) GetShares(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may list their shares", http.StatusForbidden)
+	}
+	dbShares, err := h.shares.GetActive(userId)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Shares []shares.Share `json:"shares" xml:"shares"`
+	}{dbShares})
+	return nil
+}
+
+// DeleteShare revokes one of a user's shares.
+func (h *Handler) DeleteShare(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may revoke their shares", http.StatusForbidden)
+	}
+	err := h.shares.Revoke(userId, ps.ByName("share"))
+	if err == shares.ErrNotFound {
+		return httpware.NewErr("no such share", http.StatusNotFound)
+	}
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/social"
+	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/pageware"
+	"github.com/nstogner/httpware/routeradapt"
+	"github.com/nstogner/httpware/streamware"
+	"golang.org/x/net/context"
+)
+
+// PutFollowing makes a user follow another user. Only the user may change
+// who they follow. Follows of users whose profile is not public are pending
+// until the followee approves them (see PutFollower).
+func (h *Handler) PutFollowing(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+	followee := ps.ByName("followee")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may change who they follow", http.StatusForbidden)
+	}
+	p, err := h.profiles.Get(followee)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	f, err := h.social.Follow(userId, followee, p.Visibility == profiles.VisibilityPublic)
+	if err == social.ErrSelfFollow {
+		return httpware.NewErr("invalid follow", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, f)
+	return nil
+}
+
+// DeleteFollowing makes a user stop following another user.
+func (h *Handler) DeleteFollowing(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may change who they follow", http.StatusForbidden)
+	}
+	if err := h.social.Unfollow(userId, ps.ByName("followee")); err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// PutFollower approves a pending follow of a user. Only the user may approve
+// their followers.
+func (h *Handler) PutFollower(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may approve their followers", http.StatusForbidden)
+	}
+	f, err := h.social.Approve(userId, ps.ByName("follower"))
+	if err == social.ErrNotFound {
+		return httpware.NewErr("no such follower", http.StatusNotFound)
+	}
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, f)
+	return nil
+}
+
+// DeleteFollower removes a user's follower, or rejects a pending follow.
+func (h *Handler) DeleteFollower(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may remove their followers", http.StatusForbidden)
+	}
+	if err := h.social.Unfollow(ps.ByName("follower"), userId); err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// followStatus reads the "status" query parameter of the follow lists, which
+// defaults to accepted follows. Pending follows are only listed to the user.
+func (h *Handler) followStatus(req *http.Request, userId string) (string, error) {
+	switch st := req.URL.Query().Get("status"); st {
+	case "", social.StatusAccepted:
+		return social.StatusAccepted, nil
+	case social.StatusPending:
+		if h.caller(req) != userId {
+			return "", httpware.NewErr("only a user may list their pending follows", http.StatusForbidden)
+		}
+		return st, nil
+	default:
+		return "", httpware.NewErr("invalid 'status' query parameter", http.StatusBadRequest).WithField("invalid", "must be one of: accepted, pending")
+	}
+}
+
+// GetFollowers serves a list of the users following a given user.
+func (h *Handler) GetFollowers(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+	page := pageware.PageFromCtx(ctx)
+
+	if _, err := h.viewer(req, userId); err != nil {
+		return err
+	}
+	status, err := h.followStatus(req, userId)
+	if err != nil {
+		return err
+	}
+	follows, err := h.social.GetFollowers(userId, status, page.Start, page.Limit)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Followers []social.Follow `json:"followers" xml:"followers"`
+	}{follows})
+	return nil
+}
+
+// GetFollowing serves a list of the users followed by a given user.
+func (h *Handler) GetFollowing(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+	page := pageware.PageFromCtx(ctx)
+
+	if _, err := h.viewer(req, userId); err != nil {
+		return err
+	}
+	status, err := h.followStatus(req, userId)
+	if err != nil {
+		return err
+	}
+	follows, err := h.social.GetFollowing(userId, status, page.Start, page.Limit)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Following []social.Follow `json:"following" xml:"following"`
+	}{follows})
+	return nil
+}
+
+// GetFeed serves the most recent visits of everyone a given user follows.
+// Feeds are personal, so only the user may read their own.
+func (h *Handler) GetFeed(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+	page := pageware.PageFromCtx(ctx)
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may read their feed", http.StatusForbidden)
+	}
+	followees, err := h.feedUsers(userId)
+	if err != nil {
+		return err
+	}
+	dbVisits, err := h.visits.GetFeed(followees, page.Start, page.Limit)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Visits []visits.Visit `json:"visits" xml:"visits"`
+	}{dbVisits})
+	return nil
+}
+
+// StreamFeed opens a connection for sending the live visits of everyone a
+// given user follows via Server Sent Events (SSE).
+func (h *Handler) StreamFeed(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+
+	if h.caller(req) != userId {
+		return httpware.NewErr("only a user may read their feed", http.StatusForbidden)
+	}
+	sender := streamware.SenderFromCtx(ctx)
+	stream, err := h.visits.Stream()
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	visit := &visits.Visit{}
+	for stream.Next(visit) {
+		// Follows may change while streaming, so they are checked per visit.
+		following, err := h.social.IsFollowing(userId, visit.User)
+		if err != nil {
+			return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		if following && !visit.Private {
+			p, err := h.profiles.Get(visit.User)
+			if err != nil {
+				return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+			}
+			ok, err := h.canView(userId, p)
+			if err != nil {
+				return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+			}
+			if ok {
+				js, err := json.Marshal(visit)
+				if err != nil {
+					return httpware.NewErr("unable to marshal visit into json: "+err.Error(), http.StatusInternalServerError)
+				}
+				sender.Send(string(js))
+			}
+		}
+		visit = &visits.Visit{}
+	}
+	return nil
+}
+
+// feedUsers returns the users followed by a given user whose visits the user
+// may view.
+func (h *Handler) feedUsers(userId string) ([]string, error) {
+	followees, err := h.social.FollowingIDs(userId)
+	if err != nil {
+		return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	visible := make([]string, 0, len(followees))
+	for _, f := range followees {
+		p, err := h.profiles.Get(f)
+		if err != nil {
+			return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		ok, err := h.canView(userId, p)
+		if err != nil {
+			return nil, httpware.NewErr(err.Error(), http.StatusInternalServerError)
+		}
+		if ok {
+			visible = append(visible, f)
+		}
+	}
+	return visible, nil
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/pageware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// GetTrash serves a user's deleted visits, most recently deleted first.
+func (h *Handler) GetTrash(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	userId := ps.ByName("user")
+	page := pageware.PageFromCtx(ctx)
+
+	deleted, err := h.service.Trash(h.caller(req), userId, page.Start, page.Limit)
+	if err != nil {
+		return apiErr(err)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Visits []visits.Visit `json:"visits" xml:"visits"`
+	}{deleted})
+	return nil
+}
+
+// RestoreVisit undoes the delete of one of a user's visits.
+func (h *Handler) RestoreVisit(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+
+	visit, err := h.service.RestoreVisit(h.actor(req), ps.ByName("user"), ps.ByName("visit"))
+	if err != nil {
+		return apiErr(err)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, visit)
+	return nil
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nstogner/beenthere-ws/webhooks"
+	"github.com/nstogner/httpware"
+	"github.com/nstogner/httpware/contentware"
+	"github.com/nstogner/httpware/pageware"
+	"github.com/nstogner/httpware/routeradapt"
+	"golang.org/x/net/context"
+)
+
+// PostWebhook subscribes a URL to visit events on behalf of the caller. The
+// response includes the secret used to sign deliveries, which is not shown
+// again.
+func (h *Handler) PostWebhook(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	caller := h.caller(req)
+	if caller == "" {
+		return httpware.NewErr("webhooks require an authenticated caller", http.StatusForbidden)
+	}
+
+	w := &webhooks.Webhook{}
+	rqt := contentware.RequestTypeFromCtx(ctx)
+	if err := rqt.Decode(req.Body, w); err != nil {
+		return httpware.NewErr("unable to parse body: "+err.Error(), http.StatusBadRequest)
+	}
+	if err := h.webhooks.Validate(w); err != nil {
+		return httpware.NewErr("invalid webhook", http.StatusBadRequest).WithField("invalid", err.Error())
+	}
+	w.Owner = caller
+
+	if err := h.webhooks.Add(w); err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, w)
+	return nil
+}
+
+// GetWebhooks serves the caller's webhooks.
+func (h *Handler) GetWebhooks(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	caller := h.caller(req)
+	if caller == "" {
+		return httpware.NewErr("webhooks require an authenticated caller", http.StatusForbidden)
+	}
+	hooks, err := h.webhooks.GetByOwner(caller)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Webhooks []webhooks.Webhook `json:"webhooks" xml:"webhooks"`
+	}{hooks})
+	return nil
+}
+
+// DeleteWebhook removes one of the caller's webhooks.
+func (h *Handler) DeleteWebhook(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+
+	err := h.webhooks.Delete(h.caller(req), ps.ByName("webhook"))
+	if err == webhooks.ErrNotFound {
+		return httpware.NewErr("no such webhook", http.StatusNotFound)
+	}
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// GetDeliveries serves the delivery log of one of the caller's webhooks, most
+// recent first. The "status" query parameter limits the log to "pending",
+// "delivered" or "dead" deliveries.
+func (h *Handler) GetDeliveries(ctx context.Context, res http.ResponseWriter, req *http.Request) error {
+	ps := routeradapt.ParamsFromCtx(ctx)
+	webhookId := ps.ByName("webhook")
+	page := pageware.PageFromCtx(ctx)
+
+	status := req.URL.Query().Get("status")
+	switch status {
+	case "", webhooks.StatusPending, webhooks.StatusDelivered, webhooks.StatusDead:
+	default:
+		return httpware.NewErr("invalid 'status' query parameter", http.StatusBadRequest).WithField("invalid", "must be one of: pending, delivered, dead")
+	}
+	_, err := h.webhooks.Get(h.caller(req), webhookId)
+	if err == webhooks.ErrNotFound {
+		return httpware.NewErr("no such webhook", http.StatusNotFound)
+	}
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+	dels, err := h.webhooks.GetDeliveries(webhookId, status, page.Start, page.Limit)
+	if err != nil {
+		return httpware.NewErr(err.Error(), http.StatusInternalServerError)
+	}
+
+	rsp := contentware.ResponseTypeFromCtx(ctx)
+	rsp.Encode(res, struct {
+		Deliveries []webhooks.Delivery `json:"deliveries" xml:"deliveries"`
+	}{dels})
+	return nil
+}
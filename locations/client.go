@@ -90,6 +90,44 @@ func (c *Client) GetCityNames(state string) ([]string, error) {
 	return cities, nil
 }
 
+// GetCities returns the cities with the given ids ("City,ST"). Unknown ids
+// are ignored.
+func (c *Client) GetCities(ids []string) ([]City, error) {
+	cities := make([]City, 0)
+	if len(ids) == 0 {
+		return cities, nil
+	}
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = id
+	}
+	result, err := r.Table(c.config.Table).GetAll(keys...).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cities: %s", err.Error())
+	}
+	var ct City
+	for result.Next(&ct) {
+		cities = append(cities, ct)
+		ct = City{}
+	}
+	return cities, nil
+}
+
+// StateCount returns the number of states (including DC) which are known in
+// the hardcoded map of in-memory states.
+func (c *Client) StateCount() int {
+	return len(states)
+}
+
+// Country returns the ISO 3166 code of the country which a state is in, or
+// an empty string for unknown states. Every known state is in the US.
+func (c *Client) Country(state string) string {
+	if c.StateName(state) == "" {
+		return ""
+	}
+	return "US"
+}
+
 // StateName returns the name of a US state if it exists in a hardcoded map
 // of in-memory states. The only argument is a 2-letter state abbreviation.
 // If the state does not exist, an empty string is returned.
@@ -1,17 +1,37 @@
 package main
 
 import (
+	"crypto/rand"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	r "github.com/dancannon/gorethink"
+	"github.com/nstogner/beenthere-ws/achievements"
+	"github.com/nstogner/beenthere-ws/backup"
+	"github.com/nstogner/beenthere-ws/grpcapi"
 	"github.com/nstogner/beenthere-ws/handler"
 	"github.com/nstogner/beenthere-ws/locations"
+	"github.com/nstogner/beenthere-ws/outbox"
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/service"
+	"github.com/nstogner/beenthere-ws/shares"
+	"github.com/nstogner/beenthere-ws/social"
+	"github.com/nstogner/beenthere-ws/summaries"
+	"github.com/nstogner/beenthere-ws/trips"
 	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/beenthere-ws/webhooks"
+	"google.golang.org/grpc"
 )
 
+// purgeInterval is the time between purges of the trash.
+const purgeInterval = time.Hour
+
 var log = logrus.New()
 var session *r.Session
 var config Config
@@ -20,7 +40,8 @@ func main() {
 	var err error
 
 	// Parse CLI flags.
-	shouldInitDB := flag.Bool("init-db", false, "create database schema")
+	shouldInitDB := flag.Bool("init-db", false, "create or migrate the database schema")
+	shouldRebuild := flag.Bool("rebuild-projections", false, "regenerate all user summaries & achievements from visits")
 	flag.Parse()
 
 	// Pull configuration from the environment.
@@ -38,29 +59,193 @@ func main() {
 		session.Close()
 	}()
 
-	// Decide on whether to start the server or setup the db.
-	if *shouldInitDB {
+	// Decide on whether to start the server, setup the db or run an admin
+	// subcommand.
+	switch cmd := flag.Arg(0); {
+	case cmd == "backup":
+		backupDB(flag.Args()[1:])
+	case cmd == "restore":
+		restoreDB(flag.Args()[1:])
+	case cmd != "":
+		log.WithField("command", cmd).Fatal("unknown command, expected backup or restore")
+	case *shouldInitDB:
 		initDB()
-	} else {
+	case *shouldRebuild:
+		rebuildProjections()
+	default:
 		runServer()
 	}
 }
 
 func runServer() {
+	// Callers are identified by AUTH_HEADER, which any client could set
+	// unless a proxy in front of the service overwrites it.
+	if !config.AuthProxyTrusted {
+		log.WithField("AUTH_HEADER", config.AuthHeader).Warn("any client may claim to be any user unless an authenticating proxy sets AUTH_HEADER & strips it from client requests, set AUTH_PROXY_TRUSTED=true once one does")
+	}
+	rules, err := loadRules(config.AchievementsFile)
+	if err != nil {
+		log.WithField("error", err.Error()).Fatal("unable to load achievement rules")
+	}
+	spec, err := loadSpec(config.OpenAPIFile)
+	if err != nil {
+		log.WithField("error", err.Error()).Fatal("unable to load api spec")
+	}
+
+	// Share tokens are signed with a configured secret. Without one, a random
+	// secret is used & shares stop working when the service restarts.
+	secret := []byte(config.ShareSecret)
+	if len(secret) == 0 {
+		log.Warn("no SHARE_SECRET configured, share links will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.WithField("error", err.Error()).Fatal("unable to generate share secret")
+		}
+	}
+
 	// Setup DB clients.
 	vc := visits.NewClient(visits.Config{
-		Table: config.VisitsTable,
+		Table:       config.VisitsTable,
+		DedupWindow: config.DedupWindow,
+		AuditTable:  config.AuditTable,
 	}, session)
 	lc := locations.NewClient(locations.Config{
 		Table: config.CitiesTable,
 	}, session)
+	tc := trips.NewClient(trips.Config{
+		Table: config.TripsTable,
+	}, session)
+	pc := profiles.NewClient(profiles.Config{
+		Table: config.ProfilesTable,
+	}, session)
+	sc := summaries.NewClient(summaries.Config{
+		Table:    config.SummsTable,
+		Visits:   vc,
+		Profiles: pc,
+	}, session)
+	fc := social.NewClient(social.Config{
+		Table: config.FollowsTable,
+	}, session)
+	shc := shares.NewClient(shares.Config{
+		Table:  config.SharesTable,
+		Secret: secret,
+	}, session)
+	ac := achievements.NewClient(achievements.Config{
+		Table:  config.AchievesTable,
+		Rules:  rules,
+		Visits: vc,
+	}, session)
+	wc := webhooks.NewClient(webhooks.Config{
+		Table:           config.WebhooksTable,
+		DeliveriesTable: config.DeliveriesTable,
+		Profiles:        pc,
+		Backoff:         config.WebhookBackoff,
+		AllowPrivate:    config.WebhookPrivate,
+	}, session)
 
-	// Setup HTTP handler.
-	hdlr := handler.New(handler.Config{
-		Logger:       log,
+	// Visit events are collected into the outbox & relayed to webhooks, user
+	// summaries, achievements & optionally a file. SSE streams tail the
+	// outbox through the hub.
+	hub := outbox.NewHub()
+	sinks := []outbox.Sink{wc, sc, ac}
+	if config.OutboxFile != "" {
+		fs, err := outbox.NewFileSink(config.OutboxFile)
+		if err != nil {
+			log.WithField("error", err.Error()).Fatal("unable to open outbox file")
+		}
+		defer fs.Close()
+		sinks = append(sinks, fs)
+	}
+	oc := outbox.NewClient(outbox.Config{
+		Table:      config.OutboxTable,
+		QueueTable: config.OutboxQueueTable,
+		Source:     vc,
+		Sinks:      sinks,
+	}, session)
+
+	svc := service.New(service.Config{
 		VisitsClient: vc,
 		LocsClient:   lc,
+		TripsClient:  tc,
+		SummsClient:  sc,
+		ProfsClient:  pc,
+		SocialClient: fc,
+		Admins:       config.Admins,
 	})
+
+	// Relay outbox events, stream them & deliver webhooks in the background.
+	go func() {
+		for {
+			err := oc.Run()
+			log.WithField("error", err.Error()).Error("outbox relay stopped, restarting...")
+			time.Sleep(time.Second)
+		}
+	}()
+	go func() {
+		for {
+			err := oc.Tail(hub)
+			log.WithField("error", err.Error()).Error("outbox tail stopped, restarting...")
+			time.Sleep(time.Second)
+		}
+	}()
+	go func() {
+		for {
+			err := wc.Deliver()
+			log.WithField("error", err.Error()).Error("webhook delivery stopped, restarting...")
+			time.Sleep(time.Second)
+		}
+	}()
+
+	// Purge visits which have been in the trash for longer than the
+	// retention in the background.
+	go func() {
+		for {
+			n, err := svc.PurgeVisits(config.TrashRetention)
+			if err != nil {
+				log.WithField("error", err.Error()).Error("unable to purge deleted visits")
+			} else if n > 0 {
+				log.WithField("visits", n).Info("purged deleted visits")
+			}
+			time.Sleep(purgeInterval)
+		}
+	}()
+
+	// Setup HTTP handler.
+	hdlr := handler.New(handler.Config{
+		Logger:         log,
+		VisitsClient:   vc,
+		LocsClient:     lc,
+		TripsClient:    tc,
+		SummsClient:    sc,
+		ProfsClient:    pc,
+		SocialClient:   fc,
+		SharesClient:   shc,
+		AchvsClient:    ac,
+		HooksClient:    wc,
+		OutboxClient:   oc,
+		EventHub:       hub,
+		AuthHeader:     config.AuthHeader,
+		Spec:           spec,
+		Admins:         config.Admins,
+		TrustedProxies: config.TrustedProxies,
+	})
+
+	// Serve the gRPC API on its own port.
+	gs := grpc.NewServer()
+	grpcapi.NewServer(grpcapi.Config{
+		Service:    svc,
+		Events:     hub,
+		AuthHeader: config.AuthHeader,
+	}).Register(gs)
+	lis, err := net.Listen("tcp", ":"+config.GRPCPort)
+	if err != nil {
+		log.WithField("error", err.Error()).Fatal("unable to listen for grpc traffic")
+	}
+	go func() {
+		log.WithField("port", config.GRPCPort).Info("starting grpc service...")
+		log.Fatal(gs.Serve(lis))
+	}()
+
 	log.WithField("port", config.ServerPort).Info("starting service...")
 	log.Fatal(http.ListenAndServe(":"+config.ServerPort, hdlr))
 }
@@ -74,36 +259,129 @@ func initDB() {
 		}
 	}
 
-	log.WithField("db", config.DBName).Info("creating db")
-	_, err := r.DBCreate(config.DBName).RunWrite(session)
-	checkErr("creating db", err)
+	var exists bool
+	checkErr("listing dbs", r.DBList().Contains(config.DBName).ReadOne(&exists, session))
+	if !exists {
+		log.WithField("db", config.DBName).Info("creating db")
+		_, err := r.DBCreate(config.DBName).RunWrite(session)
+		checkErr("creating db", err)
+	}
 
-	log.WithField("table", config.VisitsTable).Info("creating table")
-	_, err = r.TableCreate(config.VisitsTable).RunWrite(session)
-	checkErr("creating table", err)
+	checkErr("migrating schema", migrateSchema(session, config))
 
-	log.WithField("table", config.CitiesTable).Info("creating table")
-	_, err = r.TableCreate(config.CitiesTable).RunWrite(session)
-	checkErr("creating table", err)
+	log.Info("successfully initialized database")
+}
 
-	log.WithFields(logrus.Fields{
-		"table": config.VisitsTable,
-		"index": "user",
-	}).Info("creating index on table")
-	_, err = r.Table(config.VisitsTable).IndexCreate("user").RunWrite(session)
-	checkErr("creating table index", err)
+func rebuildProjections() {
+	log.Info("rebuilding user summaries & achievements...")
 
-	log.WithFields(logrus.Fields{
-		"table": config.CitiesTable,
-		"index": "state",
-	}).Info("creating index on table")
-	_, err = r.Table(config.CitiesTable).IndexCreate("state").RunWrite(session)
-	checkErr("creating table index", err)
+	rules, err := loadRules(config.AchievementsFile)
+	if err != nil {
+		log.WithError(err).Fatal("failure: loading achievement rules")
+	}
 
-	_, err = r.Table(config.VisitsTable).IndexWait("user").Run(session)
-	checkErr("waiting on table index", err)
-	_, err = r.Table(config.CitiesTable).IndexWait("state").Run(session)
-	checkErr("waiting on table index", err)
+	vc := visits.NewClient(visits.Config{
+		Table: config.VisitsTable,
+	}, session)
+	sc := summaries.NewClient(summaries.Config{
+		Table:  config.SummsTable,
+		Visits: vc,
+		Profiles: profiles.NewClient(profiles.Config{
+			Table: config.ProfilesTable,
+		}, session),
+	}, session)
+	if err := sc.RebuildAll(); err != nil {
+		log.WithError(err).Fatal("failure: rebuilding user summaries")
+	}
+	ac := achievements.NewClient(achievements.Config{
+		Table:  config.AchievesTable,
+		Rules:  rules,
+		Visits: vc,
+	}, session)
+	if err := ac.EvaluateAll(); err != nil {
+		log.WithError(err).Fatal("failure: evaluating user achievements")
+	}
 
-	log.Info("successfully initialized database")
+	log.Info("successfully rebuilt user summaries & achievements")
+}
+
+// backupDB writes a backup archive of the visits & cities tables to a file,
+// or to stdout by default.
+func backupDB(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("out", "-", "archive file to write (- for stdout)")
+	fs.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.WithError(err).Fatal("failure: creating backup file")
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.WithError(err).Fatal("failure: writing backup file")
+			}
+		}()
+		w = f
+	}
+
+	log.WithField("db", config.DBName).Info("backing up database...")
+	stats, err := backupClient().Backup(w)
+	if err != nil {
+		log.WithError(err).Fatal("failure: backing up database")
+	}
+	for name, st := range stats {
+		log.WithFields(logrus.Fields{
+			"table": name,
+			"rows":  st.Rows,
+		}).Info("backed up table")
+	}
+	log.Info("successfully backed up database")
+}
+
+// restoreDB restores a backup archive from a file, or from stdin by default.
+// The database & schema are created when they do not exist yet.
+func restoreDB(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	conflict := fs.String("conflict", string(backup.ConflictSkip), "what to do with rows which already exist: skip or overwrite")
+	fs.Parse(args)
+
+	var rd io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.WithError(err).Fatal("failure: opening backup file")
+		}
+		defer f.Close()
+		rd = f
+	}
+
+	initDB()
+
+	log.WithFields(logrus.Fields{
+		"db":       config.DBName,
+		"conflict": *conflict,
+	}).Info("restoring database...")
+	stats, err := backupClient().Restore(rd, backup.Conflict(*conflict))
+	if err != nil {
+		log.WithError(err).Fatal("failure: restoring database")
+	}
+	for name, st := range stats {
+		log.WithFields(logrus.Fields{
+			"table":     name,
+			"rows":      st.Rows,
+			"inserted":  st.Inserted,
+			"skipped":   st.Skipped,
+			"overwrote": st.Overwrote,
+		}).Info("restored table")
+	}
+	log.Info("successfully restored database, run with --rebuild-projections to update summaries & achievements")
+}
+
+func backupClient() *backup.Client {
+	return backup.NewClient(backup.Config{
+		VisitsTable: config.VisitsTable,
+		CitiesTable: config.CitiesTable,
+	}, session)
 }
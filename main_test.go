@@ -2,19 +2,48 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	r "github.com/dancannon/gorethink"
 
+	"github.com/nstogner/beenthere-ws/achievements"
+	"github.com/nstogner/beenthere-ws/backup"
+	"github.com/nstogner/beenthere-ws/client"
+	"github.com/nstogner/beenthere-ws/grpcapi"
+	"github.com/nstogner/beenthere-ws/grpcapi/visitspb"
 	"github.com/nstogner/beenthere-ws/handler"
 	"github.com/nstogner/beenthere-ws/locations"
+	"github.com/nstogner/beenthere-ws/openapi"
+	"github.com/nstogner/beenthere-ws/outbox"
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/service"
+	"github.com/nstogner/beenthere-ws/shares"
+	"github.com/nstogner/beenthere-ws/social"
+	"github.com/nstogner/beenthere-ws/summaries"
+	"github.com/nstogner/beenthere-ws/trips"
 	"github.com/nstogner/beenthere-ws/visits"
+	"github.com/nstogner/beenthere-ws/webhooks"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // TestServer relies on rethinkdb being installed on the localhost. This can
@@ -43,17 +72,88 @@ func TestServer(t *testing.T) {
 	})
 	checkErr("connecting to db", err)
 	vc := visits.NewClient(visits.Config{
-		Table: conf.VisitsTable,
+		Table:       conf.VisitsTable,
+		DedupWindow: time.Minute,
+		AuditTable:  conf.AuditTable,
 	}, sess)
 	lc := locations.NewClient(locations.Config{
 		Table: conf.CitiesTable,
 	}, sess)
+	tc := trips.NewClient(trips.Config{
+		Table: conf.TripsTable,
+	}, sess)
+	pc := profiles.NewClient(profiles.Config{
+		Table: conf.ProfilesTable,
+	}, sess)
+	sc := summaries.NewClient(summaries.Config{
+		Table:    conf.SummsTable,
+		Visits:   vc,
+		Profiles: pc,
+	}, sess)
+	fc := social.NewClient(social.Config{
+		Table: conf.FollowsTable,
+	}, sess)
+	shc := shares.NewClient(shares.Config{
+		Table:  conf.SharesTable,
+		Secret: []byte("testing"),
+	}, sess)
+	rules, err := loadRules(conf.AchievementsFile)
+	checkErr("loading achievement rules", err)
+	ac := achievements.NewClient(achievements.Config{
+		Table:  conf.AchievesTable,
+		Rules:  rules,
+		Visits: vc,
+	}, sess)
+	wc := webhooks.NewClient(webhooks.Config{
+		Table:           conf.WebhooksTable,
+		DeliveriesTable: conf.DeliveriesTable,
+		Profiles:        pc,
+		// The receivers below are local.
+		AllowPrivate: true,
+		MaxAttempts:  3,
+		Backoff:      10 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	}, sess)
+	hub := outbox.NewHub()
+	eventFile, err := ioutil.TempFile("", "beenthere-events")
+	checkErr("creating event file", err)
+	eventFile.Close()
+	defer os.Remove(eventFile.Name())
+	fs, err := outbox.NewFileSink(eventFile.Name())
+	checkErr("opening event file", err)
+	defer fs.Close()
+	oc := outbox.NewClient(outbox.Config{
+		Table:        conf.OutboxTable,
+		QueueTable:   conf.OutboxQueueTable,
+		Source:       vc,
+		Sinks:        []outbox.Sink{wc, sc, ac, fs},
+		PollInterval: 10 * time.Millisecond,
+	}, sess)
 
-	// Setup http handler.
+	// Setup http handler. Every request & response is validated against the
+	// api spec.
+	spec, err := loadSpec(conf.OpenAPIFile)
+	checkErr("loading api spec", err)
 	hdlr := handler.New(handler.Config{
 		Logger:       log,
 		VisitsClient: vc,
 		LocsClient:   lc,
+		TripsClient:  tc,
+		SummsClient:  sc,
+		ProfsClient:  pc,
+		SocialClient: fc,
+		SharesClient: shc,
+		AchvsClient:  ac,
+		HooksClient:  wc,
+		OutboxClient: oc,
+		EventHub:     hub,
+		AuthHeader:   conf.AuthHeader,
+		Spec:         spec,
+		Admins:       []string{"auditor"},
+		// Test requests come from the loopback address, so it plays the proxy.
+		TrustedProxies: []*net.IPNet{{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(32, 32)}},
+
+		ValidateResponses: true,
 	})
 	server := httptest.NewServer(hdlr)
 
@@ -62,18 +162,21 @@ func TestServer(t *testing.T) {
 	r.DBDrop(conf.DBName).RunWrite(sess)
 	_, err = r.DBCreate(conf.DBName).RunWrite(sess)
 	checkErr("creating db", err)
-	_, err = r.TableCreate(conf.VisitsTable).RunWrite(sess)
-	checkErr("creating table", err)
-	_, err = r.TableCreate(conf.CitiesTable).RunWrite(sess)
-	checkErr("creating table", err)
-	_, err = r.Table(conf.VisitsTable).IndexCreate("user").RunWrite(sess)
-	checkErr("creating table index", err)
-	_, err = r.Table(conf.CitiesTable).IndexCreate("state").RunWrite(sess)
-	checkErr("creating table index", err)
-	_, err = r.Table(conf.VisitsTable).IndexWait("user").Run(sess)
-	checkErr("waiting on table index", err)
-	_, err = r.Table(conf.CitiesTable).IndexWait("state").Run(sess)
-	checkErr("waiting on table index", err)
+	checkErr("creating schema", migrateSchema(sess, conf))
+	// Migrating again leaves the schema as it is, except for indexes whose
+	// version is not recorded (ie: created by an older version), which are
+	// rebuilt.
+	checkErr("migrating schema", migrateSchema(sess, conf))
+	_, err = r.Table(conf.SchemaTable).Get(conf.VisitsTable + "/user_timestamp").Delete().RunWrite(sess)
+	checkErr("forgetting an index version", err)
+	checkErr("migrating schema", migrateSchema(sess, conf))
+	var version schemaVersion
+	checkErr("reading an index version", r.Table(conf.SchemaTable).Get(conf.VisitsTable+"/user_timestamp").ReadOne(&version, sess))
+	visitIndexes := []string{}
+	checkErr("listing indexes", r.Table(conf.VisitsTable).IndexList().ReadAll(&visitIndexes, sess))
+	if version.Version != 1 || !contains(visitIndexes, "user_timestamp") || contains(visitIndexes, "user_timestamp"+rebuildSuffix) {
+		t.Fatalf("expected user_timestamp to be rebuilt at version 1, got %+v in %q", version, visitIndexes)
+	}
 	_, err = r.Table(conf.CitiesTable).Insert(map[string]string{
 		"id":    "Raleigh,NC",
 		"state": "NC",
@@ -110,10 +213,26 @@ func TestServer(t *testing.T) {
 		scanner = bufio.NewScanner(streamResp.Body)
 	}()
 
+	// postAs POSTs json as a given caller. Only the user may change their
+	// visits & trips.
+	postAs := func(caller, url string, body io.Reader) (*http.Response, error) {
+		req, err := http.NewRequest("POST", url, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Auth-User", caller)
+		return http.DefaultClient.Do(req)
+	}
+	resp, err := postAs("testman", server.URL+"/users/other/visits", strings.NewReader(`{"city": "Raleigh", "state": "NC"}`))
+	checkErr("making http request", err)
+	checkStatus("POSTing a visit for another user", resp, http.StatusForbidden)
+	resp.Body.Close()
+
 	// Add a user visit.
-	resp, err := http.Post(
+	resp, err = postAs(
+		"testman",
 		server.URL+"/users/testman/visits",
-		"application/json",
 		// POST a lowercase state and verify later that it was converted to
 		// uppercase.
 		strings.NewReader(`{"city": "Raleigh", "state": "nc"}`),
@@ -123,11 +242,31 @@ func TestServer(t *testing.T) {
 	resp.Body.Close()
 
 	// Add an empty user visit.
-	resp, err = http.Post(server.URL+"/users/testman/visits", "application/json", nil)
+	resp, err = postAs("testman", server.URL+"/users/testman/visits", nil)
 	checkErr("making http request", err)
 	checkStatus("POSTing an empty visit", resp, http.StatusBadRequest)
 	resp.Body.Close()
 
+	// Requests which do not match the api spec are rejected before they are
+	// handled.
+	resp, err = postAs("testman", server.URL+"/users/testman/visits", strings.NewReader(`{"city": "Raleigh", "state": "NC", "private": "yes"}`))
+	checkErr("making http request", err)
+	checkStatus("POSTing a visit with a mistyped field", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	resp, err = http.Get(server.URL + "/users/testman/visits?limit=many")
+	checkErr("making http request", err)
+	checkStatus("GETing visits with a mistyped parameter", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	resp, err = http.Get(server.URL + "/openapi.json")
+	checkErr("making http request", err)
+	checkStatus("GETing the api spec", resp, http.StatusOK)
+	served, err := ioutil.ReadAll(resp.Body)
+	checkErr("reading api spec", err)
+	resp.Body.Close()
+	if string(served) != string(spec.Raw) {
+		t.Fatal("expected the api spec to be served as it was loaded")
+	}
+
 	// Get all user visits for a given user.
 	resp, err = http.Get(server.URL + "/users/testman/visits")
 	checkErr("making http request", err)
@@ -151,10 +290,25 @@ func TestServer(t *testing.T) {
 	raleighVisitID := visitsBody.Visits[0].ID
 	resp.Body.Close()
 
+	// Add a duplicate user visit within the dedup window.
+	resp, err = postAs(
+		"testman",
+		server.URL+"/users/testman/visits",
+		strings.NewReader(`{"city": "Raleigh", "state": "NC"}`),
+	)
+	checkErr("making http request", err)
+	checkStatus("POSTing a duplicate visit", resp, http.StatusOK)
+	dupVisit := &visits.Visit{}
+	checkErr("parsing visit response body", json.NewDecoder(resp.Body).Decode(dupVisit))
+	if dupVisit.ID != raleighVisitID {
+		t.Fatalf("expected duplicate visit to return existing visit %q, got %q", raleighVisitID, dupVisit.ID)
+	}
+	resp.Body.Close()
+
 	// Add another user visit.
-	resp, err = http.Post(
+	resp, err = postAs(
+		"testman",
 		server.URL+"/users/testman/visits",
-		"application/json",
 		strings.NewReader(`{"city": "Charlotte", "state": "NC"}`),
 	)
 	checkErr("making http request", err)
@@ -187,11 +341,39 @@ func TestServer(t *testing.T) {
 	}
 	resp.Body.Close()
 
+	// Create a trip from the user's existing visits.
+	tripStart := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	tripEnd := time.Now().Add(time.Hour).Format(time.RFC3339)
+	resp, err = postAs(
+		"testman",
+		server.URL+"/users/testman/trips?auto=true",
+		strings.NewReader(`{"name": "NC road trip", "start": "`+tripStart+`", "end": "`+tripEnd+`"}`),
+	)
+	checkErr("making http request", err)
+	checkStatus("POSTing an auto trip", resp, http.StatusOK)
+	trip := &trips.Trip{}
+	checkErr("parsing trip response body", json.NewDecoder(resp.Body).Decode(trip))
+	if len(trip.Visits) != 2 {
+		t.Fatalf("expected exactly 2 visits in the trip, got %v", trip.Visits)
+	}
+	resp.Body.Close()
+
+	// Add an invalid trip.
+	resp, err = postAs("testman", server.URL+"/users/testman/trips", strings.NewReader(`{"name": "nowhere"}`))
+	checkErr("making http request", err)
+	checkStatus("POSTing an invalid trip", resp, http.StatusBadRequest)
+	resp.Body.Close()
+
 	// Delete a user visit.
 	req, err := http.NewRequest("DELETE", server.URL+"/users/testman/visits/"+raleighVisitID, nil)
 	checkErr("making http request", err)
 	resp, err = http.DefaultClient.Do(req)
 	checkErr("failed to make http request", err)
+	checkStatus("DELETEing a visit anonymously", resp, http.StatusForbidden)
+	resp.Body.Close()
+	req.Header.Set("X-Auth-User", "testman")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr("failed to make http request", err)
 	checkStatus("DELETEing the Raleigh user visit", resp, http.StatusNoContent)
 	resp.Body.Close()
 
@@ -206,6 +388,53 @@ func TestServer(t *testing.T) {
 	if len(visitsBody.Visits) != 1 {
 		t.Fatal("expected exactly 1 visit to be returned")
 	}
+	if visitsBody.Visits[0].TripID != trip.ID {
+		t.Fatal("expected remaining visit to belong to the trip")
+	}
+	resp.Body.Close()
+
+	// Get the trip's visits after deleting one.
+	resp, err = http.Get(server.URL + "/users/testman/trips/" + trip.ID + "/visits")
+	checkErr("making http request", err)
+	checkStatus("GETing a trip's visits", resp, http.StatusOK)
+	visitsBody = &struct {
+		Visits []visits.Visit `json:"visits"`
+	}{make([]visits.Visit, 0)}
+	checkErr("parsing visits response body", json.NewDecoder(resp.Body).Decode(visitsBody))
+	if len(visitsBody.Visits) != 1 {
+		t.Fatalf("expected exactly 1 trip visit to be returned, got %v", len(visitsBody.Visits))
+	}
+	resp.Body.Close()
+
+	// Get another user's trip.
+	resp, err = http.Get(server.URL + "/users/someoneelse/trips/" + trip.ID)
+	checkErr("making http request", err)
+	checkStatus("GETing another user's trip", resp, http.StatusNotFound)
+	resp.Body.Close()
+
+	// Deleting a trip only changes the visits which are not in the trash.
+	req, err = http.NewRequest("DELETE", server.URL+"/users/testman/trips/"+trip.ID, nil)
+	checkErr("making http request", err)
+	req.Header.Set("X-Auth-User", "testman")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr("failed to make http request", err)
+	checkStatus("DELETEing a trip", resp, http.StatusNoContent)
+	resp.Body.Close()
+	trashed, err := vc.Get(raleighVisitID)
+	checkErr("getting a deleted visit", err)
+	if trashed.DeletedAt == nil || trashed.TripID != trip.ID {
+		t.Fatalf("expected the deleted visit to be left as it was, got %+v", trashed)
+	}
+	resp, err = http.Get(server.URL + "/users/testman/visits")
+	checkErr("making http request", err)
+	checkStatus("GETing a user visit", resp, http.StatusOK)
+	visitsBody = &struct {
+		Visits []visits.Visit `json:"visits"`
+	}{make([]visits.Visit, 0)}
+	checkErr("parsing visits response body", json.NewDecoder(resp.Body).Decode(visitsBody))
+	if len(visitsBody.Visits) != 1 || visitsBody.Visits[0].TripID != "" {
+		t.Fatalf("expected the remaining visit to have left the deleted trip, got %+v", visitsBody.Visits)
+	}
 	resp.Body.Close()
 
 	// Make sure the 2 new visits were sent over the streaming endpoint.
@@ -241,4 +470,1393 @@ func TestServer(t *testing.T) {
 		t.Fatalf("expected exactly 2 cities to be returned, got %v", stateCitiesBody.Cities)
 	}
 	resp.Body.Close()
+
+	// Insert historical duplicates directly & merge them.
+	past := time.Now().Add(-24 * time.Hour)
+	for _, ts := range []time.Time{past, past.Add(2 * time.Minute), past.Add(4 * time.Minute)} {
+		_, err = r.Table(conf.VisitsTable).Insert(&visits.Visit{
+			City:      "Durham",
+			State:     "NC",
+			User:      "dupeman",
+			Timestamp: ts,
+		}).RunWrite(sess)
+		checkErr("inserting visit record", err)
+	}
+	dedupeBody := &struct {
+		Preview bool           `json:"preview"`
+		Removed int            `json:"removed"`
+		Merges  []visits.Merge `json:"merges"`
+	}{}
+	resp, err = postAs("dupeman", server.URL+"/users/dupeman/visits:dedupe?preview=true&window=10m", nil)
+	checkErr("making http request", err)
+	checkStatus("POSTing a dedupe preview", resp, http.StatusOK)
+	checkErr("parsing dedupe response body", json.NewDecoder(resp.Body).Decode(dedupeBody))
+	if !dedupeBody.Preview || dedupeBody.Removed != 2 || len(dedupeBody.Merges) != 1 {
+		t.Fatalf("expected a preview of 1 merge removing 2 visits, got %+v", dedupeBody)
+	}
+	resp.Body.Close()
+	resp, err = postAs("dupeman", server.URL+"/users/dupeman/visits:dedupe?window=10m", nil)
+	checkErr("making http request", err)
+	checkStatus("POSTing a dedupe", resp, http.StatusOK)
+	resp.Body.Close()
+	resp, err = http.Get(server.URL + "/users/dupeman/visits")
+	checkErr("making http request", err)
+	checkStatus("GETing a user visit", resp, http.StatusOK)
+	visitsBody = &struct {
+		Visits []visits.Visit `json:"visits"`
+	}{make([]visits.Visit, 0)}
+	checkErr("parsing visits response body", json.NewDecoder(resp.Body).Decode(visitsBody))
+	if len(visitsBody.Visits) != 1 {
+		t.Fatalf("expected exactly 1 visit to remain after dedupe, got %v", len(visitsBody.Visits))
+	}
+	resp.Body.Close()
+	// Merged duplicates are moved to the trash rather than removed.
+	req, err = http.NewRequest("GET", server.URL+"/users/dupeman/visits/trash", nil)
+	checkErr("making http request", err)
+	req.Header.Set("X-Auth-User", "dupeman")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr("making http request", err)
+	checkStatus("GETing a user's trash", resp, http.StatusOK)
+	visitsBody = &struct {
+		Visits []visits.Visit `json:"visits"`
+	}{make([]visits.Visit, 0)}
+	checkErr("parsing trash response body", json.NewDecoder(resp.Body).Decode(visitsBody))
+	if len(visitsBody.Visits) != 2 {
+		t.Fatalf("expected the 2 merged duplicates to be in the trash, got %v", len(visitsBody.Visits))
+	}
+	resp.Body.Close()
+
+	// Add visits logged after the fact.
+	for _, body := range []string{
+		`{"city": "Asheville", "state": "NC", "time_zone": "America/New_York", "arrived_at": "2016-07-01T10:00:00-04:00", "departed_at": "2016-07-03T09:00:00-04:00"}`,
+		`{"city": "Charlotte", "state": "NC", "time_zone": "America/New_York", "arrived_at": "2016-07-03T12:00:00-04:00"}`,
+	} {
+		resp, err = postAs("traveler", server.URL+"/users/traveler/visits", strings.NewReader(body))
+		checkErr("making http request", err)
+		checkStatus("POSTing a past visit", resp, http.StatusOK)
+		resp.Body.Close()
+	}
+	resp, err = postAs(
+		"traveler",
+		server.URL+"/users/traveler/visits",
+		strings.NewReader(`{"city": "Asheville", "state": "NC", "arrived_at": "2016-07-03T10:00:00Z", "departed_at": "2016-07-01T10:00:00Z"}`),
+	)
+	checkErr("making http request", err)
+	checkStatus("POSTing a visit departing before arriving", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	resp, err = postAs(
+		"traveler",
+		server.URL+"/users/traveler/visits",
+		strings.NewReader(`{"city": "Asheville", "state": "NC", "arrived_at": "0001-01-01T00:00:00Z", "departed_at": "9999-01-01T00:00:00Z"}`),
+	)
+	checkErr("making http request", err)
+	checkStatus("POSTing a visit spanning millennia", resp, http.StatusBadRequest)
+	resp.Body.Close()
+
+	// Get the days spent per state/city.
+	resp, err = http.Get(server.URL + "/users/traveler/visits/days")
+	checkErr("making http request", err)
+	checkStatus("GETing the days a user spent", resp, http.StatusOK)
+	days := &visits.Days{}
+	checkErr("parsing days response body", json.NewDecoder(resp.Body).Decode(days))
+	resp.Body.Close()
+	if len(days.States) != 1 || days.States[0] != (visits.DayCount{Place: "NC", Days: 3}) {
+		t.Fatalf("expected 3 days spent in NC, got %v", days.States)
+	}
+	if len(days.Cities) != 2 ||
+		days.Cities[0] != (visits.DayCount{Place: "Asheville,NC", Days: 3}) ||
+		days.Cities[1] != (visits.DayCount{Place: "Charlotte,NC", Days: 1}) {
+		t.Fatalf("expected 3 days in Asheville & 1 day in Charlotte, got %v", days.Cities)
+	}
+	req, err = http.NewRequest("GET", server.URL+"/users/traveler/visits/days", nil)
+	checkErr("making http request", err)
+	req.Header.Set("Accept", "application/xml")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr("making http request", err)
+	checkStatus("GETing the days a user spent as xml", resp, http.StatusOK)
+	xmlDays := &visits.Days{}
+	checkErr("parsing days xml response body", xml.NewDecoder(resp.Body).Decode(xmlDays))
+	resp.Body.Close()
+	if len(xmlDays.Cities) != 2 || xmlDays.Cities[0] != days.Cities[0] {
+		t.Fatalf("expected the days in xml to match json, got %v", xmlDays)
+	}
+
+	// Filter & sort a user's visits.
+	for _, tc := range []struct {
+		query  string
+		cities []string
+	}{
+		{"?sort=-timestamp", []string{"Charlotte", "Asheville"}},
+		{"?sort=city", []string{"Asheville", "Charlotte"}},
+		{"?state=nc&city=Asheville", []string{"Asheville"}},
+		{"?from=2016-07-02", []string{"Charlotte"}},
+		{"?state=NC&to=2016-07-01", []string{"Asheville"}},
+		{"?state=TX", []string{}},
+	} {
+		resp, err = http.Get(server.URL + "/users/traveler/visits" + tc.query)
+		checkErr("making http request", err)
+		checkStatus("GETing filtered visits", resp, http.StatusOK)
+		visitsBody = &struct {
+			Visits []visits.Visit `json:"visits"`
+		}{make([]visits.Visit, 0)}
+		checkErr("parsing visits response body", json.NewDecoder(resp.Body).Decode(visitsBody))
+		if len(visitsBody.Visits) != len(tc.cities) {
+			t.Fatalf("%s: expected %v visits, got %v", tc.query, len(tc.cities), len(visitsBody.Visits))
+		}
+		for i, v := range visitsBody.Visits {
+			if v.City != tc.cities[i] {
+				t.Fatalf("%s: expected visit %v to be in %s, got %s", tc.query, i, tc.cities[i], v.City)
+			}
+		}
+		resp.Body.Close()
+	}
+	resp, err = http.Get(server.URL + "/users/traveler/visits?sort=state")
+	checkErr("making http request", err)
+	checkStatus("GETing visits with an invalid sort", resp, http.StatusBadRequest)
+	resp.Body.Close()
+
+	// Page through a user's visits using cursors.
+	cursorBody := &struct {
+		Visits     []visits.Visit `json:"visits"`
+		NextCursor string         `json:"next_cursor"`
+	}{}
+	pageCities := make([]string, 0)
+	next := "/users/traveler/visits?limit=1"
+	for i := 0; next != "" && i < 5; i++ {
+		resp, err = http.Get(server.URL + next)
+		checkErr("making http request", err)
+		checkStatus("GETing a page of visits", resp, http.StatusOK)
+		cursorBody.Visits, cursorBody.NextCursor = nil, ""
+		checkErr("parsing visits response body", json.NewDecoder(resp.Body).Decode(cursorBody))
+		for _, v := range cursorBody.Visits {
+			pageCities = append(pageCities, v.City)
+		}
+		next = ""
+		if cursorBody.NextCursor != "" {
+			if resp.Header.Get("Link") == "" {
+				t.Fatal("expected a Link header along with next_cursor")
+			}
+			next = "/users/traveler/visits?limit=1&cursor=" + cursorBody.NextCursor
+		}
+		resp.Body.Close()
+	}
+	if strings.Join(pageCities, ",") != "Asheville,Charlotte" {
+		t.Fatalf("expected cursor pages of Asheville then Charlotte, got %v", pageCities)
+	}
+	resp, err = http.Get(server.URL + "/users/traveler/visits?cursor=bogus")
+	checkErr("making http request", err)
+	checkStatus("GETing visits with an invalid cursor", resp, http.StatusBadRequest)
+	resp.Body.Close()
+
+	// Get a user's travel stats.
+	resp, err = http.Get(server.URL + "/users/traveler/stats")
+	checkErr("making http request", err)
+	checkStatus("GETing a user's stats", resp, http.StatusOK)
+	statsBody := &struct {
+		Visits        int            `json:"visits"`
+		States        int            `json:"states"`
+		Cities        int            `json:"cities"`
+		Countries     int            `json:"countries"`
+		StatesPercent float64        `json:"states_percent"`
+		FirstVisit    time.Time      `json:"first_visit"`
+		PerYear       map[string]int `json:"visits_per_year"`
+	}{}
+	checkErr("parsing stats response body", json.NewDecoder(resp.Body).Decode(statsBody))
+	if statsBody.Visits != 2 || statsBody.States != 1 || statsBody.Cities != 2 || statsBody.Countries != 1 {
+		t.Fatalf("expected 2 visits to 2 cities in 1 state, got %+v", statsBody)
+	}
+	if statsBody.PerYear["2016"] != 2 {
+		t.Fatalf("expected 2 visits in 2016, got %v", statsBody.PerYear)
+	}
+	if statsBody.FirstVisit.Format("2006-01-02") != "2016-07-01" {
+		t.Fatalf("expected first visit on 2016-07-01, got %v", statsBody.FirstVisit)
+	}
+	if statsBody.StatesPercent < 1.9 || statsBody.StatesPercent > 2.0 {
+		t.Fatalf("expected 1 of 51 states to be visited, got %v%%", statsBody.StatesPercent)
+	}
+	resp.Body.Close()
+	// Visits are counted in the UTC year & month they were made in, whatever
+	// their timezone.
+	resp, err = postAs(
+		"reveler",
+		server.URL+"/users/reveler/visits",
+		strings.NewReader(`{"city": "Charlotte", "state": "NC", "timestamp": "2016-12-31T22:00:00-05:00"}`),
+	)
+	checkErr("making http request", err)
+	checkStatus("POSTing a valid visit", resp, http.StatusOK)
+	resp.Body.Close()
+	resp, err = http.Get(server.URL + "/users/reveler/stats")
+	checkErr("making http request", err)
+	checkStatus("GETing a user's stats", resp, http.StatusOK)
+	statsBody.PerYear = nil
+	checkErr("parsing stats response body", json.NewDecoder(resp.Body).Decode(statsBody))
+	resp.Body.Close()
+	totals, err := vc.GetTotals("reveler", false)
+	checkErr("getting visit totals", err)
+	if statsBody.PerYear["2017"] != 1 || totals.Months["2017-01"] != 1 {
+		t.Fatalf("expected a visit in 2017 & 2017-01, got %v & %v", statsBody.PerYear, totals.Months)
+	}
+
+	// Rebuild all user summaries & keep them projected from the outbox.
+	checkErr("rebuilding summaries", sc.RebuildAll())
+	summary, err := sc.Get("traveler")
+	checkErr("getting rebuilt summary", err)
+	if summary.Visits != 2 || summary.Cities["Asheville,NC"] != 1 {
+		t.Fatalf("expected a rebuilt summary of 2 visits, got %+v", summary)
+	}
+	resp, err = postAs(
+		"traveler",
+		server.URL+"/users/traveler/visits",
+		strings.NewReader(`{"city": "Greenville", "state": "SC"}`),
+	)
+	checkErr("making http request", err)
+	checkStatus("POSTing a valid visit", resp, http.StatusOK)
+	resp.Body.Close()
+	summary, err = sc.Get("traveler")
+	checkErr("getting summary", err)
+	if summary.Visits != 2 {
+		t.Fatalf("expected the summary not to be projected before relaying started, got %+v", summary)
+	}
+	// Events are relayed from the outbox, including those recorded before
+	// relaying started (ie: while the service was down).
+	go oc.Run()
+	projected := false
+	for i := 0; i < 50 && !projected; i++ {
+		resp, err = http.Get(server.URL + "/users/traveler/visits/states")
+		checkErr("making http request", err)
+		checkStatus("GETing the states a user visited", resp, http.StatusOK)
+		statesBody = &struct {
+			States []string `json:"states"`
+		}{make([]string, 0)}
+		checkErr("parsing states response body", json.NewDecoder(resp.Body).Decode(statesBody))
+		resp.Body.Close()
+		projected = len(statesBody.States) == 2
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !projected {
+		t.Fatalf("expected projected summary to include 2 states, got %v", statesBody.States)
+	}
+
+	// Render a map of the states a user visited.
+	resp, err = http.Get(server.URL + "/users/testman/map.svg?visited=red")
+	checkErr("making http request", err)
+	checkStatus("GETing a user's map", resp, http.StatusOK)
+	svg, err := ioutil.ReadAll(resp.Body)
+	checkErr("reading map response body", err)
+	if !strings.Contains(string(svg), `id="NC" fill="red"`) {
+		t.Fatal("expected NC to be filled in on the map")
+	}
+	if strings.Contains(string(svg), `id="SC" fill="red"`) {
+		t.Fatal("expected SC not to be filled in on the map")
+	}
+	etag := resp.Header.Get("ETag")
+	resp.Body.Close()
+	req, err = http.NewRequest("GET", server.URL+"/users/testman/map.svg?visited=red", nil)
+	checkErr("making http request", err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	checkErr("making http request", err)
+	checkStatus("GETing an unchanged map", resp, http.StatusNotModified)
+	resp.Body.Close()
+	resp, err = http.Get(server.URL + "/users/testman/map.svg?width=99999")
+	checkErr("making http request", err)
+	checkStatus("GETing an oversized map", resp, http.StatusBadRequest)
+	resp.Body.Close()
+
+	// Test rendering the map as a PNG.
+	resp, err = http.Get(server.URL + "/users/testman/map.png?width=600&height=315")
+	checkErr("making http request", err)
+	checkStatus("GETing a user's PNG map", resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Fatalf("expected content type image/png, got %v", ct)
+	}
+	cfg, err := png.DecodeConfig(resp.Body)
+	checkErr("decoding PNG map", err)
+	resp.Body.Close()
+	if cfg.Width != 600 || cfg.Height != 315 {
+		t.Fatalf("expected a 600x315 PNG map, got %vx%v", cfg.Width, cfg.Height)
+	}
+	resp, err = http.Get(server.URL + "/users/testman/map.png?visited=rebeccapurple")
+	checkErr("making http request", err)
+	checkStatus("GETing a PNG map with an unknown color", resp, http.StatusBadRequest)
+	resp.Body.Close()
+
+	// Test privacy controls.
+	getAs := func(caller, path string) *http.Response {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		checkErr("making http request", err)
+		if caller != "" {
+			req.Header.Set("X-Auth-User", caller)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		checkErr("making http request", err)
+		return resp
+	}
+	putProfile := func(caller, user, body string) *http.Response {
+		req, err := http.NewRequest("PUT", server.URL+"/users/"+user+"/profile", strings.NewReader(body))
+		checkErr("making http request", err)
+		req.Header.Set("Content-Type", "application/json")
+		if caller != "" {
+			req.Header.Set("X-Auth-User", caller)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		checkErr("making http request", err)
+		return resp
+	}
+	for _, body := range []string{
+		`{"city": "Raleigh", "state": "NC"}`,
+		`{"city": "Greenville", "state": "SC", "private": true}`,
+	} {
+		resp, err = postAs("hermit", server.URL+"/users/hermit/visits", strings.NewReader(body))
+		checkErr("making http request", err)
+		checkStatus("POSTing a visit", resp, http.StatusOK)
+		resp.Body.Close()
+	}
+	for _, tc := range []struct {
+		caller string
+		states int
+	}{
+		{"", 1},
+		{"testman", 1},
+		{"hermit", 2},
+	} {
+		resp = getAs(tc.caller, "/users/hermit/visits/states")
+		checkStatus("GETing the states of a user with private visits", resp, http.StatusOK)
+		statesBody := &struct {
+			States []string `json:"states"`
+		}{}
+		checkErr("parsing states response body", json.NewDecoder(resp.Body).Decode(statesBody))
+		resp.Body.Close()
+		if len(statesBody.States) != tc.states {
+			t.Fatalf("expected caller %q to see %v states, got %v", tc.caller, tc.states, statesBody.States)
+		}
+	}
+	resp = putProfile("testman", "hermit", `{"visibility": "private"}`)
+	checkStatus("PUTing another user's profile", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = putProfile("hermit", "hermit", `{"visibility": "secret"}`)
+	checkStatus("PUTing an invalid profile", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	for _, tc := range []struct {
+		visibility string
+		caller     string
+		status     int
+	}{
+		{"private", "", http.StatusNotFound},
+		{"private", "testman", http.StatusNotFound},
+		{"private", "hermit", http.StatusOK},
+		{"followers", "", http.StatusForbidden},
+		{"followers", "hermit", http.StatusOK},
+		{"public", "", http.StatusOK},
+	} {
+		resp = putProfile("hermit", "hermit", `{"display_name": "The Hermit", "visibility": "`+tc.visibility+`"}`)
+		checkStatus("PUTing a profile", resp, http.StatusOK)
+		resp.Body.Close()
+		for _, path := range []string{"/users/hermit/visits", "/users/hermit/visits/cities", "/users/hermit/map.svg"} {
+			resp = getAs(tc.caller, path)
+			checkStatus(fmt.Sprintf("GETing %s of a %s profile as %q", path, tc.visibility, tc.caller), resp, tc.status)
+			resp.Body.Close()
+		}
+	}
+
+	// Trips only show the ids of private visits to their user.
+	resp, err = postAs(
+		"hermit",
+		server.URL+"/users/hermit/trips?auto=true",
+		strings.NewReader(`{"name": "Carolinas", "start": "`+time.Now().Add(-time.Hour).Format(time.RFC3339)+`", "end": "`+time.Now().Add(time.Hour).Format(time.RFC3339)+`"}`),
+	)
+	checkErr("making http request", err)
+	checkStatus("POSTing an auto trip", resp, http.StatusOK)
+	hermitTrip := &trips.Trip{}
+	checkErr("parsing trip response body", json.NewDecoder(resp.Body).Decode(hermitTrip))
+	resp.Body.Close()
+	for _, tc := range []struct {
+		caller string
+		visits int
+	}{
+		{"", 1},
+		{"hermit", 2},
+	} {
+		resp = getAs(tc.caller, "/users/hermit/trips/"+hermitTrip.ID)
+		checkStatus("GETing a trip with a private visit", resp, http.StatusOK)
+		shown := &trips.Trip{}
+		checkErr("parsing trip response body", json.NewDecoder(resp.Body).Decode(shown))
+		resp.Body.Close()
+		if len(shown.Visits) != tc.visits {
+			t.Fatalf("expected caller %q to see %v trip visits, got %v", tc.caller, tc.visits, shown.Visits)
+		}
+	}
+	resp, err = postAs("testman", server.URL+"/users/hermit/trips/"+hermitTrip.ID+"/visits", strings.NewReader(`{"visits": ["`+hermitTrip.Visits[0]+`"]}`))
+	checkErr("making http request", err)
+	checkStatus("POSTing visits to another user's trip", resp, http.StatusForbidden)
+	resp.Body.Close()
+
+	// Test following users.
+	followAs := func(method, caller, path string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		checkErr("making http request", err)
+		req.Header.Set("X-Auth-User", caller)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr("making http request", err)
+		return resp
+	}
+	resp = putProfile("recluse", "recluse", `{"visibility": "followers"}`)
+	checkStatus("PUTing a profile", resp, http.StatusOK)
+	resp.Body.Close()
+	for _, body := range []string{
+		`{"city": "Raleigh", "state": "NC"}`,
+		`{"city": "Charlotte", "state": "NC", "private": true}`,
+	} {
+		resp, err = postAs("recluse", server.URL+"/users/recluse/visits", strings.NewReader(body))
+		checkErr("making http request", err)
+		checkStatus("POSTing a visit", resp, http.StatusOK)
+		resp.Body.Close()
+	}
+	resp = followAs("PUT", "testman", "/users/fan/following/recluse")
+	checkStatus("following on behalf of another user", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = followAs("PUT", "fan", "/users/fan/following/fan")
+	checkStatus("following oneself", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	resp = getAs("fan", "/users/recluse/visits")
+	checkStatus("GETing a followers-only user's visits before following", resp, http.StatusForbidden)
+	resp.Body.Close()
+	for _, followee := range []string{"recluse", "testman", "recluse"} {
+		resp = followAs("PUT", "fan", "/users/fan/following/"+followee)
+		checkStatus("following a user", resp, http.StatusOK)
+		resp.Body.Close()
+	}
+	// Following a followers-only user is pending until they approve it.
+	resp = getAs("fan", "/users/recluse/visits")
+	checkStatus("GETing a followers-only user's visits before approval", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = getAs("fan", "/users/recluse/followers?status=pending")
+	checkStatus("GETing another user's pending followers", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = getAs("recluse", "/users/recluse/followers?status=pending")
+	checkStatus("GETing a user's pending followers", resp, http.StatusOK)
+	pendingBody := &struct {
+		Followers []social.Follow `json:"followers"`
+	}{}
+	checkErr("parsing followers response body", json.NewDecoder(resp.Body).Decode(pendingBody))
+	resp.Body.Close()
+	if len(pendingBody.Followers) != 1 || pendingBody.Followers[0].Follower != "fan" || pendingBody.Followers[0].Status != social.StatusPending {
+		t.Fatalf("expected 'fan' to be the only pending follower, got %+v", pendingBody.Followers)
+	}
+	resp = followAs("PUT", "fan", "/users/recluse/followers/fan")
+	checkStatus("approving a follow on behalf of another user", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = followAs("PUT", "recluse", "/users/recluse/followers/nobody")
+	checkStatus("approving a follow which was not asked for", resp, http.StatusNotFound)
+	resp.Body.Close()
+	resp = followAs("PUT", "recluse", "/users/recluse/followers/fan")
+	checkStatus("approving a follow", resp, http.StatusOK)
+	resp.Body.Close()
+	resp = getAs("fan", "/users/recluse/visits")
+	checkStatus("GETing a followers-only user's visits as a follower", resp, http.StatusOK)
+	resp.Body.Close()
+	// Follows made while a profile was public must be approved once it is
+	// not.
+	resp = followAs("PUT", "fan", "/users/fan/following/hermit")
+	checkStatus("following a user", resp, http.StatusOK)
+	resp.Body.Close()
+	resp = putProfile("hermit", "hermit", `{"visibility": "followers"}`)
+	checkStatus("PUTing a profile", resp, http.StatusOK)
+	resp.Body.Close()
+	resp = getAs("fan", "/users/hermit/visits")
+	checkStatus("GETing the visits of a user who stopped being public", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = putProfile("hermit", "hermit", `{"visibility": "public"}`)
+	checkStatus("PUTing a profile", resp, http.StatusOK)
+	resp.Body.Close()
+	resp = followAs("DELETE", "hermit", "/users/hermit/followers/fan")
+	checkStatus("removing a follower", resp, http.StatusNoContent)
+	resp.Body.Close()
+	resp = getAs("fan", "/users/recluse/followers")
+	checkStatus("GETing a user's followers", resp, http.StatusOK)
+	followersBody := &struct {
+		Followers []struct {
+			Follower string `json:"follower"`
+		} `json:"followers"`
+	}{}
+	checkErr("parsing followers response body", json.NewDecoder(resp.Body).Decode(followersBody))
+	resp.Body.Close()
+	if len(followersBody.Followers) != 1 || followersBody.Followers[0].Follower != "fan" {
+		t.Fatalf("expected 'fan' to be the only follower, got %+v", followersBody.Followers)
+	}
+	resp = getAs("", "/users/fan/feed")
+	checkStatus("GETing another user's feed", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = getAs("fan", "/users/fan/feed?limit=100")
+	checkStatus("GETing a user's feed", resp, http.StatusOK)
+	feedBody := &struct {
+		Visits []visits.Visit `json:"visits"`
+	}{}
+	checkErr("parsing feed response body", json.NewDecoder(resp.Body).Decode(feedBody))
+	resp.Body.Close()
+	feedUsers := make(map[string]int)
+	for i, v := range feedBody.Visits {
+		feedUsers[v.User]++
+		if v.Private {
+			t.Fatal("expected private visits to be left out of feeds")
+		}
+		if i > 0 && v.Timestamp.After(feedBody.Visits[i-1].Timestamp) {
+			t.Fatal("expected feed visits to be ordered most recent first")
+		}
+	}
+	if feedUsers["recluse"] != 1 || feedUsers["testman"] == 0 || len(feedUsers) != 2 {
+		t.Fatalf("expected the feed to hold visits of followed users only, got %v", feedUsers)
+	}
+	resp = followAs("DELETE", "fan", "/users/fan/following/recluse")
+	checkStatus("unfollowing a user", resp, http.StatusNoContent)
+	resp.Body.Close()
+	resp = getAs("fan", "/users/recluse/visits")
+	checkStatus("GETing a followers-only user's visits after unfollowing", resp, http.StatusForbidden)
+	resp.Body.Close()
+
+	// Test sharing a user's visits.
+	postShare := func(caller, body string) *http.Response {
+		req, err := http.NewRequest("POST", server.URL+"/users/recluse/shares", strings.NewReader(body))
+		checkErr("making http request", err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Auth-User", caller)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr("making http request", err)
+		return resp
+	}
+	resp = postShare("fan", `{"scope": "states"}`)
+	checkStatus("POSTing a share of another user's visits", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = postShare("recluse", `{"scope": "everything"}`)
+	checkStatus("POSTing a share with an invalid scope", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	shareTokens := make(map[string]string)
+	for _, scope := range []string{"states", "visits"} {
+		resp = postShare("recluse", `{"scope": "`+scope+`"}`)
+		checkStatus("POSTing a share", resp, http.StatusOK)
+		share := &struct {
+			ID    string `json:"id"`
+			Token string `json:"token"`
+		}{}
+		checkErr("parsing share response body", json.NewDecoder(resp.Body).Decode(share))
+		resp.Body.Close()
+		shareTokens[scope] = share.Token
+		shareTokens[scope+"_id"] = share.ID
+	}
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/shared/" + shareTokens["states"] + "/visits/states", http.StatusOK},
+		{"/shared/" + shareTokens["states"] + "/map.svg", http.StatusOK},
+		{"/shared/" + shareTokens["states"] + "/visits/cities", http.StatusForbidden},
+		{"/shared/" + shareTokens["states"] + "/visits", http.StatusForbidden},
+		{"/shared/" + shareTokens["visits"] + "/visits/cities", http.StatusOK},
+		{"/shared/" + shareTokens["visits"] + "x/visits/states", http.StatusNotFound},
+	} {
+		resp = getAs("", tc.path)
+		checkStatus("GETing "+tc.path, resp, tc.status)
+		resp.Body.Close()
+	}
+	resp = getAs("", "/shared/"+shareTokens["visits"]+"/visits")
+	checkStatus("GETing shared visits", resp, http.StatusOK)
+	sharedVisits := &struct {
+		Visits []visits.Visit `json:"visits"`
+	}{}
+	checkErr("parsing visits response body", json.NewDecoder(resp.Body).Decode(sharedVisits))
+	resp.Body.Close()
+	if len(sharedVisits.Visits) != 1 || sharedVisits.Visits[0].Private {
+		t.Fatalf("expected exactly 1 public visit to be shared, got %v", len(sharedVisits.Visits))
+	}
+	resp = getAs("recluse", "/users/recluse/shares")
+	checkStatus("GETing a user's shares", resp, http.StatusOK)
+	sharesBody := &struct {
+		Shares []struct{} `json:"shares"`
+	}{}
+	checkErr("parsing shares response body", json.NewDecoder(resp.Body).Decode(sharesBody))
+	resp.Body.Close()
+	if len(sharesBody.Shares) != 2 {
+		t.Fatalf("expected 2 active shares, got %v", len(sharesBody.Shares))
+	}
+	resp = followAs("DELETE", "recluse", "/users/recluse/shares/"+shareTokens["states_id"])
+	checkStatus("revoking a share", resp, http.StatusNoContent)
+	resp.Body.Close()
+	resp = getAs("", "/shared/"+shareTokens["states"]+"/visits/states")
+	checkStatus("GETing a revoked share", resp, http.StatusNotFound)
+	resp.Body.Close()
+
+	// Test comparing users.
+	resp = getAs("", "/users/hermit/compare/recluse")
+	checkStatus("comparing with a followers-only user", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = getAs("recluse", "/users/hermit/compare/recluse")
+	checkStatus("comparing users", resp, http.StatusOK)
+	comparison := &struct {
+		States     visits.Comparison `json:"states"`
+		Cities     visits.Comparison `json:"cities"`
+		Similarity float64           `json:"similarity"`
+	}{}
+	checkErr("parsing comparison response body", json.NewDecoder(resp.Body).Decode(comparison))
+	resp.Body.Close()
+	// Hermit's private visit to SC is hidden, while recluse sees their own
+	// private visit to Charlotte.
+	if fmt.Sprint(comparison.States.Both) != "[NC]" || len(comparison.States.OnlyUser) != 0 {
+		t.Fatalf("expected only NC to be visited by both users, got %+v", comparison.States)
+	}
+	if fmt.Sprint(comparison.Cities.Both) != "[Raleigh,NC]" || fmt.Sprint(comparison.Cities.OnlyOther) != "[Charlotte,NC]" {
+		t.Fatalf("unexpected city comparison: %+v", comparison.Cities)
+	}
+	if comparison.Similarity != 0.75 {
+		t.Fatalf("expected a similarity of 0.75, got %v", comparison.Similarity)
+	}
+
+	// Test leaderboards, which are read from projected summaries.
+	type leaderboard struct {
+		Entries []struct {
+			Rank  int    `json:"rank"`
+			User  string `json:"user"`
+			Score int    `json:"score"`
+		} `json:"entries"`
+	}
+	getBoard := func(caller, path string) map[string]int {
+		resp := getAs(caller, path)
+		checkStatus("GETing "+path, resp, http.StatusOK)
+		board := &leaderboard{}
+		checkErr("parsing leaderboard response body", json.NewDecoder(resp.Body).Decode(board))
+		resp.Body.Close()
+		scores := make(map[string]int)
+		for i, e := range board.Entries {
+			if e.Rank != i+1 || (i > 0 && e.Score > board.Entries[i-1].Score) {
+				t.Fatalf("expected leaderboard entries to be ranked by score, got %+v", board.Entries)
+			}
+			scores[e.User] = e.Score
+		}
+		return scores
+	}
+	var scores map[string]int
+	for i := 0; i < 50; i++ {
+		scores = getBoard("", "/leaderboards/states")
+		if scores["traveler"] == 2 && scores["hermit"] == 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	// Hermit's private visit to SC is not counted.
+	if scores["traveler"] != 2 || scores["hermit"] != 1 {
+		t.Fatalf("expected traveler & hermit to have visited 2 & 1 states, got %v", scores)
+	}
+	if _, ok := scores["recluse"]; ok {
+		t.Fatal("expected followers-only users to be left out of anonymous leaderboards")
+	}
+	resp = putProfile("hermit", "hermit", `{"visibility": "public", "leaderboard_opt_out": true}`)
+	checkStatus("PUTing a profile", resp, http.StatusOK)
+	resp.Body.Close()
+	if _, ok := getBoard("", "/leaderboards/cities")["hermit"]; ok {
+		t.Fatal("expected users who opted out to be left out of leaderboards")
+	}
+	scores = getBoard("fan", "/leaderboards/states?scope=followers")
+	if len(scores) != 1 || scores["testman"] == 0 {
+		t.Fatalf("expected only followed users on the followers leaderboard, got %v", scores)
+	}
+	resp = getAs("", "/leaderboards/states?scope=followers")
+	checkStatus("GETing a followers leaderboard anonymously", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = getAs("", "/leaderboards/countries")
+	checkStatus("GETing an unknown leaderboard", resp, http.StatusNotFound)
+	resp.Body.Close()
+
+	// Test achievements, which are evaluated from the outbox as visits
+	// change.
+	unlockResp, err := http.Get(server.URL + "/stream/achievements")
+	checkErr("making http request", err)
+	defer unlockResp.Body.Close()
+	unlocks := bufio.NewScanner(unlockResp.Body)
+	var maineVisitID string
+	for _, state := range []string{"CT", "ME", "MA", "NH", "RI", "VT"} {
+		resp, err = postAs(
+			"yankee",
+			server.URL+"/users/yankee/visits",
+			strings.NewReader(`{"city": "Capital", "state": "`+state+`"}`),
+		)
+		checkErr("making http request", err)
+		checkStatus("POSTing a valid visit", resp, http.StatusOK)
+		v := &visits.Visit{}
+		checkErr("parsing visit response body", json.NewDecoder(resp.Body).Decode(v))
+		resp.Body.Close()
+		if state == "ME" {
+			maineVisitID = v.ID
+		}
+	}
+	type achievementsBody struct {
+		Achievements []struct {
+			ID         string     `json:"achievement"`
+			Goal       int        `json:"goal"`
+			Progress   int        `json:"progress"`
+			UnlockedAt *time.Time `json:"unlocked_at"`
+		} `json:"achievements"`
+	}
+	unlocked := func(user, id string) bool {
+		resp := getAs("", "/users/"+user+"/achievements")
+		checkStatus("GETing a user's achievements", resp, http.StatusOK)
+		body := &achievementsBody{}
+		checkErr("parsing achievements response body", json.NewDecoder(resp.Body).Decode(body))
+		resp.Body.Close()
+		for _, a := range body.Achievements {
+			if a.ID == id {
+				return a.UnlockedAt != nil && a.Progress == a.Goal
+			}
+		}
+		t.Fatalf("expected achievement %q to be listed", id)
+		return false
+	}
+	for i := 0; i < 50 && !unlocked("yankee", "new-england"); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !unlocked("yankee", "new-england") {
+		t.Fatal("expected visiting every New England state to unlock an achievement")
+	}
+	unlockEvent := &achievements.Achievement{}
+	for unlocks.Scan() {
+		if line := unlocks.Text(); strings.HasPrefix(line, "data: ") {
+			checkErr("parsing unlock event", json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), unlockEvent))
+			if unlockEvent.Rule == "new-england" {
+				break
+			}
+		}
+	}
+	if unlockEvent.User != "yankee" || unlockEvent.Rule != "new-england" {
+		t.Fatalf("expected an unlock event for yankee, got %+v", unlockEvent)
+	}
+	resp = followAs("DELETE", "yankee", "/users/yankee/visits/"+maineVisitID)
+	checkStatus("DELETEing a visit", resp, http.StatusNoContent)
+	resp.Body.Close()
+	for i := 0; i < 50 && unlocked("yankee", "new-england"); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if unlocked("yankee", "new-england") {
+		t.Fatal("expected deleting a visit to revoke an achievement")
+	}
+
+	// Webhooks may not target the service's own network by default.
+	guarded := webhooks.NewClient(webhooks.Config{}, sess)
+	for _, target := range []string{"http://127.0.0.1:8080/", "http://10.0.0.1/", "http://169.254.169.254/latest/meta-data", "http://[::1]/", "http://localhost/"} {
+		if guarded.Validate(&webhooks.Webhook{URL: target, Events: []string{webhooks.EventVisitCreated}}) == nil {
+			t.Fatalf("expected a webhook to %s to be invalid", target)
+		}
+	}
+
+	// Test webhooks using local receivers. The first receiver fails its first
+	// delivery so that it is retried, while the second always fails.
+	received := make(chan webhooks.Payload, 10)
+	var receiverSecret string
+	failed := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get("X-Beenthere-Signature") != webhooks.Sign(receiverSecret, body) {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !failed {
+			failed = true
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		p := webhooks.Payload{}
+		json.Unmarshal(body, &p)
+		received <- p
+	}))
+	defer receiver.Close()
+	deadReceiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer deadReceiver.Close()
+	postWebhook := func(caller, body string) *http.Response {
+		req, err := http.NewRequest("POST", server.URL+"/webhooks", strings.NewReader(body))
+		checkErr("making http request", err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Auth-User", caller)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr("making http request", err)
+		return resp
+	}
+	resp = postWebhook("", `{"url": "`+receiver.URL+`", "events": ["visit.created"]}`)
+	checkStatus("POSTing a webhook anonymously", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = postWebhook("analytics", `{"url": "`+receiver.URL+`", "events": ["visit.moved"]}`)
+	checkStatus("POSTing an invalid webhook", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	resp = postWebhook("analytics", `{"url": "`+receiver.URL+`", "events": ["visit.created"], "user": "hooked"}`)
+	checkStatus("POSTing a webhook", resp, http.StatusOK)
+	hook := &webhooks.Webhook{}
+	checkErr("parsing webhook response body", json.NewDecoder(resp.Body).Decode(hook))
+	resp.Body.Close()
+	if hook.Secret == "" {
+		t.Fatal("expected a created webhook to include its secret")
+	}
+	receiverSecret = hook.Secret
+	resp = postWebhook("analytics", `{"url": "`+deadReceiver.URL+`", "events": ["visit.created"], "user": "hooked"}`)
+	checkStatus("POSTing a webhook", resp, http.StatusOK)
+	deadHook := &webhooks.Webhook{}
+	checkErr("parsing webhook response body", json.NewDecoder(resp.Body).Decode(deadHook))
+	resp.Body.Close()
+	// Events are relayed to webhooks from the outbox.
+	go oc.Tail(hub)
+	go wc.Deliver()
+	for _, body := range []string{
+		`{"city": "Raleigh", "state": "NC", "private": true}`,
+		`{"city": "Durham", "state": "NC"}`,
+	} {
+		resp, err = postAs("hooked", server.URL+"/users/hooked/visits", strings.NewReader(body))
+		checkErr("making http request", err)
+		checkStatus("POSTing a valid visit", resp, http.StatusOK)
+		resp.Body.Close()
+	}
+	select {
+	case p := <-received:
+		// The private visit is not delivered.
+		if p.Event != webhooks.EventVisitCreated || p.Visit == nil || p.Visit.City != "Durham" {
+			t.Fatalf("expected a delivery of the visit to Durham, got %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a webhook delivery")
+	}
+	getDeliveries := func(webhookId, query string) []webhooks.Delivery {
+		resp := getAs("analytics", "/webhooks/"+webhookId+"/deliveries"+query)
+		checkStatus("GETing webhook deliveries", resp, http.StatusOK)
+		body := &struct {
+			Deliveries []webhooks.Delivery `json:"deliveries"`
+		}{}
+		checkErr("parsing deliveries response body", json.NewDecoder(resp.Body).Decode(body))
+		resp.Body.Close()
+		return body.Deliveries
+	}
+	var dels []webhooks.Delivery
+	for i := 0; i < 50; i++ {
+		dels = getDeliveries(hook.ID, "")
+		if len(dels) == 1 && dels[0].Status == webhooks.StatusDelivered {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(dels) != 1 || dels[0].Status != webhooks.StatusDelivered || dels[0].Attempts != 2 {
+		t.Fatalf("expected 1 delivery after a retry, got %+v", dels)
+	}
+	for i := 0; i < 50; i++ {
+		dels = getDeliveries(deadHook.ID, "?status=dead")
+		if len(dels) == 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(dels) != 1 || dels[0].Attempts != 3 || dels[0].LastStatus != http.StatusInternalServerError {
+		t.Fatalf("expected 1 dead delivery after 3 attempts, got %+v", dels)
+	}
+	resp = getAs("someone", "/webhooks/"+hook.ID+"/deliveries")
+	checkStatus("GETing another caller's webhook deliveries", resp, http.StatusNotFound)
+	resp.Body.Close()
+	resp = followAs("DELETE", "analytics", "/webhooks/"+deadHook.ID)
+	checkStatus("DELETEing a webhook", resp, http.StatusNoContent)
+	resp.Body.Close()
+
+	// Test the outbox, which every visit event has been relayed from. The
+	// file sink holds every event in order, including those recorded before
+	// relaying started.
+	var fileEvents []visits.Event
+	for i := 0; i < 50; i++ {
+		js, err := ioutil.ReadFile(eventFile.Name())
+		checkErr("reading event file", err)
+		fileEvents = fileEvents[:0]
+		for _, line := range strings.Split(strings.TrimSpace(string(js)), "\n") {
+			e := visits.Event{}
+			checkErr("parsing event file", json.Unmarshal([]byte(line), &e))
+			fileEvents = append(fileEvents, e)
+		}
+		if last := fileEvents[len(fileEvents)-1]; last.Visit != nil && last.Visit.City == "Durham" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if fileEvents[0].Type != visits.EventCreated || fileEvents[0].Visit.City != "Raleigh" {
+		t.Fatalf("expected the first event to be the first visit added, got %+v", fileEvents[0])
+	}
+	deleted := false
+	for _, e := range fileEvents {
+		deleted = deleted || (e.Type == visits.EventDeleted && e.Visit.ID == maineVisitID)
+	}
+	if !deleted {
+		t.Fatal("expected deleting a visit to be recorded in the outbox")
+	}
+	unsent := -1
+	for i := 0; i < 50 && unsent != 0; i++ {
+		unsent, err = oc.Unsent(fs.Name())
+		checkErr("counting unsent events", err)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if unsent != 0 {
+		t.Fatalf("expected every event to have been sent to the file sink, %d are left", unsent)
+	}
+	// Resuming an event stream catches up from the outbox.
+	eventsResp, err := http.Get(server.URL + "/stream/events?after=" + fileEvents[0].ID)
+	checkErr("making http request", err)
+	defer eventsResp.Body.Close()
+	events := bufio.NewScanner(eventsResp.Body)
+	resumed := &visits.Event{}
+	for events.Scan() {
+		if line := events.Text(); strings.HasPrefix(line, "data: ") {
+			checkErr("parsing streamed event", json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), resumed))
+			break
+		}
+	}
+	if resumed.ID != fileEvents[1].ID {
+		t.Fatalf("expected a resumed stream to start with event %q, got %q", fileEvents[1].ID, resumed.ID)
+	}
+
+	// Test the gRPC API, which shares the service layer with the REST API.
+	gs := grpc.NewServer()
+	grpcapi.NewServer(grpcapi.Config{
+		Service: service.New(service.Config{
+			VisitsClient: vc,
+			LocsClient:   lc,
+			TripsClient:  tc,
+			SummsClient:  sc,
+			ProfsClient:  pc,
+			SocialClient: fc,
+		}),
+		Events: hub,
+	}).Register(gs)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	checkErr("listening for grpc traffic", err)
+	go gs.Serve(lis)
+	defer gs.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	checkErr("dialing grpc server", err)
+	defer conn.Close()
+	gc := visitspb.NewVisitsClient(conn)
+	gopherCtx := metadata.AppendToOutgoingContext(context.Background(), "x-auth-user", "gopher")
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	watcher, err := gc.WatchVisits(watchCtx, &visitspb.WatchVisitsRequest{User: "gopher"})
+	checkErr("watching visits over grpc", err)
+	// Give the server a moment to start watching.
+	time.Sleep(100 * time.Millisecond)
+	_, err = gc.AddVisit(context.Background(), &visitspb.AddVisitRequest{
+		User:  "gopher",
+		Visit: &visitspb.Visit{City: "Raleigh", State: "nc"},
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected an anonymous visit to be denied, got %v", err)
+	}
+	added, err := gc.AddVisit(gopherCtx, &visitspb.AddVisitRequest{
+		User:  "gopher",
+		Visit: &visitspb.Visit{City: "Raleigh", State: "nc"},
+	})
+	checkErr("adding a visit over grpc", err)
+	if added.Id == "" || added.State != "NC" || added.Timestamp == nil {
+		t.Fatalf("expected an added visit with an id, an uppercase state & a timestamp, got %+v", added)
+	}
+	watched, err := watcher.Recv()
+	checkErr("receiving a watched visit", err)
+	if watched.Id != added.Id {
+		t.Fatalf("expected to watch visit %q, got %q", added.Id, watched.Id)
+	}
+	_, err = gc.AddVisit(gopherCtx, &visitspb.AddVisitRequest{
+		User:  "gopher",
+		Visit: &visitspb.Visit{City: "Nowhere", State: "ZZ"},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an invalid visit to be rejected, got %v", err)
+	}
+	gStates, err := gc.ListVisitedStates(context.Background(), &visitspb.ListVisitedStatesRequest{User: "gopher"})
+	checkErr("listing visited states over grpc", err)
+	if fmt.Sprint(gStates.States) != "[NC]" {
+		t.Fatalf("expected gopher to have visited NC, got %v", gStates.States)
+	}
+	gCities, err := gc.ListCities(context.Background(), &visitspb.ListCitiesRequest{State: "NC"})
+	checkErr("listing cities over grpc", err)
+	if len(gCities.Cities) != 2 {
+		t.Fatalf("expected 2 cities in NC, got %v", gCities.Cities)
+	}
+	_, err = gc.ListVisits(context.Background(), &visitspb.ListVisitsRequest{User: "recluse"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected listing a followers-only user's visits to be denied, got %v", err)
+	}
+	fanCtx := metadata.AppendToOutgoingContext(context.Background(), "x-auth-user", "fan")
+	_, err = gc.ListVisits(fanCtx, &visitspb.ListVisitsRequest{User: "hermit", Sort: "bogus"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an invalid query to be rejected, got %v", err)
+	}
+	// Only gopher may delete their visits, & only through their own user.
+	_, err = gc.DeleteVisit(context.Background(), &visitspb.DeleteVisitRequest{User: "gopher", Visit: added.Id})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected an anonymous delete to be denied, got %v", err)
+	}
+	_, err = gc.DeleteVisit(fanCtx, &visitspb.DeleteVisitRequest{User: "fan", Visit: added.Id})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected deleting another user's visit to be not found, got %v", err)
+	}
+	_, err = gc.DeleteVisit(gopherCtx, &visitspb.DeleteVisitRequest{User: "gopher", Visit: added.Id})
+	checkErr("deleting a visit over grpc", err)
+	gVisits, err := gc.ListVisits(context.Background(), &visitspb.ListVisitsRequest{User: "gopher"})
+	checkErr("listing visits over grpc", err)
+	if len(gVisits.Visits) != 0 {
+		t.Fatalf("expected a deleted visit to be gone, got %+v", gVisits.Visits)
+	}
+
+	// Test the GraphQL API. A subscription is started before visits are
+	// added & a single query then reads them back with their cities, states
+	// & stats.
+	subResp, err := http.Get(server.URL + "/stream/graphql?query=" + url.QueryEscape(
+		`subscription { visitAdded(user: "grapher") { id city { name } state { abbr } } }`,
+	))
+	checkErr("making http request", err)
+	defer subResp.Body.Close()
+	// Give the server a moment to subscribe.
+	time.Sleep(100 * time.Millisecond)
+	// The last visit is back-dated so that it is not a duplicate.
+	for _, body := range []string{
+		`{"city": "Raleigh", "state": "NC"}`,
+		`{"city": "Charlotte", "state": "NC"}`,
+		`{"city": "Raleigh", "state": "NC", "timestamp": "2016-01-01T00:00:00Z"}`,
+	} {
+		resp, err = postAs("grapher", server.URL+"/users/grapher/visits", strings.NewReader(body))
+		checkErr("making http request", err)
+		checkStatus("POSTing a visit", resp, http.StatusOK)
+		resp.Body.Close()
+	}
+	subscribed := struct {
+		Data struct {
+			VisitAdded struct {
+				ID   string
+				City struct{ Name string }
+			}
+		}
+	}{}
+	sub := bufio.NewScanner(subResp.Body)
+	for sub.Scan() {
+		if line := sub.Text(); strings.HasPrefix(line, "data: ") {
+			checkErr("parsing subscription result", json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &subscribed))
+			break
+		}
+	}
+	if subscribed.Data.VisitAdded.ID == "" || subscribed.Data.VisitAdded.City.Name != "Raleigh" {
+		t.Fatalf("expected to be sent the first added visit, got %+v", subscribed)
+	}
+	resp, err = http.Post(server.URL+"/graphql", "application/json", strings.NewReader(`{
+		"query": "query($id: ID!) { user(id: $id) { visits(sort: \"timestamp\") { city { id name } state { abbr name } } states { abbr } stats { visits cities } } }",
+		"variables": {"id": "grapher"}
+	}`))
+	checkErr("making http request", err)
+	checkStatus("POSTing a GraphQL query", resp, http.StatusOK)
+	queried := struct {
+		Data struct {
+			User struct {
+				Visits []struct {
+					City  struct{ ID, Name string }
+					State struct{ Abbr, Name string }
+				}
+				States []struct{ Abbr string }
+				Stats  struct{ Visits, Cities int }
+			}
+		}
+		Errors []interface{}
+	}{}
+	checkErr("decoding response", json.NewDecoder(resp.Body).Decode(&queried))
+	resp.Body.Close()
+	gUser := queried.Data.User
+	if len(queried.Errors) != 0 || len(gUser.Visits) != 3 {
+		t.Fatalf("expected 3 visits without errors, got %+v", queried)
+	}
+	if gUser.Visits[2].City.ID != "Charlotte,NC" || gUser.Visits[2].State.Name != "North Carolina" {
+		t.Fatalf("expected the last visit to be to Charlotte, North Carolina, got %+v", gUser.Visits[2])
+	}
+	if len(gUser.States) != 1 || gUser.Stats.Visits != 3 || gUser.Stats.Cities != 2 {
+		t.Fatalf("expected 3 visits to 2 cities in 1 state, got %+v", gUser)
+	}
+	// Privacy is enforced like the REST API, reporting the error's kind.
+	resp = getAs("", "/graphql?query="+url.QueryEscape(`{ user(id: "recluse") { id } }`))
+	checkStatus("GETing a GraphQL query", resp, http.StatusOK)
+	denied := struct {
+		Data struct {
+			User *struct{ ID string }
+		}
+		Errors []struct {
+			Extensions struct{ Code string }
+		}
+	}{}
+	checkErr("decoding response", json.NewDecoder(resp.Body).Decode(&denied))
+	resp.Body.Close()
+	if denied.Data.User != nil || len(denied.Errors) != 1 || denied.Errors[0].Extensions.Code != "FORBIDDEN" {
+		t.Fatalf("expected a followers-only user to be forbidden, got %+v", denied)
+	}
+	// Nested lists of visits count towards a single limit per query.
+	resp = getAs("", "/graphql?query="+url.QueryEscape(
+		`{ user(id: "grapher") { visits(limit: 1000) { user { visits(limit: 1000) { user { visits(limit: 1000) { id } } } } } } }`,
+	))
+	checkStatus("GETing a nested GraphQL query", resp, http.StatusOK)
+	nested := struct {
+		Errors []struct {
+			Extensions struct{ Code string }
+		}
+	}{}
+	checkErr("decoding response", json.NewDecoder(resp.Body).Decode(&nested))
+	resp.Body.Close()
+	if len(nested.Errors) == 0 || nested.Errors[0].Extensions.Code != "INVALID" {
+		t.Fatalf("expected a query listing too many visits to be invalid, got %+v", nested)
+	}
+
+	// Test the Go client, paging through visits one at a time.
+	bc := client.NewClient(client.Config{
+		URL:           server.URL,
+		User:          "sdk",
+		ReconnectWait: 10 * time.Millisecond,
+	})
+	watchCtx, stopWatching = context.WithCancel(context.Background())
+	defer stopWatching()
+	sdkWatched := make(chan visits.Visit, 1)
+	go func() {
+		var v visits.Visit
+		w := bc.Watch(watchCtx)
+		for w.Next(&v) {
+			if v.User == "sdk" {
+				sdkWatched <- v
+				return
+			}
+		}
+	}()
+	// Give the watcher a moment to connect.
+	time.Sleep(100 * time.Millisecond)
+	for _, city := range []string{"Raleigh", "Charlotte", "Durham"} {
+		_, err := bc.AddVisit(context.Background(), "sdk", &visits.Visit{City: city, State: "NC"})
+		checkErr("adding a visit with the client", err)
+	}
+	select {
+	case v := <-sdkWatched:
+		if v.City != "Raleigh" {
+			t.Fatalf("expected to watch the first visit added, got %+v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the client to watch an added visit")
+	}
+	var listed []visits.Visit
+	var v visits.Visit
+	it := bc.ListVisits(context.Background(), "sdk", client.ListQuery{PageSize: 1})
+	for it.Next(&v) {
+		listed = append(listed, v)
+	}
+	checkErr("listing visits with the client", it.Err())
+	if len(listed) != 3 || listed[1].City != "Charlotte" {
+		t.Fatalf("expected 3 visits in the order added, got %+v", listed)
+	}
+	checkErr("deleting a visit with the client", bc.DeleteVisit(context.Background(), "sdk", listed[0].ID))
+	sdkCities, err := bc.VisitedCities(context.Background(), "sdk")
+	checkErr("getting visited cities with the client", err)
+	sdkStates, err := bc.VisitedStates(context.Background(), "sdk")
+	checkErr("getting visited states with the client", err)
+	if len(sdkCities) != 2 || fmt.Sprint(sdkStates) != "[North Carolina]" {
+		t.Fatalf("expected 2 cities in North Carolina, got %v in %v", sdkCities, sdkStates)
+	}
+	ncCities, err := bc.CitiesInState(context.Background(), "NC")
+	checkErr("getting cities with the client", err)
+	if len(ncCities) != 2 || ncCities[0].State != "NC" {
+		t.Fatalf("expected 2 cities in NC, got %+v", ncCities)
+	}
+	_, err = bc.AddVisit(context.Background(), "sdk", &visits.Visit{City: "Nowhere"})
+	if e, ok := err.(*client.Error); !ok || e.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an invalid visit to be a 400 error, got %v", err)
+	}
+	_, err = bc.CitiesInState(context.Background(), "ZZ")
+	if !client.IsNotFound(err) {
+		t.Fatalf("expected an unknown state to be a 404 error, got %v", err)
+	}
+
+	// The visit deleted with the client is in the trash, only for its user,
+	// & can be restored.
+	resp = followAs("GET", "fan", "/users/sdk/visits/trash")
+	checkStatus("GETing another user's trash", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = followAs("GET", "sdk", "/users/sdk/visits/trash")
+	checkStatus("GETing the trash", resp, http.StatusOK)
+	trash := struct {
+		Visits []visits.Visit `json:"visits"`
+	}{}
+	checkErr("decoding response", json.NewDecoder(resp.Body).Decode(&trash))
+	resp.Body.Close()
+	if len(trash.Visits) != 1 || trash.Visits[0].ID != listed[0].ID || trash.Visits[0].DeletedAt == nil {
+		t.Fatalf("expected the deleted visit in the trash, got %+v", trash.Visits)
+	}
+	// The client's IP is the last address forwarded by the trusted proxy,
+	// whatever the client claims before it.
+	req, err = http.NewRequest("POST", server.URL+"/users/sdk/visits/"+listed[0].ID+":restore", nil)
+	checkErr("making http request", err)
+	req.Header.Set("X-Auth-User", "sdk")
+	req.Header.Set("X-Forwarded-For", "10.6.6.6, 203.0.113.7")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr("making http request", err)
+	checkStatus("POSTing a visit restore", resp, http.StatusOK)
+	restoreReq := resp.Header.Get(handler.RequestIDHeader)
+	resp.Body.Close()
+	resp = followAs("POST", "sdk", "/users/sdk/visits/"+listed[0].ID+":restore")
+	checkStatus("POSTing a restore of a visit which is not deleted", resp, http.StatusNotFound)
+	resp.Body.Close()
+	sdkCities, err = bc.VisitedCities(context.Background(), "sdk")
+	checkErr("getting visited cities with the client", err)
+	if len(sdkCities) != 3 {
+		t.Fatalf("expected a restored visit to be counted again, got %v", sdkCities)
+	}
+
+	// Every change to a visit is in its history, only for its user & admins.
+	resp = followAs("GET", "fan", "/users/sdk/visits/"+listed[0].ID+"/history")
+	checkStatus("GETing the history of another user's visit", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = followAs("GET", "sdk", "/users/sdk/visits/nope/history")
+	checkStatus("GETing the history of a missing visit", resp, http.StatusNotFound)
+	resp.Body.Close()
+	resp = followAs("GET", "auditor", "/users/sdk/visits/"+listed[0].ID+"/history")
+	checkStatus("GETing a visit history as an admin", resp, http.StatusOK)
+	resp.Body.Close()
+	// Changes are audited once the relay collects them.
+	history := struct {
+		History []visits.AuditEntry `json:"history"`
+	}{}
+	for i := 0; i < 50 && len(history.History) < 3; i++ {
+		resp = followAs("GET", "sdk", "/users/sdk/visits/"+listed[0].ID+"/history")
+		checkStatus("GETing a visit history", resp, http.StatusOK)
+		checkErr("decoding response", json.NewDecoder(resp.Body).Decode(&history))
+		resp.Body.Close()
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(history.History) != 3 ||
+		history.History[0].Action != visits.EventCreated ||
+		history.History[1].Action != visits.EventDeleted ||
+		history.History[2].Action != visits.EventRestored {
+		t.Fatalf("expected a visit to have been created, deleted & restored, got %+v", history.History)
+	}
+	if created := history.History[0]; created.Before != nil || created.After == nil || created.After.City != listed[0].City {
+		t.Fatalf("expected the created visit to only be recorded after, got %+v", created)
+	}
+	if deleted := history.History[1]; deleted.After == nil || deleted.After.DeletedAt == nil {
+		t.Fatalf("expected the deleted visit to be recorded as in the trash, got %+v", deleted)
+	}
+	if by := history.History[2].Actor; by.User != "sdk" || restoreReq == "" || by.RequestID != restoreReq || by.IP != "203.0.113.7" {
+		t.Fatalf("expected the restore to be made by sdk at 203.0.113.7 in request %q, got %+v", restoreReq, by)
+	}
+	// The audit log of every visit is only for admins.
+	since := url.QueryEscape(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	resp = followAs("GET", "sdk", "/audit?user=sdk")
+	checkStatus("GETing the audit log as a non-admin", resp, http.StatusForbidden)
+	resp.Body.Close()
+	resp = followAs("GET", "auditor", "/audit?action=visit.moved")
+	checkStatus("GETing the audit log of an unknown action", resp, http.StatusBadRequest)
+	resp.Body.Close()
+	resp = followAs("GET", "auditor", "/audit?user=sdk&actor=sdk&action=visit.restored&from="+since)
+	checkStatus("GETing the audit log", resp, http.StatusOK)
+	audit := struct {
+		Entries []visits.AuditEntry `json:"entries"`
+	}{}
+	checkErr("decoding response", json.NewDecoder(resp.Body).Decode(&audit))
+	resp.Body.Close()
+	if len(audit.Entries) != 1 || audit.Entries[0].Visit != listed[0].ID {
+		t.Fatalf("expected the restore of %s in the audit log, got %+v", listed[0].ID, audit.Entries)
+	}
+	resp = followAs("GET", "auditor", "/audit?user=sdk&to=2000-01-01")
+	checkStatus("GETing the audit log", resp, http.StatusOK)
+	audit.Entries = nil
+	checkErr("decoding response", json.NewDecoder(resp.Body).Decode(&audit))
+	resp.Body.Close()
+	if len(audit.Entries) != 0 {
+		t.Fatalf("expected no changes before 2000 in the audit log, got %+v", audit.Entries)
+	}
+	// Purging only removes visits which have been deleted for longer than
+	// the retention.
+	checkErr("deleting a visit with the client", bc.DeleteVisit(context.Background(), "sdk", listed[2].ID))
+	purger := service.New(service.Config{
+		VisitsClient: vc,
+		LocsClient:   lc,
+		TripsClient:  tc,
+		SummsClient:  sc,
+		ProfsClient:  pc,
+		SocialClient: fc,
+	})
+	purged, err := purger.PurgeVisits(time.Hour)
+	checkErr("purging deleted visits", err)
+	if purged != 0 {
+		t.Fatalf("expected recently deleted visits to be kept, purged %d", purged)
+	}
+	purged, err = purger.PurgeVisits(0)
+	checkErr("purging deleted visits", err)
+	if purged == 0 {
+		t.Fatal("expected deleted visits to be purged")
+	}
+	resp = followAs("POST", "sdk", "/users/sdk/visits/"+listed[2].ID+":restore")
+	checkStatus("POSTing a restore of a purged visit", resp, http.StatusNotFound)
+	resp.Body.Close()
+
+	// Back up the db & restore a deleted visit from the archive.
+	bkc := backup.NewClient(backup.Config{
+		VisitsTable: conf.VisitsTable,
+		CitiesTable: conf.CitiesTable,
+	}, sess)
+	archive := &bytes.Buffer{}
+	backedUp, err := bkc.Backup(archive)
+	checkErr("backing up the db", err)
+	totalVisits, err := r.Table(conf.VisitsTable).Count().Run(sess)
+	checkErr("counting visits", err)
+	var visitCount int
+	checkErr("counting visits", totalVisits.One(&visitCount))
+	if backedUp[backup.TableVisits].Rows != visitCount || backedUp[backup.TableCities].Rows == 0 {
+		t.Fatalf("expected %d visits & some cities to be backed up, got %+v", visitCount, backedUp)
+	}
+	_, err = r.Table(conf.VisitsTable).Get(listed[1].ID).Delete().RunWrite(sess)
+	checkErr("deleting a visit", err)
+	restored, err := bkc.Restore(bytes.NewReader(archive.Bytes()), backup.ConflictSkip)
+	checkErr("restoring the db", err)
+	if st := restored[backup.TableVisits]; st.Inserted != 1 || st.Skipped != visitCount-1 {
+		t.Fatalf("expected 1 visit to be restored & the rest skipped, got %+v", st)
+	}
+	restoredVisit := visits.Visit{}
+	checkErr("getting a restored visit", r.Table(conf.VisitsTable).Get(listed[1].ID).ReadOne(&restoredVisit, sess))
+	if restoredVisit.City != "Charlotte" || !restoredVisit.Timestamp.Equal(listed[1].Timestamp) {
+		t.Fatalf("expected the deleted visit to be restored, got %+v", restoredVisit)
+	}
+	restored, err = bkc.Restore(bytes.NewReader(archive.Bytes()), backup.ConflictOverwrite)
+	checkErr("restoring the db", err)
+	if st := restored[backup.TableVisits]; st.Overwrote != visitCount {
+		t.Fatalf("expected every visit to be overwritten, got %+v", st)
+	}
+	// Archives from newer versions of the service are refused.
+	future := &bytes.Buffer{}
+	gz := gzip.NewWriter(future)
+	fmt.Fprintf(gz, `{"format":%q,"version":%d}`+"\n", backup.Format, backup.Version+1)
+	gz.Close()
+	if _, err := bkc.Restore(future, backup.ConflictSkip); err == nil {
+		t.Fatal("expected an archive of a newer version to be refused")
+	}
+}
+
+// TestRoutesInSpec fails when a registered route is missing from the api spec,
+// so that the two can not drift apart.
+func TestRoutesInSpec(t *testing.T) {
+	spec, err := loadSpec("")
+	if err != nil {
+		t.Fatalf("failure: loading api spec: %s", err.Error())
+	}
+	hdlr := handler.New(handler.Config{Logger: log, Spec: spec})
+	params := regexp.MustCompile(`/:(\w+)`)
+	for _, rt := range hdlr.Routes() {
+		// "/users/:user/visits" -> "/users/{user}/visits"
+		path := params.ReplaceAllString(rt.Path, "/{$1}")
+		if !spec.Has(rt.Method, path) {
+			t.Errorf("route %s %s is missing from the api spec", rt.Method, path)
+		}
+	}
+	if len(hdlr.Routes()) == 0 {
+		t.Fatal("expected routes to be registered")
+	}
+	// Specs with constraints which are not validated are refused.
+	for _, schema := range []string{`{"type": "string", "minLength": 1}`, `{"type": "string", "format": "email"}`} {
+		_, err := openapi.Parse([]byte(`{"openapi": "3.0.0", "components": {"schemas": {"S": ` + schema + `}}}`))
+		if err == nil {
+			t.Errorf("expected a spec with the schema %s to be refused", schema)
+		}
+	}
 }
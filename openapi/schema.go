@@ -0,0 +1,163 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
+// keywords are the keywords of a schema which are supported. Schemas with any
+// other keyword are refused when decoded, rather than leaving constraints
+// which are not validated.
+var keywords = map[string]bool{
+	"$ref":                 true,
+	"description":          true,
+	"type":                 true,
+	"format":               true,
+	"nullable":             true,
+	"enum":                 true,
+	"minimum":              true,
+	"maximum":              true,
+	"pattern":              true,
+	"required":             true,
+	"properties":           true,
+	"additionalProperties": true,
+	"items":                true,
+}
+
+// Schema is the subset of an OpenAPI schema object which is validated:
+// types, formats ("date-time"), enums, bounds, patterns, required &
+// nested properties and array items.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+
+	// pattern is Pattern, compiled when the schema is resolved.
+	pattern *regexp.Regexp
+}
+
+// UnmarshalJSON decodes a schema, returning an error when it uses a keyword
+// or format which is not supported.
+func (s *Schema) UnmarshalJSON(js []byte) error {
+	type schema Schema
+	if err := json.Unmarshal(js, (*schema)(s)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(js, &fields); err != nil {
+		return err
+	}
+	for key := range fields {
+		if !keywords[key] {
+			return fmt.Errorf("unsupported schema keyword: %q", key)
+		}
+	}
+	if s.Format != "" && s.Format != "date-time" {
+		return fmt.Errorf("unsupported schema format: %q", s.Format)
+	}
+	return nil
+}
+
+// Validate returns a non-nil error when a value decoded from JSON does not
+// match the schema. The error names the offending field, starting at name.
+func (s *Schema) Validate(name string, v interface{}) error {
+	if s == nil {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: must not be null", name)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an object", name)
+		}
+		for _, req := range s.Required {
+			if _, ok := obj[req]; !ok {
+				return fmt.Errorf("%s.%s: is required", name, req)
+			}
+		}
+		for key, val := range obj {
+			prop, ok := s.Properties[key]
+			if !ok {
+				prop = s.AdditionalProperties
+			}
+			if err := prop.Validate(name+"."+key, val); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an array", name)
+		}
+		for i, item := range arr {
+			if err := s.Items.Validate(fmt.Sprintf("%s[%d]", name, i), item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", name)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: must be an RFC 3339 time", name)
+			}
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			return fmt.Errorf("%s: must match %s", name, s.Pattern)
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%s: must be a number", name)
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%s: must be an integer", name)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%s: must be at least %v", name, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Errorf("%s: must be at most %v", name, *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: must be a boolean", name)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return fmt.Errorf("%s: must be one of %v", name, s.Enum)
+		}
+		for _, e := range s.Enum {
+			if e == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: must be one of %v", name, s.Enum)
+	}
+	return nil
+}
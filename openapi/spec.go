@@ -0,0 +1,276 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Spec is an OpenAPI 3 document. Only the parts which are used to match &
+// validate requests are decoded, while Raw holds the whole document.
+type Spec struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+	Raw []byte `json:"-"`
+
+	templates []template
+}
+
+// PathItem holds the operations of a single path.
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+}
+
+// Operation returns the operation of an http method, or nil when the path
+// does not have one.
+func (p *PathItem) Operation(method string) *Operation {
+	switch method {
+	case "GET":
+		return p.Get
+	case "PUT":
+		return p.Put
+	case "POST":
+		return p.Post
+	case "DELETE":
+		return p.Delete
+	case "PATCH":
+		return p.Patch
+	}
+	return nil
+}
+
+// Operation describes a single method of a path.
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path, query or header parameter of an operation.
+type Parameter struct {
+	Ref         string  `json:"$ref,omitempty"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the body of an operation's requests.
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response of an operation.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body of a given content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Load reads a Spec from a JSON file & resolves its references.
+func Load(path string) (*Spec, error) {
+	js, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read api spec: %s", err.Error())
+	}
+	return Parse(js)
+}
+
+// Parse decodes a Spec from JSON & resolves its references.
+func Parse(js []byte) (*Spec, error) {
+	sp := &Spec{Raw: js}
+	if err := json.Unmarshal(js, sp); err != nil {
+		return nil, fmt.Errorf("unable to parse api spec: %s", err.Error())
+	}
+	if !strings.HasPrefix(sp.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported api spec version: %q", sp.OpenAPI)
+	}
+	r := &resolver{spec: sp, done: make(map[*Schema]bool)}
+	for name, s := range sp.Components.Schemas {
+		if err := r.schema(&s); err != nil {
+			return nil, err
+		}
+		sp.Components.Schemas[name] = s
+	}
+	for path, item := range sp.Paths {
+		for _, op := range []*Operation{item.Get, item.Put, item.Post, item.Delete, item.Patch} {
+			if op == nil {
+				continue
+			}
+			if err := r.operation(op); err != nil {
+				return nil, fmt.Errorf("invalid api spec path %s: %s", path, err.Error())
+			}
+		}
+		sp.templates = append(sp.templates, parseTemplate(path))
+	}
+	// Match literal segments before parameters, like the router does.
+	sort.Slice(sp.templates, func(i, j int) bool {
+		return sp.templates[i].literals > sp.templates[j].literals
+	})
+	return sp, nil
+}
+
+// Find returns the operation which serves a request's method & path along
+// with the values of its path parameters. A nil Operation is returned when
+// the spec does not describe the request.
+func (sp *Spec) Find(method, path string) (*Operation, map[string]string) {
+	segs := strings.Split(path, "/")
+	for _, t := range sp.templates {
+		params, ok := t.match(segs)
+		if !ok {
+			continue
+		}
+		if op := sp.Paths[t.path].Operation(method); op != nil {
+			return op, params
+		}
+	}
+	return nil, nil
+}
+
+// Has reports whether the spec describes a method of a path template (ie:
+// "/users/{user}/visits").
+func (sp *Spec) Has(method, path string) bool {
+	item, ok := sp.Paths[path]
+	return ok && item.Operation(method) != nil
+}
+
+// template is a parsed path such as "/users/{user}/visits".
+type template struct {
+	path     string
+	segs     []string
+	literals int
+}
+
+func parseTemplate(path string) template {
+	t := template{path: path, segs: strings.Split(path, "/")}
+	for _, s := range t.segs {
+		// Parameters followed by a custom method (ie: "{visit}:restore")
+		// are as specific as literals.
+		if _, suffix, ok := splitParam(s); !ok || suffix != "" {
+			t.literals++
+		}
+	}
+	return t
+}
+
+// splitParam splits a path segment into the name of its parameter & any
+// literal suffix (ie: "{visit}:restore" -> "visit", ":restore"). ok is false
+// for literal segments.
+func splitParam(seg string) (name, suffix string, ok bool) {
+	end := strings.Index(seg, "}")
+	if !strings.HasPrefix(seg, "{") || end < 0 {
+		return "", "", false
+	}
+	return seg[1:end], seg[end+1:], true
+}
+
+func (t template) match(segs []string) (map[string]string, bool) {
+	if len(segs) != len(t.segs) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, s := range t.segs {
+		name, suffix, ok := splitParam(s)
+		switch {
+		case ok && len(segs[i]) > len(suffix) && strings.HasSuffix(segs[i], suffix):
+			params[name] = strings.TrimSuffix(segs[i], suffix)
+		case ok || s != segs[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// resolver replaces references ("$ref") with the components they refer to.
+type resolver struct {
+	spec *Spec
+	done map[*Schema]bool
+}
+
+func (r *resolver) operation(op *Operation) error {
+	for i, p := range op.Parameters {
+		if p.Ref != "" {
+			name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+			ref, ok := r.spec.Components.Parameters[name]
+			if !ok {
+				return fmt.Errorf("unknown reference: %s", p.Ref)
+			}
+			op.Parameters[i] = ref
+			p = ref
+		}
+		if err := r.schema(&p.Schema); err != nil {
+			return err
+		}
+	}
+	if op.RequestBody != nil {
+		for _, mt := range op.RequestBody.Content {
+			if err := r.schema(&mt.Schema); err != nil {
+				return err
+			}
+		}
+	}
+	for _, rsp := range op.Responses {
+		for _, mt := range rsp.Content {
+			if err := r.schema(&mt.Schema); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// schema resolves a schema in place, along with every schema it contains.
+func (r *resolver) schema(s **Schema) error {
+	if *s == nil {
+		return nil
+	}
+	if ref := (*s).Ref; ref != "" {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		target, ok := r.spec.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("unknown reference: %s", ref)
+		}
+		*s = target
+	}
+	if r.done[*s] {
+		return nil
+	}
+	r.done[*s] = true
+	if (*s).Pattern != "" {
+		re, err := regexp.Compile((*s).Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %s", err.Error())
+		}
+		(*s).pattern = re
+	}
+	for name := range (*s).Properties {
+		p := (*s).Properties[name]
+		if err := r.schema(&p); err != nil {
+			return err
+		}
+		(*s).Properties[name] = p
+	}
+	if err := r.schema(&(*s).Items); err != nil {
+		return err
+	}
+	return r.schema(&(*s).AdditionalProperties)
+}
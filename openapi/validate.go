@@ -0,0 +1,128 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ValidateRequest returns a non-nil error when a request's parameters or
+// JSON body do not match the operation. Other bodies (ie: XML) are only
+// checked for presence. The body is replaced so that it can be read again.
+func (op *Operation) ValidateRequest(req *http.Request, params map[string]string) error {
+	query := req.URL.Query()
+	for _, p := range op.Parameters {
+		var val string
+		var ok bool
+		switch p.In {
+		case "path":
+			val, ok = params[p.Name]
+		case "query":
+			val, ok = query.Get(p.Name), query.Get(p.Name) != ""
+		case "header":
+			val, ok = req.Header.Get(p.Name), req.Header.Get(p.Name) != ""
+		}
+		if !ok {
+			if p.Required {
+				return fmt.Errorf("%s: is required", p.Name)
+			}
+			continue
+		}
+		if err := p.validate(val); err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return fmt.Errorf("body: unable to read: %s", err.Error())
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return fmt.Errorf("body: is required")
+		}
+		return nil
+	}
+	mt, ok := op.RequestBody.Content["application/json"]
+	if !ok || !isJSON(req.Header.Get("Content-Type")) {
+		return nil
+	}
+	return validateJSON(mt.Schema, body)
+}
+
+// ValidateResponse returns a non-nil error when a response's status code is
+// not described by the operation or its JSON body does not match.
+func (op *Operation) ValidateResponse(status int, header http.Header, body []byte) error {
+	rsp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if rsp, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("undocumented status code: %d", status)
+		}
+	}
+	mt, ok := rsp.Content["application/json"]
+	if !ok || !isJSON(header.Get("Content-Type")) || len(body) == 0 {
+		return nil
+	}
+	return validateJSON(mt.Schema, body)
+}
+
+// Streams reports whether the operation responds with a stream of Server Sent
+// Events, which can not be validated.
+func (op *Operation) Streams() bool {
+	for _, rsp := range op.Responses {
+		if _, ok := rsp.Content["text/event-stream"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks a parameter's value after converting it to the type of
+// its schema.
+func (p *Parameter) validate(val string) error {
+	if p.Schema == nil {
+		return nil
+	}
+	var v interface{} = val
+	switch p.Schema.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("%s: must be a number", p.Name)
+		}
+		v = n
+	case "boolean":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%s: must be a boolean", p.Name)
+		}
+		v = b
+	}
+	return p.Schema.Validate(p.Name, v)
+}
+
+func validateJSON(s *Schema, body []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("body: invalid json: %s", err.Error())
+	}
+	return s.Validate("body", v)
+}
+
+// isJSON reports whether a content type is JSON. Requests without a content
+// type are decoded as JSON by default.
+func isJSON(contentType string) bool {
+	return contentType == "" || strings.Contains(contentType, "json")
+}
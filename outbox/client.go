@@ -0,0 +1,292 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// batchSize is the most changes collected or events relayed at once.
+const batchSize = 100
+
+var (
+	ErrNotFound = errors.New("no such event")
+)
+
+// Sink is a destination which the relay publishes outbox events to.
+type Sink interface {
+	// Name identifies the sink's queue of events, so it must not change
+	// across restarts.
+	Name() string
+	// Publish is called with each event in the order they were recorded,
+	// except that an event whose write was slow to commit may follow events
+	// which were recorded after it. An event is published again (along with
+	// those after it) when a non-nil error is returned.
+	Publish(e *visits.Event) error
+}
+
+// Source holds changes which are recorded along with the writes that made
+// them, such as visits.Client.
+type Source interface {
+	// Collect passes the events of up to limit of the source's writes to
+	// add, & forgets them once add succeeds. The number of writes collected
+	// is returned.
+	Collect(add func(events []visits.Event) error, limit int) (int, error)
+}
+
+// queued is a db structure queueing an event to be published to a sink.
+// Queued events are ordered by (Created, ID) for each sink.
+type queued struct {
+	ID      string        `gorethink:"id"`
+	Sink    string        `gorethink:"sink"`
+	Event   *visits.Event `gorethink:"event"`
+	Created time.Time     `gorethink:"created"`
+}
+
+// Client acts as an api to reading the outbox of visit events & relaying
+// them to sinks.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table string
+	// QueueTable holds the events which are yet to be published to each
+	// sink.
+	QueueTable string
+	// Source is where events are collected from into the outbox. It is
+	// required by Run.
+	Source Source
+	Sinks  []Sink
+	// PollInterval is how often the source is checked for new events. It
+	// defaults to 1 second.
+	PollInterval time.Duration
+	// Retention is how long events are kept in the outbox. It defaults to 7
+	// days.
+	Retention time.Duration
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	if conf.Retention <= 0 {
+		conf.Retention = 7 * 24 * time.Hour
+	}
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// Get retrieves a single event from the outbox.
+func (c *Client) Get(eventId string) (*visits.Event, error) {
+	result, err := r.Table(c.config.Table).Get(eventId).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get event: %s", err.Error())
+	}
+	e := &visits.Event{}
+	if !result.Next(e) {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// GetEvents gets up to limit events in order, starting after the given event
+// (or from the oldest event when nil).
+func (c *Client) GetEvents(after *visits.Event, limit int) ([]visits.Event, error) {
+	lower := []interface{}{r.MinVal, r.MinVal}
+	if after != nil {
+		lower = []interface{}{after.Created, after.ID}
+	}
+	result, err := r.Table(c.config.Table).Between(
+		lower,
+		[]interface{}{r.MaxVal, r.MaxVal},
+		r.BetweenOpts{Index: "created_id", LeftBound: "open"},
+	).OrderBy(r.OrderByOpts{Index: "created_id"}).Limit(limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get events: %s", err.Error())
+	}
+	return readEvents(result)
+}
+
+func readEvents(result *r.Cursor) ([]visits.Event, error) {
+	events := make([]visits.Event, 0)
+	var e visits.Event
+	for result.Next(&e) {
+		events = append(events, e)
+		e = visits.Event{}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read events: %s", err.Error())
+	}
+	return events, nil
+}
+
+// Unsent counts the events which are yet to be published to a sink.
+func (c *Client) Unsent(sink string) (int, error) {
+	var n int
+	err := r.Table(c.config.QueueTable).Between(
+		[]interface{}{sink, r.MinVal, r.MinVal},
+		[]interface{}{sink, r.MaxVal, r.MaxVal},
+		r.BetweenOpts{Index: "sink_created"},
+	).Count().ReadOne(&n, c.session)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count unsent events: %s", err.Error())
+	}
+	return n, nil
+}
+
+// Run collects events from the source into the outbox, relays them to every
+// sink at least once (see Sink), and removes events which are past their
+// retention. Every event is queued for each sink until it has been
+// published, so no events are missed across restarts, however long a write
+// takes to commit. It blocks until an error occurs, though a failing sink
+// does not hold up the other sinks.
+func (c *Client) Run() error {
+	for {
+		for {
+			n, err := c.config.Source.Collect(c.add, batchSize)
+			if err != nil {
+				return fmt.Errorf("unable to collect events: %s", err.Error())
+			}
+			if n < batchSize {
+				break
+			}
+		}
+		var failed error
+		for _, s := range c.config.Sinks {
+			if err := c.relay(s); err != nil && failed == nil {
+				failed = err
+			}
+		}
+		if failed != nil {
+			return failed
+		}
+		cutoff := r.Now().Sub(c.config.Retention.Seconds())
+		_, err := r.Table(c.config.Table).Between(
+			[]interface{}{r.MinVal, r.MinVal},
+			[]interface{}{cutoff, r.MinVal},
+			r.BetweenOpts{Index: "created_id"},
+		).Delete().RunWrite(c.session)
+		if err != nil {
+			return fmt.Errorf("unable to remove old events: %s", err.Error())
+		}
+		_, err = r.Table(c.config.QueueTable).Between(
+			r.MinVal, cutoff, r.BetweenOpts{Index: "created"},
+		).Delete().RunWrite(c.session)
+		if err != nil {
+			return fmt.Errorf("unable to remove old queued events: %s", err.Error())
+		}
+		time.Sleep(c.config.PollInterval)
+	}
+}
+
+// add adds collected events to the outbox & queues them for every sink.
+// Events which are collected again replace themselves.
+func (c *Client) add(events []visits.Event) error {
+	q := make([]queued, 0, len(events)*len(c.config.Sinks))
+	for i := range events {
+		for _, s := range c.config.Sinks {
+			q = append(q, queued{
+				ID:      s.Name() + "/" + events[i].ID,
+				Sink:    s.Name(),
+				Event:   &events[i],
+				Created: events[i].Created,
+			})
+		}
+	}
+	if _, err := r.Table(c.config.Table).Insert(events, r.InsertOpts{Conflict: "replace"}).RunWrite(c.session); err != nil {
+		return fmt.Errorf("unable to add events to the outbox: %s", err.Error())
+	}
+	if len(q) == 0 {
+		return nil
+	}
+	if _, err := r.Table(c.config.QueueTable).Insert(q, r.InsertOpts{Conflict: "replace"}).RunWrite(c.session); err != nil {
+		return fmt.Errorf("unable to queue events: %s", err.Error())
+	}
+	return nil
+}
+
+// relay publishes the events queued for a sink, removing them from its queue
+// as it goes.
+func (c *Client) relay(s Sink) error {
+	for {
+		result, err := r.Table(c.config.QueueTable).Between(
+			[]interface{}{s.Name(), r.MinVal, r.MinVal},
+			[]interface{}{s.Name(), r.MaxVal, r.MaxVal},
+			r.BetweenOpts{Index: "sink_created"},
+		).OrderBy(r.OrderByOpts{Index: "sink_created"}).Limit(batchSize).Run(c.session)
+		if err != nil {
+			return fmt.Errorf("unable to get queued events: %s", err.Error())
+		}
+		q := make([]queued, 0)
+		var e queued
+		for result.Next(&e) {
+			q = append(q, e)
+			e = queued{}
+		}
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("unable to read queued events: %s", err.Error())
+		}
+		for i := range q {
+			if err := s.Publish(q[i].Event); err != nil {
+				// Save the progress made before the failure.
+				if err := c.dequeue(q[:i]); err != nil {
+					return err
+				}
+				return fmt.Errorf("unable to publish event to %s: %s", s.Name(), err.Error())
+			}
+		}
+		if err := c.dequeue(q); err != nil {
+			return err
+		}
+		if len(q) < batchSize {
+			return nil
+		}
+	}
+}
+
+// dequeue removes published events from their sink's queue.
+func (c *Client) dequeue(q []queued) error {
+	if len(q) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(q))
+	for i := range q {
+		ids[i] = q[i].ID
+	}
+	if _, err := r.Table(c.config.QueueTable).GetAll(ids...).Delete().RunWrite(c.session); err != nil {
+		return fmt.Errorf("unable to dequeue events: %s", err.Error())
+	}
+	return nil
+}
+
+// Tail publishes events to a hub as they are added to the outbox, so that
+// every instance of the service streams every event to its own
+// subscribers. Events which were added before tailing started are not
+// published. It blocks until an error occurs.
+func (c *Client) Tail(h *Hub) error {
+	cursor, err := r.Table(c.config.Table).Changes().
+		Filter(r.Row.Field("old_val").Eq(nil)).Field("new_val").Run(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to open outbox change-feed: %s", err.Error())
+	}
+	defer cursor.Close()
+	// Subscribers are sent pointers, so each event is decoded afresh.
+	e := &visits.Event{}
+	for cursor.Next(e) {
+		h.Publish(e)
+		e = &visits.Event{}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("outbox change-feed closed: %s", err.Error())
+	}
+	return errors.New("outbox change-feed closed")
+}
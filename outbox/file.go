@@ -0,0 +1,51 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// FileSink is a Sink which appends events to a file as newline delimited JSON
+// (NDJSON).
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (or creates) a file to append events to.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open event file: %s", err.Error())
+	}
+	return &FileSink{file: f}, nil
+}
+
+// Name returns the name of the FileSink's queue.
+func (fs *FileSink) Name() string {
+	return "file"
+}
+
+// Publish appends an event to the file as a single line, syncing it to disk
+// before the event is dequeued.
+func (fs *FileSink) Publish(e *visits.Event) error {
+	js, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("unable to marshal event into json: %s", err.Error())
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, err := fs.file.Write(append(js, '\n')); err != nil {
+		return fmt.Errorf("unable to write event: %s", err.Error())
+	}
+	return fs.file.Sync()
+}
+
+// Close closes the file.
+func (fs *FileSink) Close() error {
+	return fs.file.Close()
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"sync"
+
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// hubBuffer is the number of events which may be waiting to be sent to each
+// subscriber.
+const hubBuffer = 64
+
+// Hub fans the events added to the outbox out to in-memory subscribers, such
+// as Server Sent Events (SSE) connections (see Client.Tail). Every instance
+// of the service has its own.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[chan *visits.Event]bool
+}
+
+// NewHub returns a new instance of Hub.
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[chan *visits.Event]bool),
+	}
+}
+
+// Publish sends an event to every subscriber. Subscribers which have fallen
+// too far behind are closed rather than holding up the others, and are
+// expected to resume from the last event they received (see
+// Client.GetEvents).
+func (h *Hub) Publish(e *visits.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel of published events along with a function to
+// unsubscribe. The channel is closed when unsubscribing or when the
+// subscriber falls too far behind.
+func (h *Hub) Subscribe() (<-chan *visits.Event, func()) {
+	ch := make(chan *visits.Event, hubBuffer)
+	h.mu.Lock()
+	h.subs[ch] = true
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.subs[ch] {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// Visibility settings control who may read a user's visits.
+const (
+	// VisibilityPublic profiles are readable by anyone.
+	VisibilityPublic = "public"
+	// VisibilityFollowers profiles are readable by the user & their
+	// followers.
+	VisibilityFollowers = "followers"
+	// VisibilityPrivate profiles are only readable by the user.
+	VisibilityPrivate = "private"
+)
+
+// Profile is a db structure describing a user & who may see their visits.
+type Profile struct {
+	User        string `json:"user" xml:"user" gorethink:"id"`
+	DisplayName string `json:"display_name" xml:"display_name" gorethink:"display_name"`
+	Visibility  string `json:"visibility" xml:"visibility" gorethink:"visibility"`
+	// LeaderboardOptOut leaves the user out of every leaderboard.
+	LeaderboardOptOut bool `json:"leaderboard_opt_out" xml:"leaderboard_opt_out" gorethink:"leaderboard_opt_out"`
+}
+
+// Client acts as an api to retreiving user profiles from a db.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table string
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// Validate returns a non-nil error when it has been passed an invalid
+// Profile entity.
+func (c *Client) Validate(p *Profile) error {
+	switch p.Visibility {
+	case VisibilityPublic, VisibilityFollowers, VisibilityPrivate:
+	case "":
+		return errors.New("missing 'visibility' field")
+	default:
+		return fmt.Errorf("'visibility' must be one of %q, %q or %q",
+			VisibilityPublic, VisibilityFollowers, VisibilityPrivate)
+	}
+	if len(p.DisplayName) > 100 {
+		return errors.New("'display_name' must not be longer than 100 characters")
+	}
+	return nil
+}
+
+// Get retrieves a user's Profile from the database. Users who have not saved
+// a profile are given a public one so that they remain world-readable.
+func (c *Client) Get(userId string) (*Profile, error) {
+	result, err := r.Table(c.config.Table).Get(userId).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get profile: %s", err.Error())
+	}
+	p := &Profile{}
+	if !result.Next(p) {
+		return &Profile{
+			User:        userId,
+			DisplayName: userId,
+			Visibility:  VisibilityPublic,
+		}, nil
+	}
+	return p, nil
+}
+
+// Put inserts or replaces a user's Profile.
+func (c *Client) Put(p *Profile) error {
+	_, err := r.Table(c.config.Table).Insert(p, r.InsertOpts{Conflict: "replace"}).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to save profile: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	r "github.com/dancannon/gorethink"
+)
+
+// table describes a database table and the secondary indexes that the
+// service expects to exist on it.
+type table struct {
+	name    string
+	indexes []index
+}
+
+// index describes a secondary index. When fn is nil, a simple index on the
+// field matching the index name is created. The version must be increased
+// whenever the index is redefined, so that existing databases rebuild it.
+type index struct {
+	name    string
+	fn      func(r.Term) interface{}
+	multi   bool
+	version int
+}
+
+// schema returns the full list of tables & indexes used by the service. The
+// visit timestamp indexes end with the primary key so that visits with equal
+// timestamps still have a stable order to page through (since version 1).
+func schema(conf Config) []table {
+	return []table{
+		{
+			name: conf.VisitsTable,
+			indexes: []index{
+				{name: "user"},
+				{name: "user_timestamp", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("user"), row.Field("timestamp"), row.Field("id")}
+				}},
+				{name: "user_state_timestamp", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("user"), row.Field("state"), row.Field("timestamp"), row.Field("id")}
+				}},
+				{name: "user_state_city_timestamp", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("user"), row.Field("state"), row.Field("city"), row.Field("timestamp"), row.Field("id")}
+				}},
+				{name: "user_city_timestamp", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("user"), row.Field("city"), row.Field("timestamp"), row.Field("id")}
+				}},
+				{name: "trip_timestamp", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("trip"), row.Field("timestamp"), row.Field("id")}
+				}},
+				// Only deleted visits have a "deleted_at" field, so these
+				// indexes hold the trash.
+				{name: "deleted_at"},
+				{name: "user_deleted_at", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("user"), row.Field("deleted_at")}
+				}},
+				// Only visits with changes which are yet to be collected into
+				// the outbox are in this index, oldest change first.
+				{name: "pending", fn: func(row r.Term) interface{} {
+					return row.Field("pending_events").Nth(0).Field("created")
+				}},
+			},
+		},
+		{
+			name: conf.CitiesTable,
+			indexes: []index{
+				{name: "state"},
+			},
+		},
+		{
+			name: conf.SummsTable,
+			indexes: []index{
+				// Leaderboards only rank listed summaries (since version 1).
+				{name: "public_states", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("listed"), row.Field("public_states")}
+				}},
+				{name: "public_cities", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("listed"), row.Field("public_cities")}
+				}},
+				{name: "month_visits", version: 1, fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("listed"), row.Field("month"), row.Field("month_visits")}
+				}},
+			},
+		},
+		{
+			name: conf.ProfilesTable,
+		},
+		{
+			name: conf.FollowsTable,
+			indexes: []index{
+				{name: "follower_since", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("follower"), row.Field("since")}
+				}},
+				{name: "followee_since", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("followee"), row.Field("since")}
+				}},
+			},
+		},
+		{
+			name: conf.SharesTable,
+			indexes: []index{
+				{name: "user_expires", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("user"), row.Field("expires")}
+				}},
+			},
+		},
+		{
+			name: conf.AchievesTable,
+			indexes: []index{
+				{name: "user"},
+			},
+		},
+		{
+			name: conf.WebhooksTable,
+			indexes: []index{
+				{name: "owner"},
+				{name: "events", multi: true},
+			},
+		},
+		{
+			name: conf.DeliveriesTable,
+			indexes: []index{
+				{name: "status_next", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("status"), row.Field("next_attempt")}
+				}},
+				{name: "webhook_created", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("webhook"), row.Field("created")}
+				}},
+			},
+		},
+		{
+			name: conf.OutboxTable,
+			indexes: []index{
+				{name: "created_id", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("created"), row.Field("id")}
+				}},
+			},
+		},
+		{
+			name: conf.OutboxQueueTable,
+			indexes: []index{
+				{name: "created"},
+				{name: "sink_created", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("sink"), row.Field("created"), row.Field("id")}
+				}},
+			},
+		},
+		{
+			name: conf.AuditTable,
+			indexes: []index{
+				{name: "visit_time", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("visit"), row.Field("time"), row.Field("id")}
+				}},
+				{name: "time_id", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("time"), row.Field("id")}
+				}},
+			},
+		},
+		{
+			name: conf.TripsTable,
+			indexes: []index{
+				{name: "user"},
+				{name: "user_start", fn: func(row r.Term) interface{} {
+					return []interface{}{row.Field("user"), row.Field("start"), row.Field("id")}
+				}},
+				{name: "visits", multi: true},
+			},
+		},
+	}
+}
+
+// schemaVersion is a db structure recording the version of an index which
+// is in the database, so that migrating rebuilds it when its definition
+// changes. Its id is "table/index".
+type schemaVersion struct {
+	ID      string `gorethink:"id"`
+	Version int    `gorethink:"version"`
+}
+
+// migrateSchema creates any tables & indexes which are missing from the
+// currently selected database and rebuilds indexes whose version has changed
+// (see index), then waits for the indexes to be ready. It can be run against
+// a database of any earlier version of the service, and again at any time.
+func migrateSchema(sess *r.Session, conf Config) error {
+	tables := schema(conf)
+	existing := []string{}
+	if err := r.TableList().ReadAll(&existing, sess); err != nil {
+		return fmt.Errorf("unable to list tables: %s", err.Error())
+	}
+	for _, name := range append([]string{conf.SchemaTable}, tableNames(tables)...) {
+		if contains(existing, name) {
+			continue
+		}
+		log.WithField("table", name).Info("creating table")
+		if _, err := r.TableCreate(name).RunWrite(sess); err != nil {
+			return fmt.Errorf("unable to create table %s: %s", name, err.Error())
+		}
+	}
+
+	applied := []schemaVersion{}
+	if err := r.Table(conf.SchemaTable).ReadAll(&applied, sess); err != nil {
+		return fmt.Errorf("unable to read schema versions: %s", err.Error())
+	}
+	versions := make(map[string]int)
+	for _, v := range applied {
+		versions[v.ID] = v.Version
+	}
+	for _, t := range tables {
+		indexes := []string{}
+		if err := r.Table(t.name).IndexList().ReadAll(&indexes, sess); err != nil {
+			return fmt.Errorf("unable to list indexes of %s: %s", t.name, err.Error())
+		}
+		for _, idx := range t.indexes {
+			id := t.name + "/" + idx.name
+			// Indexes which were created before versions were recorded
+			// are at version 0.
+			if contains(indexes, idx.name) && versions[id] == idx.version {
+				continue
+			}
+			if contains(indexes, idx.name) {
+				err := rebuildIndex(sess, t.name, idx, contains(indexes, idx.name+rebuildSuffix))
+				if err != nil {
+					return err
+				}
+			} else if err := createIndex(sess, t.name, idx.name, idx); err != nil {
+				return err
+			}
+			_, err := r.Table(conf.SchemaTable).Insert(
+				schemaVersion{ID: id, Version: idx.version},
+				r.InsertOpts{Conflict: "replace"},
+			).RunWrite(sess)
+			if err != nil {
+				return fmt.Errorf("unable to record the version of index %s: %s", id, err.Error())
+			}
+		}
+	}
+	for _, t := range tables {
+		for _, idx := range t.indexes {
+			if _, err := r.Table(t.name).IndexWait(idx.name).Run(sess); err != nil {
+				return fmt.Errorf("unable to wait for index %s on %s: %s", idx.name, t.name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// rebuildSuffix names the copy of an index which is built while rebuilding
+// it.
+const rebuildSuffix = "_rebuild"
+
+// rebuildIndex replaces an index with its current definition. The new index
+// is built under another name & renamed over the old one once it is ready,
+// so that queries can keep using the old index in the meantime. A copy left
+// by an earlier rebuild which did not finish is dropped first.
+func rebuildIndex(sess *r.Session, tableName string, idx index, leftover bool) error {
+	tmp := idx.name + rebuildSuffix
+	if leftover {
+		if _, err := r.Table(tableName).IndexDrop(tmp).RunWrite(sess); err != nil {
+			return fmt.Errorf("unable to drop index %s on %s: %s", tmp, tableName, err.Error())
+		}
+	}
+	if err := createIndex(sess, tableName, tmp, idx); err != nil {
+		return err
+	}
+	if _, err := r.Table(tableName).IndexWait(tmp).Run(sess); err != nil {
+		return fmt.Errorf("unable to wait for index %s on %s: %s", tmp, tableName, err.Error())
+	}
+	log.WithFields(logrus.Fields{
+		"table": tableName,
+		"index": idx.name,
+	}).Info("replacing index on table")
+	_, err := r.Table(tableName).IndexRename(tmp, idx.name, r.IndexRenameOpts{Overwrite: true}).RunWrite(sess)
+	if err != nil {
+		return fmt.Errorf("unable to replace index %s on %s: %s", idx.name, tableName, err.Error())
+	}
+	return nil
+}
+
+// createIndex creates an index on a table under the given name.
+func createIndex(sess *r.Session, tableName, name string, idx index) error {
+	log.WithFields(logrus.Fields{
+		"table": tableName,
+		"index": name,
+	}).Info("creating index on table")
+	opts := r.IndexCreateOpts{Multi: idx.multi}
+	term := r.Table(tableName).IndexCreate(name, opts)
+	if idx.fn != nil {
+		term = r.Table(tableName).IndexCreateFunc(name, idx.fn, opts)
+	}
+	if _, err := term.RunWrite(sess); err != nil {
+		return fmt.Errorf("unable to create index %s on %s: %s", name, tableName, err.Error())
+	}
+	return nil
+}
+
+func tableNames(tables []table) []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.name
+	}
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
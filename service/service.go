@@ -0,0 +1,321 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nstogner/beenthere-ws/locations"
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/social"
+	"github.com/nstogner/beenthere-ws/summaries"
+	"github.com/nstogner/beenthere-ws/trips"
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// Kinds of errors which the APIs map to their own status codes. Errors of
+// any other kind are internal.
+const (
+	KindInvalid = iota + 1
+	KindForbidden
+	KindNotFound
+)
+
+// Error is returned when a request can not be served.
+type Error struct {
+	Kind int
+	Msg  string
+	// Reason explains why a request is invalid.
+	Reason string
+}
+
+func (e *Error) Error() string {
+	if e.Reason != "" {
+		return e.Msg + ": " + e.Reason
+	}
+	return e.Msg
+}
+
+// Service holds the validation, privacy & storage logic shared by the REST
+// (see handler) & gRPC (see grpcapi) APIs.
+type Service struct {
+	visits    *visits.Client
+	locations *locations.Client
+	trips     *trips.Client
+	summaries *summaries.Client
+	profiles  *profiles.Client
+	social    *social.Client
+	admins    map[string]bool
+}
+
+// Config is used to create a new instance of Service in New(...).
+type Config struct {
+	VisitsClient *visits.Client
+	LocsClient   *locations.Client
+	TripsClient  *trips.Client
+	SummsClient  *summaries.Client
+	ProfsClient  *profiles.Client
+	SocialClient *social.Client
+	// Admins are the users who may read the audit log of every user.
+	Admins []string
+}
+
+// New returns a new instance of Service.
+func New(conf Config) *Service {
+	s := &Service{
+		visits:    conf.VisitsClient,
+		locations: conf.LocsClient,
+		trips:     conf.TripsClient,
+		summaries: conf.SummsClient,
+		profiles:  conf.ProfsClient,
+		social:    conf.SocialClient,
+		admins:    make(map[string]bool),
+	}
+	for _, a := range conf.Admins {
+		if a != "" {
+			s.admins[a] = true
+		}
+	}
+	return s
+}
+
+// AddVisit validates & saves a visit for a user. A duplicate visit (see
+// visits.Client.FindDuplicate) is not saved, instead the given visit is
+// overwritten with the existing one.
+func (s *Service) AddVisit(by visits.Actor, userId string, visit *visits.Visit) error {
+	if by.User != userId {
+		return &Error{Kind: KindForbidden, Msg: "only a user may add their visits"}
+	}
+	if err := s.visits.Validate(visit); err != nil {
+		return &Error{Kind: KindInvalid, Msg: "invalid visit", Reason: err.Error()}
+	}
+	visit.User = userId
+	// Visits are added to trips through the trip routes.
+	visit.TripID = ""
+
+	// Check and see if the given State exists.
+	// TODO: How should City verification work?
+	//       Should a new visit be rejected if the given city doesnt exist in db?
+	//       Should unknown cities be accepted and verified offline?
+	city := locations.CityFromVisit(visit)
+	if err := s.locations.ValidateCity(city); err != nil {
+		return &Error{Kind: KindInvalid, Msg: "invalid visit", Reason: err.Error()}
+	}
+
+	if err := s.visits.Add(by, visit); err != nil {
+		return fmt.Errorf("unable to save user visit: %s", err.Error())
+	}
+	return nil
+}
+
+// DeleteVisit moves one of a user's visits to the trash. It is kept in its
+// trips (which leave it out) until it is purged, so that restoring it undoes
+// the delete.
+func (s *Service) DeleteVisit(by visits.Actor, userId, visitId string) error {
+	if by.User != userId {
+		return &Error{Kind: KindForbidden, Msg: "only a user may delete their visits"}
+	}
+	visit, err := s.visits.Get(visitId)
+	if err != nil {
+		return fmt.Errorf("unable to get user visit: %s", err.Error())
+	}
+	if visit == nil || visit.User != userId || visit.DeletedAt != nil {
+		return &Error{Kind: KindNotFound, Msg: "no such visit"}
+	}
+	if err := s.visits.Delete(by, visitId); err != nil {
+		return fmt.Errorf("unable to delete user visit: %s", err.Error())
+	}
+	return nil
+}
+
+// RestoreVisit takes one of a user's deleted visits back out of the trash &
+// returns it. The visit leaves its trip when it was removed from the trip
+// (or the trip was deleted) while it was in the trash.
+func (s *Service) RestoreVisit(by visits.Actor, userId, visitId string) (*visits.Visit, error) {
+	if by.User != userId {
+		return nil, &Error{Kind: KindForbidden, Msg: "only a user may restore their visits"}
+	}
+	visit, err := s.visits.Get(visitId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user visit: %s", err.Error())
+	}
+	if visit == nil || visit.User != userId || visit.DeletedAt == nil {
+		return nil, &Error{Kind: KindNotFound, Msg: "no such deleted visit"}
+	}
+	if err := s.visits.Restore(by, visitId); err != nil {
+		return nil, fmt.Errorf("unable to restore user visit: %s", err.Error())
+	}
+	visit.DeletedAt = nil
+	if visit.TripID != "" {
+		inTrip, err := s.inTrip(visit.TripID, visitId)
+		if err != nil {
+			return nil, err
+		}
+		if !inTrip {
+			if err := s.visits.SetTrip(by, []string{visitId}, ""); err != nil {
+				return nil, fmt.Errorf("unable to remove visit from trip: %s", err.Error())
+			}
+			visit.TripID = ""
+		}
+	}
+	return visit, nil
+}
+
+// inTrip reports whether a trip exists & lists a visit.
+func (s *Service) inTrip(tripId, visitId string) (bool, error) {
+	trip, err := s.trips.Get(tripId)
+	if err == trips.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get visit trip: %s", err.Error())
+	}
+	for _, id := range trip.Visits {
+		if id == visitId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Trash lists a user's deleted visits, most recently deleted first. Only the
+// user may list them.
+func (s *Service) Trash(caller, userId string, start, limit int) ([]visits.Visit, error) {
+	if caller != userId {
+		return nil, &Error{Kind: KindForbidden, Msg: "only a user may view their deleted visits"}
+	}
+	deleted, err := s.visits.GetTrash(userId, start, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get deleted visits: %s", err.Error())
+	}
+	return deleted, nil
+}
+
+// PurgeVisits permanently removes visits which were deleted longer than the
+// retention ago, along with them from any trips. The number of purged
+// visits is returned.
+func (s *Service) PurgeVisits(retention time.Duration) (int, error) {
+	purged, err := s.visits.Purge(time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	if err := s.trips.RemoveVisits(purged...); err != nil {
+		return 0, fmt.Errorf("unable to remove purged visits from trips: %s", err.Error())
+	}
+	return len(purged), nil
+}
+
+// ListVisits validates & runs a query of a user's visits.
+func (s *Service) ListVisits(q visits.Query) ([]visits.Visit, error) {
+	if err := q.Validate(); err != nil {
+		return nil, &Error{Kind: KindInvalid, Msg: "invalid query", Reason: err.Error()}
+	}
+	return s.visits.GetVisits(q)
+}
+
+// StatesVisited returns the unique list of state abbreviations visited by a
+// given user, preferring the user's projected summary unless it includes
+// private visits which must be hidden.
+func (s *Service) StatesVisited(userId string, public bool) ([]string, error) {
+	summary, err := s.summaries.Get(userId)
+	if err == summaries.ErrNotFound || (err == nil && public && summary.Private > 0) {
+		return s.visits.GetStates(userId, public)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return summary.States, nil
+}
+
+// CityNames returns the names of the known cities in a state.
+func (s *Service) CityNames(state string) ([]string, error) {
+	if s.locations.StateName(state) == "" {
+		return nil, &Error{Kind: KindNotFound, Msg: "no such state"}
+	}
+	return s.locations.GetCityNames(state)
+}
+
+// Viewer checks that the caller may read a given user's visits. Private
+// profiles are reported as not found so that their existence is not leaked,
+// while followers-only profiles are forbidden. The returned bool is true when
+// the caller is not the user, in which case private visits must be hidden.
+func (s *Service) Viewer(caller, userId string) (bool, error) {
+	if caller == userId {
+		return false, nil
+	}
+	p, err := s.profiles.Get(userId)
+	if err != nil {
+		return true, err
+	}
+	ok, err := s.CanView(caller, p)
+	if err != nil {
+		return true, err
+	}
+	if !ok {
+		if p.Visibility == profiles.VisibilityPrivate {
+			return true, &Error{Kind: KindNotFound, Msg: "no such user"}
+		}
+		return true, &Error{Kind: KindForbidden, Msg: "user's visits are only visible to followers"}
+	}
+	return true, nil
+}
+
+// CanView reports whether the caller may read the visits of the profile's
+// user.
+func (s *Service) CanView(caller string, p *profiles.Profile) (bool, error) {
+	switch {
+	case caller == p.User || p.Visibility == profiles.VisibilityPublic:
+		return true, nil
+	case caller != "" && p.Visibility == profiles.VisibilityFollowers:
+		return s.social.IsFollowing(caller, p.User)
+	}
+	return false, nil
+}
+
+// CanViewVisit reports whether the caller may see a single visit: either
+// their own, or a public visit of a user whose visits they may read.
+func (s *Service) CanViewVisit(caller string, v *visits.Visit) (bool, error) {
+	if v.User == caller {
+		return true, nil
+	}
+	if v.Private {
+		return false, nil
+	}
+	p, err := s.profiles.Get(v.User)
+	if err != nil {
+		return false, err
+	}
+	return s.CanView(caller, p)
+}
+
+// IsAdmin reports whether a caller is one of the configured admins.
+func (s *Service) IsAdmin(caller string) bool {
+	return s.admins[caller]
+}
+
+// VisitHistory gets the audit entries of one of a user's visits, oldest
+// first. Only the user & admins may read them.
+func (s *Service) VisitHistory(caller, userId, visitId string) ([]visits.AuditEntry, error) {
+	if caller != userId && !s.IsAdmin(caller) {
+		return nil, &Error{Kind: KindForbidden, Msg: "only a user (or an admin) may read the history of their visits"}
+	}
+	entries, err := s.visits.GetHistory(visitId)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].User != userId {
+		return nil, &Error{Kind: KindNotFound, Msg: "no such visit"}
+	}
+	return entries, nil
+}
+
+// Audit validates & runs a query of the audit log of every visit. Only
+// admins may run it.
+func (s *Service) Audit(caller string, q visits.AuditQuery) ([]visits.AuditEntry, error) {
+	if !s.IsAdmin(caller) {
+		return nil, &Error{Kind: KindForbidden, Msg: "only an admin may query the audit log"}
+	}
+	if err := q.Validate(); err != nil {
+		return nil, &Error{Kind: KindInvalid, Msg: "invalid query", Reason: err.Error()}
+	}
+	return s.visits.GetAudit(q)
+}
@@ -0,0 +1,179 @@
+package shares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// Scopes control how much of a user's visits a share exposes. Each scope
+// includes everything exposed by the ones before it.
+const (
+	// ScopeStates shares the visited states & maps.
+	ScopeStates = "states"
+	// ScopeCities also shares the visited cities.
+	ScopeCities = "cities"
+	// ScopeVisits also shares the full list of visits, days & stats.
+	ScopeVisits = "visits"
+)
+
+// MaxLifetime is the longest a share may last.
+const MaxLifetime = 365 * 24 * time.Hour
+
+var (
+	ErrNotFound = errors.New("no such share")
+	ErrExpired  = errors.New("share has expired")
+)
+
+// Share is a db structure granting read-only access to a user's visits to
+// anyone holding its token. Tokens are not stored, they are derived from the
+// share by signing it.
+type Share struct {
+	ID      string    `json:"id" xml:"id" gorethink:"id,omitempty"`
+	User    string    `json:"user" xml:"user" gorethink:"user"`
+	Scope   string    `json:"scope" xml:"scope" gorethink:"scope"`
+	Created time.Time `json:"created" xml:"created" gorethink:"created"`
+	Expires time.Time `json:"expires" xml:"expires" gorethink:"expires"`
+	Token   string    `json:"token,omitempty" xml:"token,omitempty" gorethink:"-"`
+}
+
+// Allows reports whether the share exposes the given scope.
+func (s *Share) Allows(scope string) bool {
+	return rank(s.Scope) >= rank(scope)
+}
+
+func rank(scope string) int {
+	switch scope {
+	case ScopeStates:
+		return 1
+	case ScopeCities:
+		return 2
+	case ScopeVisits:
+		return 3
+	}
+	return 0
+}
+
+// Client acts as an api to creating & verifying shares in a db.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table string
+	// Secret is used to sign share tokens.
+	Secret []byte
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// Validate returns a non-nil error when it has been passed an invalid Share
+// entity.
+func (c *Client) Validate(s *Share) error {
+	if rank(s.Scope) == 0 {
+		return fmt.Errorf("'scope' must be one of %q, %q or %q", ScopeStates, ScopeCities, ScopeVisits)
+	}
+	if !s.Expires.After(time.Now()) {
+		return errors.New("'expires' must be in the future")
+	}
+	if s.Expires.After(time.Now().Add(MaxLifetime)) {
+		return fmt.Errorf("'expires' must be within %v", MaxLifetime)
+	}
+	return nil
+}
+
+// Add inserts a new Share into the database and sets its token.
+func (c *Client) Add(s *Share) error {
+	s.Created = time.Now()
+	result, err := r.Table(c.config.Table).Insert(s).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to add share: %s", err.Error())
+	}
+	s.ID = result.GeneratedKeys[0]
+	s.Token = c.token(s)
+	return nil
+}
+
+// GetActive gets a user's unexpired shares, soonest to expire first.
+func (c *Client) GetActive(userId string) ([]Share, error) {
+	result, err := r.Table(c.config.Table).Between(
+		[]interface{}{userId, time.Now()},
+		[]interface{}{userId, r.MaxVal},
+		r.BetweenOpts{Index: "user_expires"},
+	).OrderBy(r.OrderByOpts{Index: "user_expires"}).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get shares: %s", err.Error())
+	}
+	shares := make([]Share, 0)
+	var s Share
+	for result.Next(&s) {
+		s.Token = c.token(&s)
+		shares = append(shares, s)
+		s = Share{}
+	}
+	return shares, nil
+}
+
+// Revoke deletes one of a user's shares, invalidating its token.
+// ErrNotFound is returned if the user has no such share.
+func (c *Client) Revoke(userId, shareId string) error {
+	result, err := r.Table(c.config.Table).Get(shareId).Run(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to get share: %s", err.Error())
+	}
+	var s Share
+	if !result.Next(&s) || s.User != userId {
+		return ErrNotFound
+	}
+	if _, err := r.Table(c.config.Table).Get(shareId).Delete().RunWrite(c.session); err != nil {
+		return fmt.Errorf("unable to revoke share: %s", err.Error())
+	}
+	return nil
+}
+
+// Verify returns the Share which a token was issued for. ErrNotFound is
+// returned for forged or revoked tokens & ErrExpired for expired ones.
+func (c *Client) Verify(token string) (*Share, error) {
+	i := strings.Index(token, ".")
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	result, err := r.Table(c.config.Table).Get(token[:i]).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get share: %s", err.Error())
+	}
+	s := &Share{}
+	if !result.Next(s) {
+		return nil, ErrNotFound
+	}
+	if !hmac.Equal([]byte(token), []byte(c.token(s))) {
+		return nil, ErrNotFound
+	}
+	if !s.Expires.After(time.Now()) {
+		return nil, ErrExpired
+	}
+	s.Token = token
+	return s, nil
+}
+
+// token signs a share. Signing every field means a token only grants what
+// it was issued for, even if the stored share is later tampered with.
+func (c *Client) token(s *Share) string {
+	mac := hmac.New(sha256.New, c.config.Secret)
+	fmt.Fprintf(mac, "%s|%s|%s|%d", s.ID, s.User, s.Scope, s.Expires.Unix())
+	return s.ID + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,217 @@
+package social
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+var (
+	ErrSelfFollow = errors.New("users may not follow themselves")
+	ErrNotFound   = errors.New("no such follow")
+)
+
+// Statuses of a Follow. Only accepted follows grant access to a followee's
+// followers-only visits.
+const (
+	// StatusPending follows wait for the followee's approval.
+	StatusPending = "pending"
+	// StatusAccepted follows were approved by the followee, or were made
+	// while the followee's profile was public.
+	StatusAccepted = "accepted"
+)
+
+// Follow is a db structure recording that one user follows another. Its id is
+// derived from both users so that following twice is harmless.
+type Follow struct {
+	ID       string    `json:"-" xml:"-" gorethink:"id"`
+	Follower string    `json:"follower" xml:"follower" gorethink:"follower"`
+	Followee string    `json:"followee" xml:"followee" gorethink:"followee"`
+	Status   string    `json:"status" xml:"status" gorethink:"status"`
+	Since    time.Time `json:"since" xml:"since" gorethink:"since"`
+	// Approved is set once the followee approves the follow, so that it is
+	// kept when the followee's profile stops being public.
+	Approved bool `json:"-" xml:"-" gorethink:"approved"`
+}
+
+// status reads the status of a follow row. Follows recorded before follows
+// needed approval are pending.
+func status(row r.Term) r.Term {
+	return row.Field("status").Default(StatusPending)
+}
+
+// followId returns the id of the Follow between two users.
+func followId(follower, followee string) string {
+	return follower + "/" + followee
+}
+
+// Client acts as an api to retreiving & maintaining the follow graph in a db.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table string
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// Follow records that follower follows followee, accepted straight away when
+// accept is true & pending the followee's approval otherwise. Following a
+// user who is already followed keeps the original follow.
+func (c *Client) Follow(follower, followee string, accept bool) (*Follow, error) {
+	if follower == followee {
+		return nil, ErrSelfFollow
+	}
+	f := &Follow{
+		ID:       followId(follower, followee),
+		Follower: follower,
+		Followee: followee,
+		Status:   StatusPending,
+		Since:    time.Now(),
+	}
+	if accept {
+		f.Status = StatusAccepted
+	}
+	_, err := r.Table(c.config.Table).Insert(f).RunWrite(c.session)
+	if r.IsConflictErr(err) {
+		return c.get(follower, followee)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to follow user: %s", err.Error())
+	}
+	return f, nil
+}
+
+// Unfollow removes the Follow between two users, if any.
+func (c *Client) Unfollow(follower, followee string) error {
+	_, err := r.Table(c.config.Table).Get(followId(follower, followee)).Delete().RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to unfollow user: %s", err.Error())
+	}
+	return nil
+}
+
+// Approve accepts a pending follow of followee by follower. ErrNotFound is
+// returned when follower has not asked to follow followee.
+func (c *Client) Approve(followee, follower string) (*Follow, error) {
+	res, err := r.Table(c.config.Table).Get(followId(follower, followee)).Update(map[string]interface{}{
+		"status":   StatusAccepted,
+		"approved": true,
+	}).RunWrite(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to approve follow: %s", err.Error())
+	}
+	if res.Skipped > 0 {
+		return nil, ErrNotFound
+	}
+	return c.get(follower, followee)
+}
+
+// RequireApproval makes the follows of a user which were accepted without
+// the user's approval pending again. It is called when a profile stops being
+// public, so that only approved followers keep their access.
+func (c *Client) RequireApproval(followee string) error {
+	_, err := r.Table(c.config.Table).Between(
+		[]interface{}{followee, r.MinVal},
+		[]interface{}{followee, r.MaxVal},
+		r.BetweenOpts{Index: "followee_since"},
+	).Filter(r.Row.Field("approved").Default(false).Not()).Update(map[string]interface{}{
+		"status": StatusPending,
+	}).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to require follow approval: %s", err.Error())
+	}
+	return nil
+}
+
+// IsFollowing reports whether follower follows followee & the follow is
+// accepted.
+func (c *Client) IsFollowing(follower, followee string) (bool, error) {
+	f, err := c.get(follower, followee)
+	if err != nil {
+		return false, err
+	}
+	return f != nil && f.Status == StatusAccepted, nil
+}
+
+func (c *Client) get(follower, followee string) (*Follow, error) {
+	result, err := r.Table(c.config.Table).Get(followId(follower, followee)).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get follow: %s", err.Error())
+	}
+	f := &Follow{}
+	if !result.Next(f) {
+		return nil, nil
+	}
+	if f.Status == "" {
+		f.Status = StatusPending
+	}
+	return f, nil
+}
+
+// GetFollowers gets the users following a given user with a given status,
+// most recent first.
+func (c *Client) GetFollowers(userId, status string, start, limit int) ([]Follow, error) {
+	return c.list("followee_since", userId, status, start, limit)
+}
+
+// GetFollowing gets the users followed by a given user with a given status,
+// most recent first.
+func (c *Client) GetFollowing(userId, status string, start, limit int) ([]Follow, error) {
+	return c.list("follower_since", userId, status, start, limit)
+}
+
+func (c *Client) list(index, userId, st string, start, limit int) ([]Follow, error) {
+	result, err := r.Table(c.config.Table).Between(
+		[]interface{}{userId, r.MinVal},
+		[]interface{}{userId, r.MaxVal},
+		r.BetweenOpts{Index: index},
+	).OrderBy(r.OrderByOpts{Index: r.Desc(index)}).Filter(func(row r.Term) r.Term {
+		return status(row).Eq(st)
+	}).Slice(start, start+limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get follows: %s", err.Error())
+	}
+	follows := make([]Follow, 0)
+	var f Follow
+	for result.Next(&f) {
+		if f.Status == "" {
+			f.Status = StatusPending
+		}
+		follows = append(follows, f)
+		f = Follow{}
+	}
+	return follows, nil
+}
+
+// FollowingIDs returns every user followed by a given user with an accepted
+// follow.
+func (c *Client) FollowingIDs(userId string) ([]string, error) {
+	result, err := r.Table(c.config.Table).Between(
+		[]interface{}{userId, r.MinVal},
+		[]interface{}{userId, r.MaxVal},
+		r.BetweenOpts{Index: "follower_since"},
+	).Filter(func(row r.Term) r.Term {
+		return status(row).Eq(StatusAccepted)
+	}).Field("followee").Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get follows: %s", err.Error())
+	}
+	ids := make([]string, 0)
+	var id string
+	for result.Next(&id) {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
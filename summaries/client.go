@@ -0,0 +1,267 @@
+package summaries
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+var (
+	ErrNotFound = errors.New("no such summary")
+)
+
+// Leaderboards rank users by a count in their summaries. Each is served by a
+// secondary index of the same name, which only ranks listed summaries.
+const (
+	// BoardStates ranks users by distinct states visited.
+	BoardStates = "states"
+	// BoardCities ranks users by distinct cities visited.
+	BoardCities = "cities"
+	// BoardMonth ranks users by visits in the current (UTC) month.
+	BoardMonth = "month"
+)
+
+// Summary is a db structure which is projected from a user's visits so that
+// reads do not need to aggregate over every visit.
+type Summary struct {
+	User      string         `json:"user" xml:"user" gorethink:"id"`
+	States    []string       `json:"states" xml:"states" gorethink:"states"`
+	Cities    map[string]int `json:"cities" xml:"cities" gorethink:"cities"`
+	Visits    int            `json:"visits" xml:"visits" gorethink:"visits"`
+	LastVisit *time.Time     `json:"last_visit,omitempty" xml:"last_visit,omitempty" gorethink:"last_visit,omitempty"`
+	// Private is the number of private visits which are counted in the
+	// summary. Summaries with private visits are only shown to their user.
+	Private int `json:"private" xml:"private" gorethink:"private"`
+	// Leaderboard counts leave out private visits. MonthVisits counts the
+	// visits in Month ("YYYY-MM"), the month of the most recent visit.
+	PublicStates int    `json:"public_states" xml:"public_states" gorethink:"public_states"`
+	PublicCities int    `json:"public_cities" xml:"public_cities" gorethink:"public_cities"`
+	Month        string `json:"month,omitempty" xml:"month,omitempty" gorethink:"month,omitempty"`
+	MonthVisits  int    `json:"month_visits" xml:"month_visits" gorethink:"month_visits"`
+	// Listed & DisplayName are copied from the user's profile, so that
+	// leaderboards can be read without looking up every profile. Only users
+	// with public profiles who have not opted out of leaderboards are
+	// listed.
+	Listed      bool   `json:"listed" xml:"listed" gorethink:"listed"`
+	DisplayName string `json:"display_name" xml:"display_name" gorethink:"display_name"`
+}
+
+// Score returns the count which a leaderboard ranks the summary by.
+func (s *Summary) Score(board string) int {
+	switch board {
+	case BoardStates:
+		return s.PublicStates
+	case BoardCities:
+		return s.PublicCities
+	case BoardMonth:
+		if s.Month == time.Now().UTC().Format("2006-01") {
+			return s.MonthVisits
+		}
+	}
+	return 0
+}
+
+// CityNames returns the unique, sorted list of city names in the summary.
+func (s *Summary) CityNames() []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for id := range s.Cities {
+		name := id
+		if i := strings.LastIndex(id, ","); i >= 0 {
+			name = id[:i]
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Client acts as an api to retreiving & maintaining user summaries in a db.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table    string
+	Visits   *visits.Client
+	Profiles *profiles.Client
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// Get retrieves a user's Summary from the database. ErrNotFound is returned
+// if no summary has been projected for the user.
+func (c *Client) Get(userId string) (*Summary, error) {
+	result, err := r.Table(c.config.Table).Get(userId).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get summary: %s", err.Error())
+	}
+	s := &Summary{}
+	if !result.Next(s) {
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// Rebuild regenerates a user's Summary from their visits & profile, so it is
+// needed whenever either changes. Summaries are always rebuilt rather than
+// incrementally patched so that replaying a change (ie: from multiple service
+// instances) is harmless.
+func (c *Client) Rebuild(userId string) error {
+	totals, err := c.config.Visits.GetTotals(userId, false)
+	if err != nil {
+		return err
+	}
+	if len(totals.Cities) == 0 {
+		_, err := r.Table(c.config.Table).Get(userId).Delete().RunWrite(c.session)
+		if err != nil {
+			return fmt.Errorf("unable to delete summary: %s", err.Error())
+		}
+		return nil
+	}
+
+	s := &Summary{
+		User:      userId,
+		States:    totals.States(),
+		Cities:    totals.Cities,
+		LastVisit: totals.LastVisit,
+		Private:   totals.Private,
+	}
+	for _, n := range totals.Cities {
+		s.Visits += n
+	}
+	p, err := c.config.Profiles.Get(userId)
+	if err != nil {
+		return err
+	}
+	s.DisplayName = p.DisplayName
+	s.Listed = p.Visibility == profiles.VisibilityPublic && !p.LeaderboardOptOut
+
+	public := totals
+	if totals.Private > 0 {
+		if public, err = c.config.Visits.GetTotals(userId, true); err != nil {
+			return err
+		}
+	}
+	s.PublicStates = len(public.States())
+	s.PublicCities = len(public.Cities)
+	if public.LastVisit != nil {
+		s.Month = public.LastVisit.UTC().Format("2006-01")
+		s.MonthVisits = public.Months[s.Month]
+	}
+
+	_, err = r.Table(c.config.Table).Insert(s, r.InsertOpts{Conflict: "replace"}).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to save summary: %s", err.Error())
+	}
+	return nil
+}
+
+// Top gets listed summaries in leaderboard order, highest first. Only users
+// with a non-zero score are included.
+func (c *Client) Top(board string, start, limit int) ([]Summary, error) {
+	var term r.Term
+	switch board {
+	case BoardStates, BoardCities:
+		term = r.Table(c.config.Table).Between(
+			[]interface{}{true, 1},
+			[]interface{}{true, r.MaxVal},
+			r.BetweenOpts{Index: "public_" + board},
+		).OrderBy(r.OrderByOpts{Index: r.Desc("public_" + board)})
+	case BoardMonth:
+		month := time.Now().UTC().Format("2006-01")
+		term = r.Table(c.config.Table).Between(
+			[]interface{}{true, month, 1},
+			[]interface{}{true, month, r.MaxVal},
+			r.BetweenOpts{Index: "month_visits"},
+		).OrderBy(r.OrderByOpts{Index: r.Desc("month_visits")})
+	default:
+		return nil, fmt.Errorf("no such leaderboard: %s", board)
+	}
+	result, err := term.Slice(start, start+limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get leaderboard: %s", err.Error())
+	}
+	return readAll(result)
+}
+
+// GetMany gets the summaries of the given users. Users without a summary are
+// skipped.
+func (c *Client) GetMany(userIds []string) ([]Summary, error) {
+	if len(userIds) == 0 {
+		return make([]Summary, 0), nil
+	}
+	keys := make([]interface{}, len(userIds))
+	for i, id := range userIds {
+		keys[i] = id
+	}
+	result, err := r.Table(c.config.Table).GetAll(keys...).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get summaries: %s", err.Error())
+	}
+	return readAll(result)
+}
+
+// readAll reads every Summary from a cursor.
+func readAll(result *r.Cursor) ([]Summary, error) {
+	summs := make([]Summary, 0)
+	var s Summary
+	for result.Next(&s) {
+		summs = append(summs, s)
+		s = Summary{}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read summaries: %s", err.Error())
+	}
+	return summs, nil
+}
+
+// RebuildAll regenerates every user's Summary from scratch.
+func (c *Client) RebuildAll() error {
+	if _, err := r.Table(c.config.Table).Delete().RunWrite(c.session); err != nil {
+		return fmt.Errorf("unable to delete summaries: %s", err.Error())
+	}
+	users, err := c.config.Visits.GetUsers()
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := c.Rebuild(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the summaries' outbox queue.
+func (c *Client) Name() string {
+	return "summaries"
+}
+
+// Publish rebuilds the Summary of the user whose visit an outbox event
+// changed, which makes Client an outbox sink. Since the outbox queues events
+// until they are published, changes made while the service is down are
+// projected once it is back up.
+func (c *Client) Publish(e *visits.Event) error {
+	if e.Visit == nil {
+		return nil
+	}
+	return c.Rebuild(e.Visit.User)
+}
@@ -0,0 +1,160 @@
+package trips
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+var (
+	ErrNotFound = errors.New("no such trip")
+)
+
+// Client acts as an api to retreiving user trip info from a db.
+type Client struct {
+	config  Config
+	session *r.Session
+}
+
+// Trip is a db structure which groups a user's visits into a named journey.
+type Trip struct {
+	ID     string    `json:"id" xml:"id" gorethink:"id,omitempty"`
+	User   string    `json:"user,omitempty" xml:"user,omitempty" gorethink:"user"`
+	Name   string    `json:"name" xml:"name" gorethink:"name"`
+	Start  time.Time `json:"start" xml:"start" gorethink:"start"`
+	End    time.Time `json:"end" xml:"end" gorethink:"end"`
+	Visits []string  `json:"visits" xml:"visits" gorethink:"visits"`
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table string
+}
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	return &Client{
+		config:  conf,
+		session: sess,
+	}
+}
+
+// NewTrip returns a pointer to a new instance of Trip with an empty list of
+// visits.
+func NewTrip() *Trip {
+	return &Trip{
+		Visits: make([]string, 0),
+	}
+}
+
+// Validate returns a non-nil error when it has been passed an invalid Trip
+// entity.
+func (c *Client) Validate(trip *Trip) error {
+	if trip.Name == "" {
+		return errors.New("missing 'name' field")
+	}
+	if trip.Start.IsZero() {
+		return errors.New("missing 'start' field")
+	}
+	if trip.End.IsZero() {
+		return errors.New("missing 'end' field")
+	}
+	if trip.End.Before(trip.Start) {
+		return errors.New("'end' must not be before 'start'")
+	}
+	return nil
+}
+
+// Get retrieves a single Trip from the database. ErrNotFound is returned if
+// the trip does not exist.
+func (c *Client) Get(tripId string) (*Trip, error) {
+	result, err := r.Table(c.config.Table).Get(tripId).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get trip: %s", err.Error())
+	}
+	trip := NewTrip()
+	if !result.Next(trip) {
+		return nil, ErrNotFound
+	}
+	return trip, nil
+}
+
+// GetTrips gets a list of Trip entities from the database, most recently
+// started first. Trips which start at the same time are ordered by id, so
+// that pages are stable.
+func (c *Client) GetTrips(userId string, start, limit int) ([]Trip, error) {
+	result, err := r.Table(c.config.Table).Between(
+		[]interface{}{userId, r.MinVal, r.MinVal},
+		[]interface{}{userId, r.MaxVal, r.MaxVal},
+		r.BetweenOpts{Index: "user_start"},
+	).OrderBy(r.OrderByOpts{Index: r.Desc("user_start")}).Slice(start, start+limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get trips: %s", err.Error())
+	}
+	trips := make([]Trip, 0)
+	var t Trip
+	for result.Next(&t) {
+		trips = append(trips, t)
+		t = Trip{}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read trips: %s", err.Error())
+	}
+	return trips, nil
+}
+
+// Add inserts a new Trip instance into the database.
+func (c *Client) Add(trip *Trip) error {
+	if trip.Visits == nil {
+		trip.Visits = make([]string, 0)
+	}
+	result, err := r.Table(c.config.Table).Insert(trip).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to add trip: %s", err.Error())
+	}
+	trip.ID = result.GeneratedKeys[0]
+	return nil
+}
+
+// Delete removes a Trip instance from the database given a unique tripId.
+func (c *Client) Delete(tripId string) error {
+	_, err := r.Table(c.config.Table).Get(tripId).Delete().RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to delete trip: %s", err.Error())
+	}
+	return nil
+}
+
+// AppendVisits adds visits to the end of a trip's ordered list of visits.
+// Visits which are already part of the trip keep their position.
+func (c *Client) AppendVisits(tripId string, visitIds ...string) error {
+	_, err := r.Table(c.config.Table).Get(tripId).Update(map[string]interface{}{
+		"visits": r.Row.Field("visits").Add(
+			r.Expr(visitIds).SetDifference(r.Row.Field("visits")),
+		),
+	}).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to add visits to trip: %s", err.Error())
+	}
+	return nil
+}
+
+// RemoveVisits removes the given visits from any trips which contain them.
+func (c *Client) RemoveVisits(visitIds ...string) error {
+	if len(visitIds) == 0 {
+		return nil
+	}
+	keys := make([]interface{}, len(visitIds))
+	for i, id := range visitIds {
+		keys[i] = id
+	}
+	_, err := r.Table(c.config.Table).GetAllByIndex("visits", keys...).Update(map[string]interface{}{
+		"visits": r.Row.Field("visits").SetDifference(visitIds),
+	}).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to remove visits from trips: %s", err.Error())
+	}
+	return nil
+}
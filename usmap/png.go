@@ -0,0 +1,185 @@
+package usmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// namedColors are the color names which can be rasterized. SVG maps accept
+// any color name since they are resolved by the viewer.
+var namedColors = map[string]color.RGBA{
+	"black":   {0x00, 0x00, 0x00, 0xff},
+	"silver":  {0xc0, 0xc0, 0xc0, 0xff},
+	"gray":    {0x80, 0x80, 0x80, 0xff},
+	"grey":    {0x80, 0x80, 0x80, 0xff},
+	"white":   {0xff, 0xff, 0xff, 0xff},
+	"maroon":  {0x80, 0x00, 0x00, 0xff},
+	"red":     {0xff, 0x00, 0x00, 0xff},
+	"purple":  {0x80, 0x00, 0x80, 0xff},
+	"fuchsia": {0xff, 0x00, 0xff, 0xff},
+	"green":   {0x00, 0x80, 0x00, 0xff},
+	"lime":    {0x00, 0xff, 0x00, 0xff},
+	"olive":   {0x80, 0x80, 0x00, 0xff},
+	"yellow":  {0xff, 0xff, 0x00, 0xff},
+	"navy":    {0x00, 0x00, 0x80, 0xff},
+	"blue":    {0x00, 0x00, 0xff, 0xff},
+	"teal":    {0x00, 0x80, 0x80, 0xff},
+	"aqua":    {0x00, 0xff, 0xff, 0xff},
+	"orange":  {0xff, 0xa5, 0x00, 0xff},
+}
+
+// DefaultPNGOptions are used for any options which are not specified when
+// rendering a PNG. The size suits link previews (ie: og:image).
+var DefaultPNGOptions = func() Options {
+	opts := DefaultOptions
+	opts.Width, opts.Height = 1200, 630
+	opts.Background = "#ffffff"
+	return opts
+}()
+
+// parseColor converts a hex color or color name to RGBA.
+func parseColor(c string) (color.RGBA, error) {
+	if !strings.HasPrefix(c, "#") {
+		if rgba, ok := namedColors[strings.ToLower(c)]; ok {
+			return rgba, nil
+		}
+		return color.RGBA{}, fmt.Errorf("unknown color '%s'", c)
+	}
+	hex := c[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color '%s'", c)
+	}
+	return color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 0xff}, nil
+}
+
+// palette holds the resolved colors of a raster map.
+type palette struct {
+	visited, unvisited, stroke, cities, background color.RGBA
+}
+
+// palette resolves the colors of the Options. Raster maps default to a white
+// background since transparent images display poorly in link previews.
+func (o *Options) palette() (palette, error) {
+	var p palette
+	bg := o.Background
+	if bg == "" {
+		bg = "#ffffff"
+	}
+	for name, c := range map[string]struct {
+		value string
+		dst   *color.RGBA
+	}{
+		"visited":    {o.Visited, &p.visited},
+		"unvisited":  {o.Unvisited, &p.unvisited},
+		"stroke":     {o.Stroke, &p.stroke},
+		"cities":     {o.Cities, &p.cities},
+		"background": {bg, &p.background},
+	} {
+		rgba, err := parseColor(c.value)
+		if err != nil {
+			return p, fmt.Errorf("'%s': %s", name, err.Error())
+		}
+		*c.dst = rgba
+	}
+	return p, nil
+}
+
+// ValidateRaster returns a non-nil error for Options which cannot be used to
+// render a PNG. Only a limited set of color names can be rasterized.
+func (o *Options) ValidateRaster() error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	_, err := o.palette()
+	return err
+}
+
+// RenderPNG writes the map as a PNG image. The map is scaled uniformly and
+// centered, so any aspect ratio (ie: 1200x630 for link previews) may be used.
+func RenderPNG(w io.Writer, m *Map, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	pal, err := opts.palette()
+	if err != nil {
+		return err
+	}
+	visited := m.visitedSet()
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{pal.background}, image.Point{}, draw.Src)
+	t := fit(opts.Width, opts.Height)
+	stroke := math.Max(t.scale, 0.5)
+
+	for _, st := range States() {
+		fill := pal.unvisited
+		if visited[st] {
+			fill = pal.visited
+		}
+		if st == "DC" {
+			p := t.apply(Project(st, dcLocation[0], dcLocation[1]))
+			fillCircle(img, p, 4*t.scale+stroke/2, pal.stroke)
+			fillCircle(img, p, 4*t.scale, fill)
+			continue
+		}
+		polys := make([][]Point, len(polygons[st]))
+		for i, poly := range polygons[st] {
+			polys[i] = make([]Point, len(poly))
+			for j, p := range poly {
+				polys[i][j] = t.apply(p)
+			}
+		}
+		fillPolygons(img, polys, fill)
+		strokePolygons(img, polys, stroke, pal.stroke)
+	}
+
+	radius := math.Max(3*t.scale, 1.5)
+	for _, ct := range m.Cities {
+		fillCircle(img, t.apply(ct.point()), radius, pal.cities)
+	}
+
+	if opts.Legend {
+		drawLegend(img, t, pal, fmt.Sprintf("Visited (%d of %d)", len(visited), len(States())))
+	}
+
+	return png.Encode(w, img)
+}
+
+// drawLegend draws the same legend as RenderSVG. Text is drawn at a fixed
+// size regardless of the image's scale.
+func drawLegend(img *image.RGBA, t transform, pal palette, visitedLabel string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  &image.Uniform{color.RGBA{0x33, 0x33, 0x33, 0xff}},
+		Face: basicfont.Face7x13,
+	}
+	for i, row := range []struct {
+		fill  color.RGBA
+		label string
+	}{
+		{pal.visited, visitedLabel},
+		{pal.unvisited, "Not visited"},
+	} {
+		y := 520 + 26*float64(i)
+		a, z := t.apply(Point{780, y}), t.apply(Point{796, y + 16})
+		fillPolygons(img, [][]Point{{{a.X, a.Y}, {z.X, a.Y}, {z.X, z.Y}, {a.X, z.Y}}}, row.fill)
+		text := t.apply(Point{804, y + 13})
+		d.Dot = fixed.P(int(text.X), int(text.Y))
+		d.DrawString(row.label)
+	}
+}
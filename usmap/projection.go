@@ -0,0 +1,141 @@
+package usmap
+
+import (
+	"math"
+	"sort"
+)
+
+// Maps are laid out on a fixed canvas which is scaled to the requested size
+// when rendered.
+const (
+	canvasWidth  = 960
+	canvasHeight = 600
+)
+
+// Point is a position on the map canvas.
+type Point struct {
+	X, Y float64
+}
+
+// albers is a (spherical) Albers equal-area conic projection.
+type albers struct {
+	n, c, rho0, lon0 float64
+}
+
+func newAlbers(lat1, lat2, lat0, lon0 float64) albers {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	n := (math.Sin(phi1) + math.Sin(phi2)) / 2
+	c := math.Cos(phi1)*math.Cos(phi1) + 2*n*math.Sin(phi1)
+	return albers{
+		n:    n,
+		c:    c,
+		rho0: math.Sqrt(c-2*n*math.Sin(radians(lat0))) / n,
+		lon0: lon0,
+	}
+}
+
+// project returns unscaled x/y coordinates with y increasing northwards.
+func (a albers) project(lon, lat float64) (float64, float64) {
+	rho := math.Sqrt(a.c-2*a.n*math.Sin(radians(lat))) / a.n
+	theta := a.n * radians(lon-a.lon0)
+	return rho * math.Sin(theta), a.rho0 - rho*math.Cos(theta)
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// region is a projection which is fitted into a box of the canvas. Alaska &
+// Hawaii are drawn as insets beneath the contiguous states.
+type region struct {
+	proj          albers
+	x, y, w, h    float64
+	scale, dx, dy float64
+}
+
+var (
+	contiguous = &region{proj: newAlbers(29.5, 45.5, 37.5, -96), x: 10, y: 10, w: 940, h: 580}
+	alaska     = &region{proj: newAlbers(55, 65, 50, -154), x: 20, y: 430, w: 220, h: 150}
+	hawaii     = &region{proj: newAlbers(8, 18, 3, -157), x: 250, y: 500, w: 110, h: 80}
+)
+
+// regionOf returns the region which a state is drawn in.
+func regionOf(state string) *region {
+	switch state {
+	case "AK":
+		return alaska
+	case "HI":
+		return hawaii
+	default:
+		return contiguous
+	}
+}
+
+// point projects a [longitude, latitude] onto the canvas.
+func (rg *region) point(lon, lat float64) Point {
+	x, y := rg.proj.project(lon, lat)
+	return Point{rg.dx + x*rg.scale, rg.dy - y*rg.scale}
+}
+
+// fit scales & centers the region so that all of the given states fit
+// within the region's box.
+func (rg *region) fit(states []string) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, st := range states {
+		for _, poly := range shapes[st] {
+			for _, ll := range poly {
+				x, y := rg.proj.project(ll[0], ll[1])
+				minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+				minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+			}
+		}
+	}
+	rg.scale = math.Min(rg.w/(maxX-minX), rg.h/(maxY-minY))
+	rg.dx = rg.x - minX*rg.scale + (rg.w-(maxX-minX)*rg.scale)/2
+	rg.dy = rg.y + maxY*rg.scale
+}
+
+// polygons holds every state's boundaries projected onto the canvas.
+var polygons = make(map[string][][]Point)
+
+func init() {
+	lower := make([]string, 0)
+	for st := range shapes {
+		if regionOf(st) == contiguous {
+			lower = append(lower, st)
+		}
+	}
+	contiguous.fit(lower)
+	alaska.fit([]string{"AK"})
+	hawaii.fit([]string{"HI"})
+
+	for st, polys := range shapes {
+		rg := regionOf(st)
+		for _, poly := range polys {
+			pts := make([]Point, len(poly))
+			for i, ll := range poly {
+				pts[i] = rg.point(ll[0], ll[1])
+			}
+			polygons[st] = append(polygons[st], pts)
+		}
+	}
+}
+
+// States returns the sorted 2-letter codes of every state which can be drawn,
+// including DC.
+func States() []string {
+	codes := []string{"DC"}
+	for st := range shapes {
+		codes = append(codes, st)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Project returns the canvas position of a [longitude, latitude] within the
+// given state. The state is needed to place points in Alaska & Hawaii within
+// their insets.
+func Project(state string, lon, lat float64) Point {
+	return regionOf(state).point(lon, lat)
+}
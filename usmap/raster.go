@@ -0,0 +1,123 @@
+package usmap
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// transform maps canvas coordinates onto an image.
+type transform struct {
+	scale, dx, dy float64
+}
+
+// fit returns the transform which scales the canvas uniformly to fit within
+// an image of the given size, centering it along the other dimension.
+func fit(width, height int) transform {
+	scale := math.Min(float64(width)/canvasWidth, float64(height)/canvasHeight)
+	return transform{
+		scale: scale,
+		dx:    (float64(width) - canvasWidth*scale) / 2,
+		dy:    (float64(height) - canvasHeight*scale) / 2,
+	}
+}
+
+func (t transform) apply(p Point) Point {
+	return Point{p.X*t.scale + t.dx, p.Y*t.scale + t.dy}
+}
+
+// fillPolygons fills polygons (already transformed to image coordinates)
+// using the even-odd rule. Rows are supersampled to smooth edges.
+func fillPolygons(img *image.RGBA, polys [][]Point, c color.RGBA) {
+	const samples = 4
+	b := img.Bounds()
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, poly := range polys {
+		for _, p := range poly {
+			minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+		}
+	}
+	y0 := int(math.Max(math.Floor(minY), float64(b.Min.Y)))
+	y1 := int(math.Min(math.Ceil(maxY), float64(b.Max.Y-1)))
+	cover := make([]float64, b.Dx())
+	xs := make([]float64, 0, 16)
+	for y := y0; y <= y1; y++ {
+		for i := range cover {
+			cover[i] = 0
+		}
+		for s := 0; s < samples; s++ {
+			sy := float64(y) + (float64(s)+0.5)/samples
+			xs = xs[:0]
+			for _, poly := range polys {
+				for i := range poly {
+					a, z := poly[i], poly[(i+1)%len(poly)]
+					if (a.Y <= sy && z.Y > sy) || (z.Y <= sy && a.Y > sy) {
+						xs = append(xs, a.X+(sy-a.Y)/(z.Y-a.Y)*(z.X-a.X))
+					}
+				}
+			}
+			sort.Float64s(xs)
+			for i := 0; i+1 < len(xs); i += 2 {
+				spanCover(cover, xs[i]-float64(b.Min.X), xs[i+1]-float64(b.Min.X), 1.0/samples)
+			}
+		}
+		for x, a := range cover {
+			if a > 0 {
+				blend(img, b.Min.X+x, y, c, math.Min(a, 1))
+			}
+		}
+	}
+}
+
+// strokePolygons outlines polygons by filling a thin quad along each edge.
+func strokePolygons(img *image.RGBA, polys [][]Point, width float64, c color.RGBA) {
+	for _, poly := range polys {
+		for i := range poly {
+			a, z := poly[i], poly[(i+1)%len(poly)]
+			dx, dy := z.X-a.X, z.Y-a.Y
+			l := math.Hypot(dx, dy)
+			if l == 0 {
+				continue
+			}
+			nx, ny := -dy/l*width/2, dx/l*width/2
+			fillPolygons(img, [][]Point{{
+				{a.X + nx, a.Y + ny}, {z.X + nx, z.Y + ny},
+				{z.X - nx, z.Y - ny}, {a.X - nx, a.Y - ny},
+			}}, c)
+		}
+	}
+}
+
+// fillCircle draws a filled circle as a polygon.
+func fillCircle(img *image.RGBA, center Point, radius float64, c color.RGBA) {
+	const sides = 24
+	poly := make([]Point, sides)
+	for i := range poly {
+		theta := 2 * math.Pi * float64(i) / sides
+		poly[i] = Point{center.X + radius*math.Cos(theta), center.Y + radius*math.Sin(theta)}
+	}
+	fillPolygons(img, [][]Point{poly}, c)
+}
+
+// spanCover adds the horizontal coverage of [x0, x1) to each pixel.
+func spanCover(cover []float64, x0, x1, weight float64) {
+	x0 = math.Max(x0, 0)
+	x1 = math.Min(x1, float64(len(cover)))
+	for x := int(x0); x < len(cover) && float64(x) < x1; x++ {
+		l := math.Max(x0, float64(x))
+		r := math.Min(x1, float64(x+1))
+		if r > l {
+			cover[x] += (r - l) * weight
+		}
+	}
+}
+
+// blend draws a color over a pixel with the given coverage.
+func blend(img *image.RGBA, x, y int, c color.RGBA, alpha float64) {
+	dst := img.RGBAAt(x, y)
+	mix := func(d, s uint8) uint8 {
+		return uint8(float64(d)*(1-alpha) + float64(s)*alpha + 0.5)
+	}
+	img.SetRGBA(x, y, color.RGBA{mix(dst.R, c.R), mix(dst.G, c.G), mix(dst.B, c.B), 255})
+}
@@ -0,0 +1,283 @@
+package usmap
+
+// shapes holds simplified state boundaries as polygons of [longitude,
+// latitude] points, keyed by the same 2-letter codes used by the locations
+// package. Boundaries are coarse (tens of points per state) which keeps the
+// rendered maps small while remaining recognizable. DC is too small to be
+// drawn as a shape and is rendered as a marker instead (see dcLocation).
+var shapes = map[string][][][2]float64{
+	"WA": {{
+		{-124.7, 48.4}, {-123.2, 48.2}, {-122.75, 49.0}, {-117.04, 49.0}, {-117.04, 46.43},
+		{-116.92, 46.0}, {-118.98, 46.0}, {-119.3, 45.93}, {-121.2, 45.65}, {-122.3, 45.55},
+		{-122.76, 45.65}, {-122.9, 46.1}, {-123.5, 46.25}, {-124.05, 46.28}, {-124.1, 47.0},
+		{-124.6, 47.9},
+	}},
+	"OR": {{
+		{-124.05, 46.28}, {-123.5, 46.25}, {-122.9, 46.1}, {-122.76, 45.65}, {-122.3, 45.55},
+		{-121.2, 45.65}, {-119.3, 45.93}, {-118.98, 46.0}, {-116.92, 46.0}, {-116.5, 45.6},
+		{-116.9, 44.8}, {-117.2, 44.3}, {-117.03, 43.6}, {-117.03, 42.0}, {-124.2, 42.0},
+		{-124.55, 42.8}, {-124.1, 44.0}, {-124.0, 45.5},
+	}},
+	"CA": {{
+		{-124.2, 42.0}, {-120.0, 42.0}, {-120.0, 39.0}, {-114.6, 35.0}, {-114.4, 34.2},
+		{-114.7, 32.7}, {-117.1, 32.55}, {-117.25, 33.0}, {-118.0, 33.7}, {-118.5, 34.0},
+		{-119.5, 34.4}, {-120.6, 34.6}, {-120.9, 35.4}, {-121.9, 36.6}, {-122.5, 37.5},
+		{-123.0, 38.0}, {-123.7, 39.0}, {-123.8, 40.0}, {-124.4, 40.4}, {-124.1, 41.0},
+	}},
+	"NV": {{
+		{-120.0, 42.0}, {-114.05, 42.0}, {-114.05, 36.2}, {-114.75, 36.1}, {-114.6, 35.0},
+		{-120.0, 39.0},
+	}},
+	"ID": {{
+		{-117.04, 49.0}, {-116.05, 49.0}, {-116.05, 47.98}, {-115.5, 47.3}, {-114.7, 46.7},
+		{-114.3, 46.65}, {-114.5, 45.6}, {-113.9, 45.6}, {-113.45, 45.0}, {-113.0, 44.9},
+		{-112.3, 44.55}, {-111.4, 44.7}, {-111.05, 44.5}, {-111.05, 42.0}, {-117.03, 42.0},
+		{-117.03, 43.6}, {-117.2, 44.3}, {-116.9, 44.8}, {-116.5, 45.6}, {-116.92, 46.0},
+		{-117.04, 46.43},
+	}},
+	"MT": {{
+		{-116.05, 49.0}, {-104.05, 49.0}, {-104.05, 45.0}, {-111.05, 45.0}, {-111.05, 44.5},
+		{-111.4, 44.7}, {-112.3, 44.55}, {-113.0, 44.9}, {-113.45, 45.0}, {-113.9, 45.6},
+		{-114.5, 45.6}, {-114.3, 46.65}, {-114.7, 46.7}, {-115.5, 47.3}, {-116.05, 47.98},
+	}},
+	"WY": {{
+		{-111.05, 45.0}, {-104.05, 45.0}, {-104.05, 41.0}, {-111.05, 41.0},
+	}},
+	"UT": {{
+		{-114.05, 42.0}, {-111.05, 42.0}, {-111.05, 41.0}, {-109.05, 41.0}, {-109.05, 37.0},
+		{-114.05, 37.0},
+	}},
+	"AZ": {{
+		{-114.05, 37.0}, {-109.05, 37.0}, {-109.05, 31.33}, {-111.07, 31.33}, {-114.8, 32.5},
+		{-114.7, 32.7}, {-114.4, 34.2}, {-114.6, 35.0}, {-114.75, 36.1}, {-114.05, 36.2},
+	}},
+	"CO": {{
+		{-109.05, 41.0}, {-102.05, 41.0}, {-102.05, 37.0}, {-109.05, 37.0},
+	}},
+	"NM": {{
+		{-109.05, 37.0}, {-103.0, 37.0}, {-103.0, 36.5}, {-103.04, 32.0}, {-106.62, 32.0},
+		{-106.5, 31.78}, {-108.2, 31.78}, {-108.2, 31.33}, {-109.05, 31.33},
+	}},
+	"ND": {{
+		{-104.05, 49.0}, {-97.23, 49.0}, {-96.9, 47.6}, {-96.6, 46.6}, {-96.56, 45.94},
+		{-104.05, 45.94},
+	}},
+	"SD": {{
+		{-104.05, 45.94}, {-96.56, 45.94}, {-96.45, 45.3}, {-96.45, 43.5}, {-96.6, 42.7},
+		{-96.45, 42.5}, {-97.0, 42.8}, {-98.5, 43.0}, {-104.05, 43.0},
+	}},
+	"NE": {{
+		{-104.05, 43.0}, {-98.5, 43.0}, {-97.0, 42.8}, {-96.45, 42.5}, {-96.1, 41.6},
+		{-95.9, 41.0}, {-95.77, 40.58}, {-95.3, 40.0}, {-102.05, 40.0}, {-102.05, 41.0},
+		{-104.05, 41.0},
+	}},
+	"KS": {{
+		{-102.05, 40.0}, {-95.3, 40.0}, {-94.9, 39.6}, {-94.62, 39.1}, {-94.62, 37.0},
+		{-102.05, 37.0},
+	}},
+	"OK": {{
+		{-103.0, 37.0}, {-94.62, 37.0}, {-94.62, 36.5}, {-94.43, 35.4}, {-94.48, 33.64},
+		{-95.3, 33.9}, {-96.6, 33.85}, {-97.9, 33.9}, {-99.0, 34.2}, {-100.0, 34.56},
+		{-100.0, 36.5}, {-103.0, 36.5},
+	}},
+	"TX": {{
+		{-103.0, 36.5}, {-100.0, 36.5}, {-100.0, 34.56}, {-99.0, 34.2}, {-97.9, 33.9},
+		{-96.6, 33.85}, {-95.3, 33.9}, {-94.48, 33.64}, {-94.04, 33.55}, {-94.04, 33.0},
+		{-94.04, 31.99}, {-93.8, 31.0}, {-93.7, 30.3}, {-93.85, 29.7}, {-94.7, 29.4},
+		{-95.1, 29.1}, {-96.3, 28.4}, {-97.2, 27.6}, {-97.4, 26.0}, {-97.15, 25.95},
+		{-99.1, 26.4}, {-99.5, 27.5}, {-100.3, 28.3}, {-101.4, 29.8}, {-102.4, 29.8},
+		{-103.1, 29.0}, {-104.5, 29.6}, {-104.9, 30.6}, {-106.5, 31.78}, {-106.62, 32.0},
+		{-103.04, 32.0},
+	}},
+	"MN": {{
+		{-97.23, 49.0}, {-95.15, 49.0}, {-94.6, 48.7}, {-93.0, 48.6}, {-91.0, 48.2},
+		{-89.6, 48.0}, {-90.8, 47.3}, {-92.1, 46.75}, {-92.3, 46.1}, {-92.75, 45.6},
+		{-92.75, 45.0}, {-92.8, 44.75}, {-91.9, 44.2}, {-91.22, 43.5}, {-96.45, 43.5},
+		{-96.45, 45.3}, {-96.56, 45.94}, {-96.6, 46.6}, {-96.9, 47.6},
+	}},
+	"IA": {{
+		{-96.45, 43.5}, {-91.22, 43.5}, {-91.05, 42.75}, {-90.64, 42.5}, {-90.15, 41.9},
+		{-90.4, 41.45}, {-91.1, 40.7}, {-91.42, 40.38}, {-91.73, 40.61}, {-95.77, 40.58},
+		{-95.9, 41.0}, {-96.1, 41.6}, {-96.45, 42.5}, {-96.6, 42.7},
+	}},
+	"MO": {{
+		{-95.77, 40.58}, {-91.73, 40.61}, {-91.42, 40.38}, {-91.4, 40.0}, {-90.7, 39.3},
+		{-90.2, 38.8}, {-89.5, 37.3}, {-89.1, 36.95}, {-89.5, 36.5}, {-89.7, 36.0},
+		{-90.37, 36.0}, {-90.15, 36.5}, {-94.62, 36.5}, {-94.62, 37.0}, {-94.62, 39.1},
+		{-94.9, 39.6}, {-95.3, 40.0},
+	}},
+	"AR": {{
+		{-94.62, 36.5}, {-90.15, 36.5}, {-90.37, 36.0}, {-89.7, 36.0}, {-90.1, 35.0},
+		{-90.6, 34.4}, {-91.17, 33.0}, {-94.04, 33.0}, {-94.04, 33.55}, {-94.48, 33.64},
+		{-94.43, 35.4},
+	}},
+	"LA": {{
+		{-94.04, 33.0}, {-91.17, 33.0}, {-91.0, 32.4}, {-91.4, 31.6}, {-91.64, 31.0},
+		{-89.73, 31.0}, {-89.6, 30.2}, {-89.4, 29.9}, {-89.0, 29.2}, {-90.0, 29.1},
+		{-91.3, 29.3}, {-92.3, 29.55}, {-93.85, 29.7}, {-93.7, 30.3}, {-93.8, 31.0},
+		{-94.04, 31.99},
+	}},
+	"WI": {{
+		{-92.1, 46.75}, {-91.0, 46.9}, {-90.4, 46.57}, {-89.0, 46.15}, {-88.1, 45.8},
+		{-87.6, 45.1}, {-87.0, 45.3}, {-87.7, 44.3}, {-87.8, 43.0}, {-87.8, 42.5},
+		{-90.64, 42.5}, {-91.05, 42.75}, {-91.22, 43.5}, {-91.9, 44.2}, {-92.8, 44.75},
+		{-92.75, 45.0}, {-92.75, 45.6}, {-92.3, 46.1},
+	}},
+	"IL": {{
+		{-87.8, 42.5}, {-90.64, 42.5}, {-90.15, 41.9}, {-90.4, 41.45}, {-91.1, 40.7},
+		{-91.42, 40.38}, {-91.4, 40.0}, {-90.7, 39.3}, {-90.2, 38.8}, {-89.5, 37.3},
+		{-89.1, 36.95}, {-88.1, 37.5}, {-88.03, 37.8}, {-87.6, 38.7}, {-87.52, 39.35},
+		{-87.52, 41.7}, {-87.6, 41.8},
+	}},
+	"MI": {
+		{
+			{-84.82, 41.7}, {-83.45, 41.73}, {-83.1, 42.3}, {-82.5, 42.6}, {-82.4, 43.0},
+			{-82.6, 44.0}, {-83.3, 43.9}, {-83.9, 43.6}, {-83.3, 44.3}, {-83.4, 45.0},
+			{-84.7, 45.8}, {-85.5, 44.8}, {-86.2, 44.2}, {-86.5, 43.5}, {-86.2, 42.4},
+			{-86.8, 41.76},
+		},
+		{
+			{-90.4, 46.57}, {-88.0, 47.3}, {-87.8, 47.4}, {-87.0, 46.5}, {-85.0, 46.8},
+			{-84.5, 46.5}, {-84.0, 46.0}, {-84.7, 45.9}, {-85.5, 46.1}, {-87.0, 45.7},
+			{-87.6, 45.1}, {-88.1, 45.8}, {-89.0, 46.15},
+		},
+	},
+	"IN": {{
+		{-84.8, 39.1}, {-84.82, 41.7}, {-86.8, 41.76}, {-87.52, 41.7}, {-87.52, 39.35},
+		{-87.6, 38.7}, {-88.03, 37.8}, {-87.6, 37.9}, {-86.5, 38.0}, {-85.7, 38.3},
+	}},
+	"OH": {{
+		{-80.52, 41.98}, {-80.52, 40.64}, {-80.9, 39.7}, {-81.7, 39.2}, {-82.6, 38.4},
+		{-83.6, 38.65}, {-84.8, 39.1}, {-84.82, 41.7}, {-83.45, 41.73}, {-82.7, 41.45},
+		{-81.7, 41.5},
+	}},
+	"KY": {{
+		{-89.5, 36.5}, {-88.05, 36.5}, {-83.68, 36.6}, {-81.97, 37.54}, {-82.6, 38.4},
+		{-83.6, 38.65}, {-84.8, 39.1}, {-85.7, 38.3}, {-86.5, 38.0}, {-87.6, 37.9},
+		{-88.03, 37.8}, {-88.1, 37.5}, {-89.1, 36.95},
+	}},
+	"TN": {{
+		{-90.1, 35.0}, {-88.2, 35.0}, {-85.6, 35.0}, {-84.3, 35.0}, {-84.0, 35.5},
+		{-83.0, 35.8}, {-82.0, 36.2}, {-81.68, 36.59}, {-83.68, 36.6}, {-88.05, 36.5},
+		{-89.5, 36.5}, {-89.7, 36.0},
+	}},
+	"MS": {{
+		{-90.1, 35.0}, {-88.2, 35.0}, {-88.1, 34.0}, {-88.4, 30.4}, {-89.6, 30.2},
+		{-89.73, 31.0}, {-91.64, 31.0}, {-91.4, 31.6}, {-91.0, 32.4}, {-91.17, 33.0},
+		{-90.6, 34.4},
+	}},
+	"AL": {{
+		{-88.2, 35.0}, {-85.6, 35.0}, {-85.2, 32.85}, {-85.0, 31.0}, {-87.6, 31.0},
+		{-87.6, 30.3}, {-88.0, 30.25}, {-88.4, 30.4}, {-88.1, 34.0},
+	}},
+	"GA": {{
+		{-85.6, 35.0}, {-84.3, 35.0}, {-83.1, 35.0}, {-82.4, 34.5}, {-81.9, 33.5},
+		{-81.1, 32.1}, {-80.85, 32.0}, {-81.2, 31.5}, {-81.45, 30.7}, {-82.2, 30.57},
+		{-84.9, 30.7}, {-85.0, 31.0}, {-85.2, 32.85},
+	}},
+	"FL": {{
+		{-87.6, 31.0}, {-85.0, 31.0}, {-84.9, 30.7}, {-82.2, 30.57}, {-81.45, 30.7},
+		{-81.2, 29.5}, {-80.6, 28.4}, {-80.1, 27.0}, {-80.1, 25.8}, {-80.4, 25.2},
+		{-81.1, 25.1}, {-81.8, 26.1}, {-82.7, 27.5}, {-82.8, 28.2}, {-83.0, 29.0},
+		{-83.7, 29.9}, {-84.3, 30.0}, {-85.3, 29.7}, {-86.3, 30.4}, {-87.6, 30.3},
+	}},
+	"SC": {{
+		{-83.1, 35.0}, {-82.3, 35.2}, {-81.0, 35.15}, {-80.8, 34.8}, {-79.7, 34.8},
+		{-78.55, 33.85}, {-79.2, 33.2}, {-80.0, 32.7}, {-80.85, 32.0}, {-81.1, 32.1},
+		{-81.9, 33.5}, {-82.4, 34.5},
+	}},
+	"NC": {{
+		{-84.3, 35.0}, {-83.1, 35.0}, {-82.3, 35.2}, {-81.0, 35.15}, {-80.8, 34.8},
+		{-79.7, 34.8}, {-78.55, 33.85}, {-77.9, 33.9}, {-77.4, 34.5}, {-76.5, 34.7},
+		{-75.5, 35.2}, {-75.9, 36.55}, {-81.68, 36.59}, {-82.0, 36.2}, {-83.0, 35.8},
+		{-84.0, 35.5},
+	}},
+	"VA": {{
+		{-75.9, 36.55}, {-76.3, 37.0}, {-76.3, 38.0}, {-77.0, 38.4}, {-77.05, 38.9},
+		{-77.8, 39.3}, {-78.9, 38.7}, {-79.7, 38.4}, {-80.3, 37.5}, {-81.2, 37.27},
+		{-81.97, 37.54}, {-83.68, 36.6}, {-81.68, 36.59},
+	}},
+	"WV": {{
+		{-81.97, 37.54}, {-82.6, 38.4}, {-81.7, 39.2}, {-80.9, 39.7}, {-80.52, 40.64},
+		{-80.52, 39.72}, {-79.48, 39.72}, {-79.48, 39.2}, {-78.35, 39.65}, {-77.8, 39.3},
+		{-78.9, 38.7}, {-79.7, 38.4}, {-80.3, 37.5}, {-81.2, 37.27},
+	}},
+	"MD": {{
+		{-79.48, 39.72}, {-75.79, 39.72}, {-75.79, 38.45}, {-75.05, 38.45}, {-75.25, 38.03},
+		{-76.0, 38.0}, {-76.3, 38.0}, {-77.0, 38.4}, {-77.05, 38.9}, {-77.8, 39.3},
+		{-78.35, 39.65}, {-79.48, 39.2},
+	}},
+	"DE": {{
+		{-75.79, 39.72}, {-75.6, 39.84}, {-75.4, 39.8}, {-75.5, 39.5}, {-75.05, 38.8},
+		{-75.05, 38.45}, {-75.79, 38.45},
+	}},
+	"PA": {{
+		{-80.52, 41.98}, {-79.76, 42.27}, {-79.76, 42.0}, {-75.35, 42.0}, {-74.7, 41.35},
+		{-75.1, 41.0}, {-75.2, 40.6}, {-74.7, 40.2}, {-75.1, 40.0}, {-75.4, 39.8},
+		{-75.6, 39.84}, {-75.79, 39.72}, {-79.48, 39.72}, {-80.52, 39.72}, {-80.52, 40.64},
+	}},
+	"NJ": {{
+		{-74.7, 41.35}, {-73.9, 40.99}, {-74.0, 40.7}, {-74.0, 40.4}, {-74.1, 39.8},
+		{-74.9, 38.93}, {-75.5, 39.5}, {-75.4, 39.8}, {-75.1, 40.0}, {-74.7, 40.2},
+		{-75.2, 40.6}, {-75.1, 41.0},
+	}},
+	"NY": {
+		{
+			{-79.76, 42.0}, {-75.35, 42.0}, {-74.7, 41.35}, {-73.9, 40.99}, {-73.65, 41.0},
+			{-73.5, 41.3}, {-73.5, 42.05}, {-73.26, 42.75}, {-73.35, 45.0}, {-74.7, 45.0},
+			{-75.8, 44.4}, {-76.3, 44.2}, {-76.2, 43.5}, {-77.6, 43.25}, {-79.05, 43.25},
+			{-78.9, 42.9}, {-79.76, 42.27},
+		},
+		{
+			{-74.0, 40.7}, {-73.9, 40.85}, {-72.0, 41.1}, {-71.85, 41.05}, {-72.5, 40.85},
+			{-73.9, 40.57},
+		},
+	},
+	"CT": {{
+		{-73.65, 41.0}, {-73.5, 41.3}, {-73.5, 42.05}, {-71.8, 42.02}, {-71.8, 41.33},
+		{-72.9, 41.25},
+	}},
+	"RI": {{
+		{-71.8, 42.02}, {-71.38, 42.02}, {-71.2, 41.67}, {-71.12, 41.5}, {-71.45, 41.35},
+		{-71.8, 41.33},
+	}},
+	"MA": {{
+		{-73.5, 42.05}, {-73.26, 42.75}, {-72.46, 42.73}, {-71.3, 42.7}, {-71.0, 42.87},
+		{-70.8, 42.87}, {-70.95, 42.45}, {-70.6, 42.0}, {-70.5, 41.75}, {-70.0, 41.75},
+		{-70.0, 42.05}, {-69.93, 41.7}, {-70.0, 41.55}, {-70.65, 41.55}, {-71.12, 41.5},
+		{-71.2, 41.67}, {-71.38, 42.02}, {-71.8, 42.02},
+	}},
+	"VT": {{
+		{-73.26, 42.75}, {-72.46, 42.73}, {-72.4, 43.5}, {-72.0, 44.3}, {-71.5, 45.01},
+		{-73.35, 45.0},
+	}},
+	"NH": {{
+		{-72.46, 42.73}, {-71.3, 42.7}, {-71.0, 42.87}, {-70.7, 43.1}, {-70.98, 43.8},
+		{-71.08, 45.3}, {-71.5, 45.01}, {-72.0, 44.3}, {-72.4, 43.5},
+	}},
+	"ME": {{
+		{-70.7, 43.1}, {-70.98, 43.8}, {-71.08, 45.3}, {-70.3, 45.9}, {-70.0, 46.7},
+		{-69.2, 47.45}, {-68.2, 47.35}, {-67.8, 47.06}, {-67.78, 45.9}, {-67.45, 45.6},
+		{-67.0, 44.8}, {-68.0, 44.4}, {-69.0, 44.0}, {-70.2, 43.6},
+	}},
+	"AK": {{
+		{-141.0, 69.6}, {-141.0, 60.3}, {-137.5, 59.0}, {-135.5, 59.8}, {-133.4, 58.4},
+		{-130.0, 55.9}, {-131.0, 55.0}, {-133.5, 55.5}, {-136.5, 58.0}, {-139.8, 59.8},
+		{-144.0, 60.0}, {-146.5, 60.5}, {-148.5, 59.9}, {-151.8, 59.2}, {-151.2, 60.8},
+		{-150.0, 61.2}, {-153.5, 59.2}, {-154.0, 58.5}, {-158.0, 56.5}, {-163.0, 54.8},
+		{-165.0, 54.4}, {-162.0, 55.4}, {-158.0, 57.0}, {-157.0, 58.7}, {-160.0, 58.6},
+		{-162.0, 59.9}, {-165.0, 60.5}, {-164.5, 62.8}, {-161.0, 63.5}, {-165.0, 64.5},
+		{-168.0, 65.6}, {-164.5, 66.5}, {-166.0, 68.9}, {-163.0, 69.8}, {-156.5, 71.3},
+		{-152.0, 70.8}, {-145.0, 70.1},
+	}},
+	"HI": {
+		{{-155.9, 20.2}, {-155.0, 19.8}, {-154.8, 19.5}, {-155.6, 18.9}, {-156.05, 19.7}},
+		{{-156.7, 20.95}, {-156.4, 20.95}, {-156.0, 20.8}, {-156.4, 20.58}, {-156.7, 20.75}},
+		{{-157.3, 21.2}, {-156.7, 21.15}, {-156.75, 21.05}, {-157.3, 21.1}},
+		{{-158.3, 21.55}, {-157.95, 21.7}, {-157.65, 21.3}, {-158.1, 21.3}},
+		{{-159.8, 22.2}, {-159.3, 22.2}, {-159.3, 21.9}, {-159.7, 21.95}},
+	},
+}
+
+// dcLocation is the [longitude, latitude] of Washington DC.
+var dcLocation = [2]float64{-77.03, 38.9}
@@ -0,0 +1,182 @@
+package usmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// MaxSize is the largest width or height a map may be rendered at.
+const MaxSize = 2000
+
+// Map describes what to draw.
+type Map struct {
+	// Visited holds the 2-letter codes of states which are filled in.
+	Visited []string
+	// Names maps 2-letter codes to display names. Codes are used for any
+	// missing names.
+	Names map[string]string
+	// Cities holds visited cities which are marked with a dot.
+	Cities []City
+}
+
+// City is a visited city's position.
+type City struct {
+	Name  string
+	State string
+	Lon   float64
+	Lat   float64
+}
+
+// Options control how a Map is rendered.
+type Options struct {
+	Width      int
+	Height     int
+	Visited    string
+	Unvisited  string
+	Stroke     string
+	Cities     string
+	Background string
+	Legend     bool
+}
+
+// DefaultOptions are used for any options which are not specified.
+var DefaultOptions = Options{
+	Width:     canvasWidth,
+	Height:    canvasHeight,
+	Visited:   "#2b8cbe",
+	Unvisited: "#e0e0e0",
+	Stroke:    "#ffffff",
+	Cities:    "#d7301f",
+	Legend:    true,
+}
+
+// colorPattern matches hex colors & color keywords. It keeps user supplied
+// colors from injecting markup into the rendered map.
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+
+// Validate returns a non-nil error for invalid Options.
+func (o *Options) Validate() error {
+	if o.Width < 1 || o.Width > MaxSize {
+		return fmt.Errorf("'width' must be between 1 and %v", MaxSize)
+	}
+	if o.Height < 1 || o.Height > MaxSize {
+		return fmt.Errorf("'height' must be between 1 and %v", MaxSize)
+	}
+	for name, c := range map[string]string{
+		"visited":   o.Visited,
+		"unvisited": o.Unvisited,
+		"stroke":    o.Stroke,
+		"cities":    o.Cities,
+	} {
+		if !colorPattern.MatchString(c) {
+			return fmt.Errorf("'%s' must be a hex color or color name", name)
+		}
+	}
+	if o.Background != "" && !colorPattern.MatchString(o.Background) {
+		return errors.New("'background' must be a hex color or color name")
+	}
+	return nil
+}
+
+// RenderSVG writes the map as an SVG image.
+func RenderSVG(w io.Writer, m *Map, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	visited := m.visitedSet()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		opts.Width, opts.Height, canvasWidth, canvasHeight)
+	bw.WriteString("\n")
+	if opts.Background != "" {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", opts.Background)
+	}
+
+	fmt.Fprintf(bw, `<g stroke="%s" stroke-width="1" stroke-linejoin="round">`+"\n", opts.Stroke)
+	for _, st := range States() {
+		fill := opts.Unvisited
+		if visited[st] {
+			fill = opts.Visited
+		}
+		title := html.EscapeString(m.name(st))
+		if st == "DC" {
+			p := Project(st, dcLocation[0], dcLocation[1])
+			fmt.Fprintf(bw, `<circle id="%s" cx="%.1f" cy="%.1f" r="4" fill="%s"><title>%s</title></circle>`+"\n",
+				st, p.X, p.Y, fill, title)
+			continue
+		}
+		fmt.Fprintf(bw, `<path id="%s" fill="%s" d="%s"><title>%s</title></path>`+"\n",
+			st, fill, pathData(polygons[st]), title)
+	}
+	bw.WriteString("</g>\n")
+
+	if len(m.Cities) > 0 {
+		fmt.Fprintf(bw, `<g fill="%s">`+"\n", opts.Cities)
+		for _, ct := range m.Cities {
+			p := ct.point()
+			fmt.Fprintf(bw, `<circle cx="%.1f" cy="%.1f" r="3"><title>%s</title></circle>`+"\n",
+				p.X, p.Y, html.EscapeString(ct.Name))
+		}
+		bw.WriteString("</g>\n")
+	}
+
+	if opts.Legend {
+		fmt.Fprintf(bw, `<g font-family="sans-serif" font-size="14" fill="#333333">`+"\n")
+		fmt.Fprintf(bw, `<rect x="780" y="520" width="16" height="16" fill="%s"/><text x="804" y="533">Visited (%d of %d)</text>`+"\n",
+			opts.Visited, len(visited), len(States()))
+		fmt.Fprintf(bw, `<rect x="780" y="546" width="16" height="16" fill="%s"/><text x="804" y="559">Not visited</text>`+"\n",
+			opts.Unvisited)
+		bw.WriteString("</g>\n")
+	}
+
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// visitedSet returns the set of visited states which can be drawn.
+func (m *Map) visitedSet() map[string]bool {
+	set := make(map[string]bool)
+	for _, st := range m.Visited {
+		st = strings.ToUpper(st)
+		if _, ok := shapes[st]; ok || st == "DC" {
+			set[st] = true
+		}
+	}
+	return set
+}
+
+// point returns the canvas position of a city.
+func (ct City) point() Point {
+	return Project(strings.ToUpper(ct.State), ct.Lon, ct.Lat)
+}
+
+// name returns the display name of a state.
+func (m *Map) name(state string) string {
+	if n, ok := m.Names[state]; ok && n != "" {
+		return n
+	}
+	return state
+}
+
+// pathData formats polygons as SVG path data.
+func pathData(polys [][]Point) string {
+	var b strings.Builder
+	for _, poly := range polys {
+		for i, p := range poly {
+			if i == 0 {
+				b.WriteString("M")
+			} else {
+				b.WriteString("L")
+			}
+			fmt.Fprintf(&b, "%.1f,%.1f", p.X, p.Y)
+		}
+		b.WriteString("Z")
+	}
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package visits
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// Actor identifies who made a change to a visit, for the audit log.
+type Actor struct {
+	// User is the calling user, or empty for anonymous calls.
+	User      string `json:"user,omitempty" xml:"user,omitempty" gorethink:"user,omitempty"`
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty" gorethink:"request_id,omitempty"`
+	IP        string `json:"ip,omitempty" xml:"ip,omitempty" gorethink:"ip,omitempty"`
+}
+
+// AuditEntry is a db structure recording a single change to a visit in the
+// append-only audit table. Action is the type of the change's event (ie:
+// EventCreated). Before is nil for added visits and After is nil for
+// visits which were removed permanently.
+type AuditEntry struct {
+	ID     string    `json:"id" xml:"id" gorethink:"id,omitempty"`
+	Visit  string    `json:"visit" xml:"visit" gorethink:"visit"`
+	User   string    `json:"user" xml:"user" gorethink:"user"`
+	Action string    `json:"action" xml:"action" gorethink:"action"`
+	Actor  Actor     `json:"actor" xml:"actor" gorethink:"actor"`
+	Before *Visit    `json:"before,omitempty" xml:"before,omitempty" gorethink:"before"`
+	After  *Visit    `json:"after,omitempty" xml:"after,omitempty" gorethink:"after"`
+	Time   time.Time `json:"time" xml:"time" gorethink:"time"`
+}
+
+// AuditQuery filters the audit log across all visits. Zero values are
+// ignored when filtering.
+type AuditQuery struct {
+	From time.Time
+	To   time.Time
+	// User whose visits were changed.
+	User string
+	// Actor is the user who made the changes.
+	Actor  string
+	Action string
+	Start  int
+	Limit  int
+}
+
+// Validate returns a non-nil error for an invalid AuditQuery.
+func (q *AuditQuery) Validate() error {
+	switch q.Action {
+	case "", EventCreated, EventUpdated, EventDeleted, EventRestored:
+	default:
+		return fmt.Errorf("'action' must be one of: %s, %s, %s, %s", EventCreated, EventUpdated, EventDeleted, EventRestored)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return errors.New("'to' must not be before 'from'")
+	}
+	return nil
+}
+
+// GetHistory gets the audit entries of a visit, oldest first.
+func (c *Client) GetHistory(visitId string) ([]AuditEntry, error) {
+	result, err := r.Table(c.config.AuditTable).Between(
+		[]interface{}{visitId, r.MinVal, r.MinVal},
+		[]interface{}{visitId, r.MaxVal, r.MaxVal},
+		r.BetweenOpts{Index: "visit_time"},
+	).OrderBy(r.OrderByOpts{Index: "visit_time"}).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visit history: %s", err.Error())
+	}
+	return readEntries(result)
+}
+
+// GetAudit gets the audit entries matching a query, most recent first.
+func (c *Client) GetAudit(q AuditQuery) ([]AuditEntry, error) {
+	lower, upper := interface{}(r.MinVal), interface{}(r.MaxVal)
+	if !q.From.IsZero() {
+		lower = []interface{}{q.From, r.MinVal}
+	}
+	if !q.To.IsZero() {
+		upper = []interface{}{q.To, r.MaxVal}
+	}
+	term := r.Table(c.config.AuditTable).Between(
+		lower, upper, r.BetweenOpts{Index: "time_id", RightBound: "closed"},
+	).OrderBy(r.OrderByOpts{Index: r.Desc("time_id")})
+	if q.User != "" {
+		term = term.Filter(r.Row.Field("user").Eq(q.User))
+	}
+	if q.Actor != "" {
+		term = term.Filter(r.Row.Field("actor").Field("user").Default("").Eq(q.Actor))
+	}
+	if q.Action != "" {
+		term = term.Filter(r.Row.Field("action").Eq(q.Action))
+	}
+	result, err := term.Slice(q.Start, q.Start+q.Limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get audit entries: %s", err.Error())
+	}
+	return readEntries(result)
+}
+
+func readEntries(result *r.Cursor) ([]AuditEntry, error) {
+	entries := make([]AuditEntry, 0)
+	var e AuditEntry
+	for result.Next(&e) {
+		entries = append(entries, e)
+		e = AuditEntry{}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read audit entries: %s", err.Error())
+	}
+	return entries, nil
+}
@@ -1,8 +1,11 @@
 package visits
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,11 +26,53 @@ type Visit struct {
 	State     string    `json:"state,omitempty" xml:"state,omitempty" gorethink:"state"`
 	User      string    `json:"user,omitempty" xml:"user,omitempty" gorethink:"user"`
 	Timestamp time.Time `json:"timestamp,omitempty" xml:"timestamp,omitempty" gorethink:"timestamp"`
+	TripID    string    `json:"trip,omitempty" xml:"trip,omitempty" gorethink:"trip,omitempty"`
+	// ArrivedAt & DepartedAt optionally record when a visit took place,
+	// interpreted in the IANA TimeZone (ie: "America/New_York").
+	ArrivedAt  *time.Time `json:"arrived_at,omitempty" xml:"arrived_at,omitempty" gorethink:"arrived_at,omitempty"`
+	DepartedAt *time.Time `json:"departed_at,omitempty" xml:"departed_at,omitempty" gorethink:"departed_at,omitempty"`
+	TimeZone   string     `json:"time_zone,omitempty" xml:"time_zone,omitempty" gorethink:"time_zone,omitempty"`
+	// Private visits are only shown to the visiting user.
+	Private bool `json:"private,omitempty" xml:"private,omitempty" gorethink:"private,omitempty"`
+	// DeletedAt tombstones a deleted visit, which is kept in the trash until
+	// it is restored or purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" xml:"deleted_at,omitempty" gorethink:"deleted_at,omitempty"`
 }
 
+// Days holds the number of distinct calendar days a user has spent in each
+// state & city, sorted by place. Cities are named as "City,ST".
+type Days struct {
+	States []DayCount `json:"states" xml:"states"`
+	Cities []DayCount `json:"cities" xml:"cities"`
+}
+
+// DayCount is the number of distinct calendar days spent in a place.
+type DayCount struct {
+	Place string `json:"place" xml:"place"`
+	Days  int    `json:"days" xml:"days"`
+}
+
+// MaxStay is the longest time which a visit may span.
+const MaxStay = 366 * 24 * time.Hour
+
 // Config is used to create a new instance of Client via NewClient(...).
 type Config struct {
 	Table string
+	// DedupWindow is the amount of time in which a repeated visit to the
+	// same city/state by the same user is considered a duplicate. A zero
+	// value disables duplicate detection.
+	DedupWindow time.Duration
+	// AuditTable records an AuditEntry for every change to a visit, along
+	// with the Actor who made it, once the change is collected (see
+	// Collect). Nothing is audited when it is empty.
+	AuditTable string
+}
+
+// Merge describes a set of duplicate visits which were (or would be) merged
+// into a single kept visit.
+type Merge struct {
+	Kept    Visit   `json:"kept" xml:"kept"`
+	Removed []Visit `json:"removed" xml:"removed"`
 }
 
 // NewClient returns a new instance of Client.
@@ -39,13 +84,20 @@ func NewClient(conf Config, sess *r.Session) *Client {
 }
 
 // NewVisit returns a pointer to a new instance of Visit with Timestamp
-// initialized to time.Now().
+// initialized to time.Now(). The Timestamp is replaced by ArrivedAt when a
+// visit is added with an arrival time.
 func NewVisit() *Visit {
 	return &Visit{
 		Timestamp: time.Now(),
 	}
 }
 
+// DedupWindow returns the configured window used for detecting duplicate
+// visits.
+func (c *Client) DedupWindow() time.Duration {
+	return c.config.DedupWindow
+}
+
 // Validate returns a non-nil error when it has been passed an invalid Visit
 // entity.
 func (c *Client) Validate(visit *Visit) error {
@@ -55,12 +107,122 @@ func (c *Client) Validate(visit *Visit) error {
 	if visit.State == "" {
 		return errors.New("missing 'state' field")
 	}
+	if visit.TimeZone != "" {
+		if _, err := time.LoadLocation(visit.TimeZone); err != nil {
+			return fmt.Errorf("unknown 'time_zone': %s", visit.TimeZone)
+		}
+	}
+	if visit.DepartedAt != nil {
+		if visit.ArrivedAt == nil {
+			return errors.New("'departed_at' requires 'arrived_at'")
+		}
+		if !visit.DepartedAt.After(*visit.ArrivedAt) {
+			return errors.New("'departed_at' must be after 'arrived_at'")
+		}
+		if visit.DepartedAt.Sub(*visit.ArrivedAt) > MaxStay {
+			return errors.New("'departed_at' must be at most 366 days after 'arrived_at'")
+		}
+	}
 	return nil
 }
 
-// GetVisits gets a list of Visit entities from the database.
-func (c *Client) GetVisits(userId string, start, limit int) ([]Visit, error) {
-	result, err := r.Table(c.config.Table).GetAllByIndex("user", userId).Slice(start, start+limit).Run(c.session)
+// Location returns the time zone that a visit took place in. UTC is used when
+// no (valid) time zone was given.
+func (v *Visit) Location() *time.Location {
+	if v.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(v.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Dates returns the calendar dates (ie: "2016-04-21") spanned by a visit in
+// the visit's time zone. Visits without an arrival time span the single date
+// of their Timestamp. Visits are cut short after MaxStay, as longer visits
+// may have been saved before they were refused (see Validate).
+func (v *Visit) Dates() []string {
+	loc := v.Location()
+	if v.ArrivedAt == nil {
+		return []string{v.Timestamp.In(loc).Format("2006-01-02")}
+	}
+	arrived := v.ArrivedAt.In(loc)
+	departed := arrived
+	if v.DepartedAt != nil {
+		departed = v.DepartedAt.In(loc)
+	}
+	if departed.Sub(arrived) > MaxStay {
+		departed = arrived.Add(MaxStay)
+	}
+	dates := make([]string, 0)
+	day := time.Date(arrived.Year(), arrived.Month(), arrived.Day(), 0, 0, 0, 0, loc)
+	for !day.After(departed) {
+		dates = append(dates, day.Format("2006-01-02"))
+		day = day.AddDate(0, 0, 1)
+	}
+	return dates
+}
+
+// GetVisits gets a list of Visit entities from the database which match the
+// given query.
+func (c *Client) GetVisits(q Query) ([]Visit, error) {
+	start := q.Start
+	if q.After != nil {
+		start = 0
+	}
+	result, err := q.term(c.config.Table).Slice(start, start+q.Limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
+	}
+	visits := make([]Visit, 0)
+	var v Visit
+	for result.Next(&v) {
+		visits = append(visits, v)
+		v = Visit{}
+	}
+	return visits, nil
+}
+
+// GetVisitsByIDs gets the Visit entities with the given ids from the
+// database. Visits are returned in the same order as the given ids and ids
+// which do not exist (or were deleted) are skipped.
+func (c *Client) GetVisitsByIDs(visitIds []string) ([]Visit, error) {
+	visits := make([]Visit, 0)
+	if len(visitIds) == 0 {
+		return visits, nil
+	}
+	keys := make([]interface{}, len(visitIds))
+	for i, id := range visitIds {
+		keys[i] = id
+	}
+	result, err := visible(r.Table(c.config.Table).GetAll(keys...), false).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
+	}
+	byID := make(map[string]Visit)
+	var v Visit
+	for result.Next(&v) {
+		byID[v.ID] = v
+		v = Visit{}
+	}
+	for _, id := range visitIds {
+		if v, ok := byID[id]; ok {
+			visits = append(visits, v)
+		}
+	}
+	return visits, nil
+}
+
+// GetVisitsBetween gets a list of a user's Visit entities with timestamps in
+// the range [from, to], ordered by timestamp.
+func (c *Client) GetVisitsBetween(userId string, from, to time.Time) ([]Visit, error) {
+	result, err := visible(r.Table(c.config.Table).Between(
+		[]interface{}{userId, from},
+		[]interface{}{userId, to, r.MaxVal},
+		r.BetweenOpts{Index: "user_timestamp", RightBound: "closed"},
+	).OrderBy(r.OrderByOpts{Index: "user_timestamp"}), false).Run(c.session)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
 	}
@@ -68,14 +230,59 @@ func (c *Client) GetVisits(userId string, start, limit int) ([]Visit, error) {
 	var v Visit
 	for result.Next(&v) {
 		visits = append(visits, v)
+		v = Visit{}
+	}
+	return visits, nil
+}
+
+// GetFeed gets the most recent public visits of the given users merged into
+// a single list, most recent first. Each user's visits are read in order
+// from the "user_timestamp" index, so only enough of them to fill the page
+// are considered.
+func (c *Client) GetFeed(userIds []string, start, limit int) ([]Visit, error) {
+	visits := make([]Visit, 0)
+	if len(userIds) == 0 {
+		return visits, nil
+	}
+	table := r.Table(c.config.Table)
+	result, err := r.Expr(userIds).ConcatMap(func(user r.Term) interface{} {
+		return visible(table.Between(
+			[]interface{}{user, r.MinVal, r.MinVal},
+			[]interface{}{user, r.MaxVal, r.MaxVal},
+			r.BetweenOpts{Index: "user_timestamp"},
+		).OrderBy(r.OrderByOpts{Index: r.Desc("user_timestamp")}), true).Limit(start + limit)
+	}).OrderBy(r.Desc("timestamp"), r.Desc("id")).Slice(start, start+limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
+	}
+	var v Visit
+	for result.Next(&v) {
+		visits = append(visits, v)
+		v = Visit{}
 	}
 	return visits, nil
 }
 
+// visible filters deleted visits out of a sequence of visits, along with
+// private visits when public is true.
+func visible(term r.Term, public bool) r.Term {
+	term = term.Filter(r.Row.HasFields("deleted_at").Not())
+	if !public {
+		return term
+	}
+	return term.Filter(r.Row.Field("private").Default(false).Eq(false))
+}
+
+// userVisits returns the sequence of a user's visits, excluding private
+// visits when public is true.
+func (c *Client) userVisits(userId string, public bool) r.Term {
+	return visible(r.Table(c.config.Table).GetAllByIndex("user", userId), public)
+}
+
 // GetStates gets a unique list of states visited by a given user from the
-// database.
-func (c *Client) GetStates(userId string) ([]string, error) {
-	result, err := r.Table(c.config.Table).GetAllByIndex("user", userId).Field("state").Distinct().Run(c.session)
+// database. Private visits are excluded when public is true.
+func (c *Client) GetStates(userId string, public bool) ([]string, error) {
+	result, err := c.userVisits(userId, public).Field("state").Distinct().Run(c.session)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
 	}
@@ -88,9 +295,9 @@ func (c *Client) GetStates(userId string) ([]string, error) {
 }
 
 // GetCities gets a unique list of cities visited by a given user from the
-// database.
-func (c *Client) GetCities(userId string) ([]string, error) {
-	result, err := r.Table(c.config.Table).GetAllByIndex("user", userId).Field("city").Distinct().Run(c.session)
+// database. Private visits are excluded when public is true.
+func (c *Client) GetCities(userId string, public bool) ([]string, error) {
+	result, err := c.userVisits(userId, public).Field("city").Distinct().Run(c.session)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
 	}
@@ -102,27 +309,399 @@ func (c *Client) GetCities(userId string) ([]string, error) {
 	return cities, nil
 }
 
-// Add inserts a new Visit instance into the database.
-func (c *Client) Add(visit *Visit) error {
+// FindDuplicate looks for an existing visit by the same user to the same
+// city/state within the configured dedup window of the given visit's
+// timestamp. The earliest duplicate (ordered by timestamp, then id) is
+// returned, or a nil Visit if no duplicate exists.
+func (c *Client) FindDuplicate(visit *Visit) (*Visit, error) {
+	if c.config.DedupWindow <= 0 {
+		return nil, nil
+	}
+	state := strings.ToUpper(visit.State)
+	result, err := visible(r.Table(c.config.Table).Between(
+		[]interface{}{visit.User, state, visit.City, visit.Timestamp.Add(-c.config.DedupWindow)},
+		[]interface{}{visit.User, state, visit.City, visit.Timestamp.Add(c.config.DedupWindow), r.MaxVal},
+		r.BetweenOpts{Index: "user_state_city_timestamp", RightBound: "closed"},
+	).OrderBy(r.OrderByOpts{Index: "user_state_city_timestamp"}), false).Limit(1).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look for duplicate visits: %s", err.Error())
+	}
+	var dup Visit
+	if !result.Next(&dup) {
+		return nil, nil
+	}
+	return &dup, nil
+}
+
+// GetDays totals the distinct calendar days a given user has spent in each
+// state & city. Overlapping visits to the same place are only counted once.
+// Private visits are excluded when public is true.
+func (c *Client) GetDays(userId string, public bool) (*Days, error) {
+	result, err := c.userVisits(userId, public).Pluck(
+		"city", "state", "timestamp", "arrived_at", "departed_at", "time_zone",
+	).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
+	}
+	states := make(map[string]map[string]bool)
+	cities := make(map[string]map[string]bool)
+	var v Visit
+	for result.Next(&v) {
+		city := v.City + "," + v.State
+		if states[v.State] == nil {
+			states[v.State] = make(map[string]bool)
+		}
+		if cities[city] == nil {
+			cities[city] = make(map[string]bool)
+		}
+		for _, d := range v.Dates() {
+			states[v.State][d] = true
+			cities[city][d] = true
+		}
+		v = Visit{}
+	}
+
+	return &Days{
+		States: dayCounts(states),
+		Cities: dayCounts(cities),
+	}, nil
+}
+
+// dayCounts counts the dates spent in each place, sorted by place.
+func dayCounts(places map[string]map[string]bool) []DayCount {
+	counts := make([]DayCount, 0, len(places))
+	for place, dates := range places {
+		counts = append(counts, DayCount{Place: place, Days: len(dates)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Place < counts[j].Place
+	})
+	return counts
+}
+
+// Add inserts a new Visit instance into the database. If a duplicate visit
+// already exists (see FindDuplicate) then nothing is inserted and the given
+// visit is overwritten with the existing one. Visits which are posted at the
+// same time can not both see that the other exists, so they are also given
+// the same id when they fall in the same period of the dedup window (see
+// dedupID), & only the first to be inserted is kept. Duplicates which fall
+// in different periods are both inserted, so duplicates are looked for
+// again once inserted, & every visit but the earliest moves itself to the
+// trash (see Delete).
+func (c *Client) Add(by Actor, visit *Visit) error {
 	// Store states in uppercase for consistency.
 	visit.State = strings.ToUpper(visit.State)
-	result, err := r.Table(c.config.Table).Insert(visit).RunWrite(c.session)
+	// Visits logged after the fact are timestamped by their arrival.
+	if visit.ArrivedAt != nil {
+		visit.Timestamp = *visit.ArrivedAt
+	}
+	dup, err := c.FindDuplicate(visit)
+	if err != nil {
+		return err
+	}
+	if dup != nil {
+		*visit = *dup
+		return nil
+	}
+	visit.ID = newID()
+	if c.config.DedupWindow > 0 {
+		visit.ID = c.dedupID(visit)
+	}
+	res, err := r.Table(c.config.Table).Insert(recordedInsert(visit, by)).RunWrite(c.session)
+	if err == nil && res.Errors > 0 {
+		err = errors.New(res.FirstError)
+	}
+	if err != nil && c.config.DedupWindow > 0 {
+		// The id is taken, either by a visit which was inserted since
+		// FindDuplicate looked, or by a deleted visit which it ignored.
+		if dup, getErr := c.Get(visit.ID); getErr == nil && dup != nil {
+			if dup.DeletedAt == nil {
+				*visit = *dup
+				return nil
+			}
+			visit.ID = newID()
+			_, err = r.Table(c.config.Table).Insert(recordedInsert(visit, by)).RunWrite(c.session)
+		}
+	}
 	if err != nil {
+		visit.ID = ""
 		return fmt.Errorf("unable to add visit: %s", err.Error())
 	}
-	visit.ID = result.GeneratedKeys[0]
+	if c.config.DedupWindow <= 0 {
+		return nil
+	}
+	// Every racing visit sees the same earliest duplicate, so exactly one of
+	// them is kept.
+	first, err := c.FindDuplicate(visit)
+	if err != nil {
+		return err
+	}
+	if first != nil && first.ID != visit.ID {
+		if err := c.Delete(by, visit.ID); err != nil {
+			return err
+		}
+		*visit = *first
+	}
+	return nil
+}
+
+// dedupID returns the id shared by the visits of a user to a city/state in
+// the same period of the dedup window, so that a visit which is posted twice
+// at once is only inserted once.
+func (c *Client) dedupID(visit *Visit) string {
+	period := visit.Timestamp.UnixNano() / int64(c.config.DedupWindow)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d", visit.User, visit.State, visit.City, period)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// SetTrip associates the given visits with a trip. An empty tripId removes
+// any existing association. Deleted visits are left as they are, so that
+// changing a trip does not record changes to the visits in the trash.
+func (c *Client) SetTrip(by Actor, visitIds []string, tripId string) error {
+	if len(visitIds) == 0 {
+		return nil
+	}
+	keys := make([]interface{}, len(visitIds))
+	for i, id := range visitIds {
+		keys[i] = id
+	}
+	change := func(v r.Term) r.Term {
+		if tripId == "" {
+			// Remove the field entirely so the visit drops out of the trip
+			// index.
+			return v.Without("trip")
+		}
+		return v.Merge(map[string]interface{}{"trip": tripId})
+	}
+	write := c.recorded(visible(r.Table(c.config.Table).GetAll(keys...), false), change, EventUpdated, by)
+	_, err := write.RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to set visit trip: %s", err.Error())
+	}
 	return nil
 }
 
-// Delete removes a Visit instance from the database given a unique visitId.
-func (c *Client) Delete(visitId string) error {
-	_, err := r.Table(c.config.Table).Get(visitId).Delete().RunWrite(c.session)
+// Get gets a single Visit entity, deleted or not. A nil Visit is returned
+// when it does not exist.
+func (c *Client) Get(visitId string) (*Visit, error) {
+	result, err := r.Table(c.config.Table).Get(visitId).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visit: %s", err.Error())
+	}
+	if result.IsNil() {
+		return nil, nil
+	}
+	v := &Visit{}
+	if err := result.One(v); err != nil {
+		return nil, fmt.Errorf("unable to get visit: %s", err.Error())
+	}
+	return v, nil
+}
+
+// Delete moves a Visit instance to the trash given a unique visitId, by
+// tombstoning it with the time it was deleted. Deleted visits are left out
+// of every query other than GetTrash until they are restored or purged.
+func (c *Client) Delete(by Actor, visitId string) error {
+	write := c.recorded(r.Table(c.config.Table).Get(visitId), tombstone, EventDeleted, by)
+	_, err := write.RunWrite(c.session)
 	if err != nil {
 		return fmt.Errorf("unable to delete visit: %s", err.Error())
 	}
 	return nil
 }
 
+// tombstone moves a visit to the trash, unless it is already there.
+func tombstone(v r.Term) r.Term {
+	return r.Branch(v.HasFields("deleted_at"), v, v.Merge(map[string]interface{}{
+		"deleted_at": r.Now(),
+	}))
+}
+
+// Restore takes a deleted visit back out of the trash.
+func (c *Client) Restore(by Actor, visitId string) error {
+	write := c.recorded(r.Table(c.config.Table).Get(visitId), func(v r.Term) r.Term {
+		return v.Without("deleted_at")
+	}, EventRestored, by)
+	_, err := write.RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to restore visit: %s", err.Error())
+	}
+	return nil
+}
+
+// GetTrash gets a user's deleted visits, most recently deleted first.
+func (c *Client) GetTrash(userId string, start, limit int) ([]Visit, error) {
+	result, err := r.Table(c.config.Table).Between(
+		[]interface{}{userId, r.MinVal},
+		[]interface{}{userId, r.MaxVal},
+		r.BetweenOpts{Index: "user_deleted_at"},
+	).OrderBy(r.OrderByOpts{Index: r.Desc("user_deleted_at")}).Slice(start, start+limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get deleted visits: %s", err.Error())
+	}
+	visits := make([]Visit, 0)
+	var v Visit
+	for result.Next(&v) {
+		visits = append(visits, v)
+		v = Visit{}
+	}
+	return visits, nil
+}
+
+// Purge permanently removes the visits which were deleted before the given
+// time. The ids of the removed visits are returned. No events are recorded,
+// since they were when the visits were deleted, though visits are kept until
+// those have been collected.
+func (c *Client) Purge(before time.Time) ([]string, error) {
+	result, err := r.Table(c.config.Table).Between(
+		r.MinVal, before, r.BetweenOpts{Index: "deleted_at"},
+	).Filter(r.Row.HasFields(pendingField).Not()).Delete(r.DeleteOpts{ReturnChanges: true}).RunWrite(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to purge deleted visits: %s", err.Error())
+	}
+	ids := make([]string, 0, len(result.Changes))
+	for _, ch := range result.Changes {
+		if old, ok := ch.OldValue.(map[string]interface{}); ok {
+			if id, ok := old["id"].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Dedupe finds historical duplicate visits for a given user and merges them
+// by keeping the earliest visit and moving any later visits to the same
+// city/state that fall within the window of the kept visit to the trash.
+// When preview is true, the merges are computed but nothing is removed.
+func (c *Client) Dedupe(by Actor, userId string, window time.Duration, preview bool) ([]Merge, error) {
+	result, err := visible(r.Table(c.config.Table).Between(
+		[]interface{}{userId, r.MinVal, r.MinVal, r.MinVal},
+		[]interface{}{userId, r.MaxVal, r.MaxVal, r.MaxVal},
+		r.BetweenOpts{Index: "user_state_city_timestamp"},
+	).OrderBy(r.OrderByOpts{Index: "user_state_city_timestamp"}), false).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visits: %s", err.Error())
+	}
+
+	// Visits are ordered by state, city & time so duplicates are adjacent.
+	merges := make([]Merge, 0)
+	var cur *Merge
+	var v Visit
+	for result.Next(&v) {
+		if cur != nil && v.State == cur.Kept.State && v.City == cur.Kept.City &&
+			v.Timestamp.Sub(cur.Kept.Timestamp) <= window {
+			cur.Removed = append(cur.Removed, v)
+		} else {
+			if cur != nil && len(cur.Removed) > 0 {
+				merges = append(merges, *cur)
+			}
+			cur = &Merge{Kept: v, Removed: make([]Visit, 0)}
+		}
+		v = Visit{}
+	}
+	if cur != nil && len(cur.Removed) > 0 {
+		merges = append(merges, *cur)
+	}
+	if preview {
+		return merges, nil
+	}
+
+	ids := make([]interface{}, 0)
+	for _, m := range merges {
+		for _, rm := range m.Removed {
+			ids = append(ids, rm.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return merges, nil
+	}
+	write := c.recorded(r.Table(c.config.Table).GetAll(ids...), tombstone, EventDeleted, by)
+	if _, err := write.RunWrite(c.session); err != nil {
+		return nil, fmt.Errorf("unable to delete duplicate visits: %s", err.Error())
+	}
+	return merges, nil
+}
+
+// Change is a single change to the visits table. Old is nil for newly added
+// (or restored) visits and New is nil for deleted visits.
+type Change struct {
+	Old *Visit `gorethink:"old_val"`
+	New *Visit `gorethink:"new_val"`
+}
+
+// User returns the user whose visit was changed.
+func (ch *Change) User() string {
+	if ch.New != nil {
+		return ch.New.User
+	}
+	if ch.Old != nil {
+		return ch.Old.User
+	}
+	return ""
+}
+
+// ChangeFeed is an abstraction over a rethinkdb change-feed which, unlike
+// VisitFeed, includes deletions.
+type ChangeFeed struct {
+	cursor *r.Cursor
+}
+
+// Next grabs the next change from the ChangeFeed change-feed. Deleted visits
+// are treated as if they were removed, so moving a visit to the trash is a
+// deletion, restoring it is an addition and purging it is not a change.
+func (cf *ChangeFeed) Next(change *Change) bool {
+	for {
+		*change = Change{}
+		if !cf.cursor.Next(change) {
+			return false
+		}
+		if change.Old != nil && change.Old.DeletedAt != nil {
+			change.Old = nil
+		}
+		if change.New != nil && change.New.DeletedAt != nil {
+			change.New = nil
+		}
+		if change.Old != nil || change.New != nil {
+			return true
+		}
+	}
+}
+
+// Err returns the error, if any, which closed the change-feed.
+func (cf *ChangeFeed) Err() error {
+	return cf.cursor.Err()
+}
+
+// Close closes the change-feed.
+func (cf *ChangeFeed) Close() error {
+	return cf.cursor.Close()
+}
+
+// Changes opens a change feed of all additions, updates & deletions from the
+// db.
+func (c *Client) Changes() (*ChangeFeed, error) {
+	cursor, err := unrecorded(r.Table(c.config.Table).Changes()).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open visits change-feed: %s", err.Error())
+	}
+	return &ChangeFeed{cursor}, nil
+}
+
+// GetUsers gets a unique list of all users who have visits.
+func (c *Client) GetUsers() ([]string, error) {
+	result, err := r.Table(c.config.Table).Distinct(r.DistinctOpts{Index: "user"}).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get users: %s", err.Error())
+	}
+	users := make([]string, 0)
+	var u string
+	for result.Next(&u) {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
 // VisitFeed is an abstraction over a rethinkdb change-feed.
 type VisitFeed struct {
 	cursor *r.Cursor
@@ -130,9 +709,10 @@ type VisitFeed struct {
 
 // Next grabs the next visit from the VisitFeed change-feed.
 func (vs *VisitFeed) Next(visit *Visit) bool {
+	*visit = Visit{}
 	if vs.cursor.Next(visit) {
-		// If it is an empty record (ie: a visit was deleted)
-		if visit.ID == "" {
+		// If it is an empty record (ie: a visit was purged) or a deleted visit
+		if visit.ID == "" || visit.DeletedAt != nil {
 			// Try again.
 			return vs.Next(visit)
 		} else {
@@ -147,7 +727,7 @@ func (vs *VisitFeed) Next(visit *Visit) bool {
 
 // Stream opens a change feed from the db.
 func (c *Client) Stream() (*VisitFeed, error) {
-	cursor, err := r.Table(c.config.Table).Changes().Field("new_val").Run(c.session)
+	cursor, err := unrecorded(r.Table(c.config.Table).Changes()).Field("new_val").Run(c.session)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open visits change-feed: %s", err.Error())
 	}
@@ -0,0 +1,51 @@
+package visits
+
+import "sort"
+
+// Comparison splits the places (ie: states) visited by two users into those
+// visited by both & those visited by only one of them.
+type Comparison struct {
+	Both      []string `json:"both" xml:"both"`
+	OnlyUser  []string `json:"only_user" xml:"only_user"`
+	OnlyOther []string `json:"only_other" xml:"only_other"`
+	// Similarity is the Jaccard index of the two sets of places: the number
+	// visited by both divided by the number visited by either.
+	Similarity float64 `json:"similarity" xml:"similarity"`
+}
+
+// Compare compares the places visited by a user with those of another user.
+func Compare(user, other []string) *Comparison {
+	c := &Comparison{
+		Both:      make([]string, 0),
+		OnlyUser:  make([]string, 0),
+		OnlyOther: make([]string, 0),
+	}
+	inOther := make(map[string]bool)
+	for _, p := range other {
+		inOther[p] = true
+	}
+	inUser := make(map[string]bool)
+	for _, p := range user {
+		if inUser[p] {
+			continue
+		}
+		inUser[p] = true
+		if inOther[p] {
+			c.Both = append(c.Both, p)
+		} else {
+			c.OnlyUser = append(c.OnlyUser, p)
+		}
+	}
+	for p := range inOther {
+		if !inUser[p] {
+			c.OnlyOther = append(c.OnlyOther, p)
+		}
+	}
+	sort.Strings(c.Both)
+	sort.Strings(c.OnlyUser)
+	sort.Strings(c.OnlyOther)
+	if union := len(c.Both) + len(c.OnlyUser) + len(c.OnlyOther); union > 0 {
+		c.Similarity = float64(len(c.Both)) / float64(union)
+	}
+	return c
+}
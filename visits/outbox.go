@@ -0,0 +1,181 @@
+package visits
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// Types of events recorded in the outbox.
+const (
+	EventCreated  = "visit.created"
+	EventUpdated  = "visit.updated"
+	EventDeleted  = "visit.deleted"
+	EventRestored = "visit.restored"
+)
+
+// pendingField holds the changes made to a visit document which are yet to
+// be collected (see Collect). Since RethinkDB only makes writes to a single
+// document atomic, recording a change in the document it changes is the only
+// way to record it atomically.
+const pendingField = "pending_events"
+
+// Event is a db structure recording a change to a visit in the outbox table.
+// Events are ordered by (Created, ID).
+type Event struct {
+	ID      string    `json:"id" xml:"id" gorethink:"id,omitempty"`
+	Type    string    `json:"event" xml:"event" gorethink:"event"`
+	Visit   *Visit    `json:"visit" xml:"visit" gorethink:"visit"`
+	Created time.Time `json:"created" xml:"created" gorethink:"created"`
+}
+
+// pending is a change recorded in a visit document (see pendingField). It
+// becomes both an Event & an AuditEntry when collected.
+type pending struct {
+	ID      string    `gorethink:"id"`
+	Event   string    `gorethink:"event"`
+	Actor   Actor     `gorethink:"actor"`
+	Before  *Visit    `gorethink:"before"`
+	After   *Visit    `gorethink:"after"`
+	Created time.Time `gorethink:"created"`
+}
+
+// newID returns a random id, used for new visits & to identify the changes
+// made by a single write.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recorded replaces each selected visit with the result of change & records
+// the change in the visit document in the same write (see pendingField).
+// Visits which change leaves as they were are not written, and missing
+// visits are ignored.
+func (c *Client) recorded(sel r.Term, change func(v r.Term) r.Term, event string, by Actor) r.Term {
+	write := newID()
+	return sel.Replace(func(v r.Term) interface{} {
+		before := v.Without(pendingField)
+		after := change(before)
+		return r.Branch(
+			v.Eq(nil), nil,
+			after.Eq(before), v,
+			after.Merge(map[string]interface{}{
+				pendingField: v.Field(pendingField).Default([]interface{}{}).Append(map[string]interface{}{
+					"id":      r.Expr(write + "-").Add(v.Field("id")),
+					"event":   event,
+					"actor":   by,
+					"before":  before,
+					"after":   after,
+					"created": r.Now(),
+				}),
+			}),
+		)
+	})
+}
+
+// recordedInsert returns the document of a new visit along with the record
+// of its creation (see recorded). The visit must have an id.
+func recordedInsert(visit *Visit, by Actor) r.Term {
+	return r.Expr(visit).Merge(map[string]interface{}{
+		pendingField: []interface{}{map[string]interface{}{
+			"id":      newID() + "-" + visit.ID,
+			"event":   EventCreated,
+			"actor":   by,
+			"before":  nil,
+			"after":   visit,
+			"created": r.Now(),
+		}},
+	})
+}
+
+// unrecorded filters the changes of a visits change-feed which only collected
+// a visit's recorded changes, & so did not change the visit itself.
+func unrecorded(feed r.Term) r.Term {
+	return feed.Filter(func(ch r.Term) r.Term {
+		return r.Branch(
+			ch.Field("old_val").Eq(nil).Or(ch.Field("new_val").Eq(nil)), true,
+			ch.Field("old_val").Without(pendingField).Ne(ch.Field("new_val").Without(pendingField)),
+		)
+	})
+}
+
+// Collect moves the changes recorded in up to limit visit documents (see
+// recorded), oldest first, to the audit table & to add, which is expected to
+// add their events to the outbox. Changes are only removed from their visits
+// once add succeeds, so a change may be collected more than once, but never
+// lost. The number of visits whose changes were collected is returned.
+func (c *Client) Collect(add func(events []Event) error, limit int) (int, error) {
+	result, err := r.Table(c.config.Table).Between(
+		r.MinVal, r.MaxVal, r.BetweenOpts{Index: "pending"},
+	).OrderBy(r.OrderByOpts{Index: "pending"}).Limit(limit).Run(c.session)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get recorded changes: %s", err.Error())
+	}
+	type doc struct {
+		ID      string    `gorethink:"id"`
+		Pending []pending `gorethink:"pending_events"`
+	}
+	docIds := make([]interface{}, 0)
+	ids := make([]interface{}, 0)
+	events := make([]Event, 0)
+	entries := make([]AuditEntry, 0)
+	var d doc
+	for result.Next(&d) {
+		docIds = append(docIds, d.ID)
+		for _, p := range d.Pending {
+			// Deleted visits are described as they were before.
+			visit := p.After
+			if p.Event == EventDeleted {
+				visit = p.Before
+			}
+			ids = append(ids, p.ID)
+			events = append(events, Event{ID: p.ID, Type: p.Event, Visit: visit, Created: p.Created})
+			entries = append(entries, AuditEntry{
+				ID:     p.ID,
+				Visit:  d.ID,
+				User:   visit.User,
+				Action: p.Event,
+				Actor:  p.Actor,
+				Before: p.Before,
+				After:  p.After,
+				Time:   p.Created,
+			})
+		}
+		d = doc{}
+	}
+	if err := result.Err(); err != nil {
+		return 0, fmt.Errorf("unable to read recorded changes: %s", err.Error())
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if c.config.AuditTable != "" {
+		_, err := r.Table(c.config.AuditTable).Insert(entries, r.InsertOpts{Conflict: "replace"}).RunWrite(c.session)
+		if err != nil {
+			return 0, fmt.Errorf("unable to record visit audit entries: %s", err.Error())
+		}
+	}
+	if err := add(events); err != nil {
+		return 0, err
+	}
+	// Changes which were recorded while collecting are kept.
+	_, err = r.Table(c.config.Table).GetAll(docIds...).Replace(func(v r.Term) interface{} {
+		left := v.Field(pendingField).Default([]interface{}{}).Filter(func(p r.Term) r.Term {
+			return r.Expr(ids).Contains(p.Field("id")).Not()
+		})
+		return r.Branch(
+			v.Eq(nil), nil,
+			left.IsEmpty(), v.Without(pendingField),
+			v.Merge(map[string]interface{}{pendingField: left}),
+		)
+	}).RunWrite(c.session)
+	if err != nil {
+		return 0, fmt.Errorf("unable to remove collected changes: %s", err.Error())
+	}
+	return len(docIds), nil
+}
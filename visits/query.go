@@ -0,0 +1,175 @@
+package visits
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// Sort orders for visit queries.
+const (
+	SortTimestamp     = "timestamp"
+	SortTimestampDesc = "-timestamp"
+	SortCity          = "city"
+)
+
+// Query describes a filtered, sorted & paginated list of a user's visits.
+// Zero values are ignored when filtering.
+type Query struct {
+	User  string
+	State string
+	City  string
+	Trip  string
+	From  time.Time
+	To    time.Time
+	Sort  string
+	Start int
+	Limit int
+	// Public excludes private visits.
+	Public bool
+	// After continues a previous listing from the given position (see
+	// Cursored). When set, Start is ignored.
+	After *Cursor
+}
+
+// Cursor marks a position in a list of visits ordered by (timestamp, id).
+// Unlike offsets, cursors are not affected by visits being added or removed
+// while paging.
+type Cursor struct {
+	Timestamp time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// CursorAfter returns the Cursor which continues a listing after the given
+// visit.
+func CursorAfter(v Visit) *Cursor {
+	return &Cursor{
+		Timestamp: v.Timestamp,
+		ID:        v.ID,
+	}
+}
+
+// Encode returns an opaque token representing the cursor.
+func (c *Cursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode.
+func DecodeCursor(token string) (*Cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(js, c); err != nil || c.ID == "" {
+		return nil, errors.New("malformed cursor")
+	}
+	return c, nil
+}
+
+// Validate returns a non-nil error for an invalid Query.
+func (q *Query) Validate() error {
+	switch q.Sort {
+	case "", SortTimestamp, SortTimestampDesc, SortCity:
+	default:
+		return errors.New("'sort' must be one of: timestamp, -timestamp, city")
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return errors.New("'to' must not be before 'from'")
+	}
+	if q.After != nil && !q.Cursored() {
+		return errors.New("cursors require sorting by 'timestamp' or '-timestamp'")
+	}
+	return nil
+}
+
+// Cursored returns true when the query's results are ordered by (timestamp,
+// id) via an index and can therefore be paged through using a Cursor.
+func (q *Query) Cursored() bool {
+	if q.Sort == SortCity {
+		return false
+	}
+	_, _, timeIndexed := q.plan()
+	return timeIndexed
+}
+
+// plan picks the compound index which best serves the query. The returned
+// prefix holds the values of the leading index fields. When timeIndexed is
+// true, the field following the prefix is the timestamp.
+func (q *Query) plan() (index string, prefix []interface{}, timeIndexed bool) {
+	state := strings.ToUpper(q.State)
+	switch {
+	case q.Trip != "":
+		return "trip_timestamp", []interface{}{q.Trip}, true
+	case state != "" && q.City != "":
+		return "user_state_city_timestamp", []interface{}{q.User, state, q.City}, true
+	case state != "" && q.Sort == SortCity:
+		return "user_state_city_timestamp", []interface{}{q.User, state}, false
+	case state != "":
+		return "user_state_timestamp", []interface{}{q.User, state}, true
+	case q.City != "":
+		return "user_city_timestamp", []interface{}{q.User, q.City}, true
+	case q.Sort == SortCity:
+		return "user_city_timestamp", []interface{}{q.User}, false
+	default:
+		return "user_timestamp", []interface{}{q.User}, true
+	}
+}
+
+// term builds the (unpaginated) rethinkdb query. Filtering & sorting is
+// served by a compound index, only falling back to filtering within the
+// database for the uncommon combinations which no index covers.
+func (q *Query) term(table string) r.Term {
+	index, prefix, timeIndexed := q.plan()
+
+	// Timestamp indexes end with the visit id, so bounds are padded with
+	// min/max values to include every id at a given timestamp.
+	lower := append(append([]interface{}{}, prefix...), r.MinVal, r.MinVal)
+	upper := append(append([]interface{}{}, prefix...), r.MaxVal, r.MaxVal)
+	if timeIndexed && !q.From.IsZero() {
+		lower[len(prefix)] = q.From
+	}
+	if timeIndexed && !q.To.IsZero() {
+		upper[len(prefix)] = q.To
+	}
+	opts := r.BetweenOpts{Index: index, LeftBound: "closed", RightBound: "closed"}
+	if q.After != nil && q.Sort == SortTimestampDesc {
+		upper[len(prefix)], upper[len(prefix)+1] = q.After.Timestamp, q.After.ID
+		opts.RightBound = "open"
+	} else if q.After != nil {
+		lower[len(prefix)], lower[len(prefix)+1] = q.After.Timestamp, q.After.ID
+		opts.LeftBound = "open"
+	}
+	term := r.Table(table).Between(lower, upper, opts)
+
+	if q.Trip != "" && q.Sort == SortCity {
+		// Trips are small, so sort them without an index.
+		term = term.OrderBy("city", "timestamp")
+	} else if q.Sort == SortTimestampDesc {
+		term = term.OrderBy(r.OrderByOpts{Index: r.Desc(index)})
+	} else {
+		term = term.OrderBy(r.OrderByOpts{Index: index})
+	}
+
+	if q.Trip != "" {
+		term = term.Filter(r.Row.Field("user").Eq(q.User))
+		if q.State != "" {
+			term = term.Filter(r.Row.Field("state").Eq(strings.ToUpper(q.State)))
+		}
+		if q.City != "" {
+			term = term.Filter(r.Row.Field("city").Eq(q.City))
+		}
+	}
+	if !timeIndexed && !q.From.IsZero() {
+		term = term.Filter(r.Row.Field("timestamp").Ge(q.From))
+	}
+	if !timeIndexed && !q.To.IsZero() {
+		term = term.Filter(r.Row.Field("timestamp").Le(q.To))
+	}
+	return visible(term, q.Public)
+}
@@ -0,0 +1,201 @@
+package visits
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+// Stats summarizes a user's visits.
+type Stats struct {
+	Visits     int            `json:"visits" xml:"visits"`
+	States     []string       `json:"-" xml:"-"`
+	Cities     int            `json:"cities" xml:"cities"`
+	FirstVisit *time.Time     `json:"first_visit,omitempty" xml:"first_visit,omitempty"`
+	LastVisit  *time.Time     `json:"last_visit,omitempty" xml:"last_visit,omitempty"`
+	TopCity    *CityCount     `json:"top_city,omitempty" xml:"top_city,omitempty"`
+	PerYear    map[string]int `json:"visits_per_year" xml:"visits_per_year"`
+}
+
+// CityCount is the number of times a user visited a city.
+type CityCount struct {
+	City   string `json:"city" xml:"city"`
+	State  string `json:"state" xml:"state"`
+	Visits int    `json:"visits" xml:"visits"`
+}
+
+// Totals holds the number of visits a user has made to each city (keyed as
+// "City,ST") & per month (keyed as "YYYY-MM" in UTC) along with the time of
+// their most recent visit. Private is the number of the user's private
+// visits, whether or not they were counted.
+type Totals struct {
+	Cities    map[string]int
+	Months    map[string]int
+	LastVisit *time.Time
+	Private   int
+}
+
+// States returns the sorted, unique states of the visited cities.
+func (t *Totals) States() []string {
+	seen := make(map[string]bool)
+	states := make([]string, 0)
+	for id := range t.Cities {
+		state := id[strings.LastIndex(id, ",")+1:]
+		if !seen[state] {
+			seen[state] = true
+			states = append(states, state)
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+// CityIDs returns the sorted ids ("City,ST") of the visited cities.
+func (t *Totals) CityIDs() []string {
+	ids := make([]string, 0, len(t.Cities))
+	for id := range t.Cities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// groupCount is a single result of a grouped count after being ungrouped.
+type groupCount struct {
+	Group     interface{} `gorethink:"group"`
+	Reduction int         `gorethink:"reduction"`
+}
+
+// GetStats aggregates a user's visits. All of the aggregation is done within
+// the database in a single query so that users with many visits do not need
+// to be paged through. Private visits are excluded when public is true.
+func (c *Client) GetStats(userId string, public bool) (*Stats, error) {
+	visits := c.userVisits(userId, public)
+	byTime := r.Table(c.config.Table).Between(
+		[]interface{}{userId, r.MinVal, r.MinVal},
+		[]interface{}{userId, r.MaxVal, r.MaxVal},
+		r.BetweenOpts{Index: "user_timestamp"},
+	)
+	result, err := r.Expr(map[string]interface{}{
+		"visits": visits.Count(),
+		"states": visits.Field("state").Distinct(),
+		"cities": visits.Map(func(v r.Term) interface{} {
+			return []interface{}{v.Field("city"), v.Field("state")}
+		}).Distinct().Count(),
+		"first": visible(byTime.OrderBy(r.OrderByOpts{Index: "user_timestamp"}), public).
+			Limit(1).Field("timestamp").CoerceTo("array"),
+		"last": visible(byTime.OrderBy(r.OrderByOpts{Index: r.Desc("user_timestamp")}), public).
+			Limit(1).Field("timestamp").CoerceTo("array"),
+		"top_city": visits.Group("city", "state").Count().Ungroup().
+			OrderBy(r.Desc("reduction")).Limit(1),
+		// Years are in UTC, like the months of GetTotals.
+		"per_year": visits.Group(func(v r.Term) interface{} {
+			return v.Field("timestamp").InTimezone("Z").Year()
+		}).Count().Ungroup(),
+	}).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visit stats: %s", err.Error())
+	}
+
+	var raw struct {
+		Visits  int          `gorethink:"visits"`
+		States  []string     `gorethink:"states"`
+		Cities  int          `gorethink:"cities"`
+		First   []time.Time  `gorethink:"first"`
+		Last    []time.Time  `gorethink:"last"`
+		TopCity []groupCount `gorethink:"top_city"`
+		PerYear []groupCount `gorethink:"per_year"`
+	}
+	if err := result.One(&raw); err != nil {
+		return nil, fmt.Errorf("unable to read visit stats: %s", err.Error())
+	}
+
+	stats := &Stats{
+		Visits:  raw.Visits,
+		States:  raw.States,
+		Cities:  raw.Cities,
+		PerYear: make(map[string]int),
+	}
+	if len(raw.First) > 0 {
+		stats.FirstVisit = &raw.First[0]
+	}
+	if len(raw.Last) > 0 {
+		stats.LastVisit = &raw.Last[0]
+	}
+	if len(raw.TopCity) > 0 {
+		// Grouping by multiple fields results in a [city, state] group.
+		if group, ok := raw.TopCity[0].Group.([]interface{}); ok && len(group) == 2 {
+			city, _ := group[0].(string)
+			state, _ := group[1].(string)
+			stats.TopCity = &CityCount{City: city, State: state, Visits: raw.TopCity[0].Reduction}
+		}
+	}
+	for _, y := range raw.PerYear {
+		if year, ok := y.Group.(float64); ok {
+			stats.PerYear[strconv.Itoa(int(year))] = y.Reduction
+		}
+	}
+	return stats, nil
+}
+
+// GetTotals counts a user's visits per city in a single query. Private visits
+// are excluded when public is true.
+func (c *Client) GetTotals(userId string, public bool) (*Totals, error) {
+	byTime := r.Table(c.config.Table).Between(
+		[]interface{}{userId, r.MinVal, r.MinVal},
+		[]interface{}{userId, r.MaxVal, r.MaxVal},
+		r.BetweenOpts{Index: "user_timestamp"},
+	).OrderBy(r.OrderByOpts{Index: r.Desc("user_timestamp")})
+	result, err := r.Expr(map[string]interface{}{
+		"cities": c.userVisits(userId, public).
+			Group("city", "state").Count().Ungroup(),
+		"months": c.userVisits(userId, public).Group(func(v r.Term) interface{} {
+			t := v.Field("timestamp").InTimezone("Z")
+			return []interface{}{t.Year(), t.Month()}
+		}).Count().Ungroup(),
+		"last": visible(byTime, public).Limit(1).Field("timestamp").CoerceTo("array"),
+		"private": visible(r.Table(c.config.Table).GetAllByIndex("user", userId), false).
+			Filter(r.Row.Field("private").Default(false).Eq(true)).Count(),
+	}).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get visit totals: %s", err.Error())
+	}
+
+	var raw struct {
+		Cities  []groupCount `gorethink:"cities"`
+		Months  []groupCount `gorethink:"months"`
+		Last    []time.Time  `gorethink:"last"`
+		Private int          `gorethink:"private"`
+	}
+	if err := result.One(&raw); err != nil {
+		return nil, fmt.Errorf("unable to read visit totals: %s", err.Error())
+	}
+
+	totals := &Totals{
+		Cities:  make(map[string]int),
+		Months:  make(map[string]int),
+		Private: raw.Private,
+	}
+	for _, ct := range raw.Cities {
+		if group, ok := ct.Group.([]interface{}); ok && len(group) == 2 {
+			city, _ := group[0].(string)
+			state, _ := group[1].(string)
+			totals.Cities[city+","+state] = ct.Reduction
+		}
+	}
+	for _, m := range raw.Months {
+		if group, ok := m.Group.([]interface{}); ok && len(group) == 2 {
+			year, _ := group[0].(float64)
+			month, _ := group[1].(float64)
+			totals.Months[fmt.Sprintf("%04d-%02d", int(year), int(month))] = m.Reduction
+		}
+	}
+	if len(raw.Last) > 0 {
+		totals.LastVisit = &raw.Last[0]
+	}
+	return totals, nil
+}
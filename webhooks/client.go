@@ -0,0 +1,276 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// Event types which webhooks may subscribe to.
+const (
+	EventVisitCreated  = visits.EventCreated
+	EventVisitUpdated  = visits.EventUpdated
+	EventVisitDeleted  = visits.EventDeleted
+	EventVisitRestored = visits.EventRestored
+)
+
+// Delivery statuses. Dead deliveries have used up their attempts and are
+// kept as a dead-letter list.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+var (
+	ErrNotFound = errors.New("no such webhook")
+)
+
+// Webhook is a db structure subscribing a URL to visit events. Events may be
+// limited to the visits of a single user.
+type Webhook struct {
+	ID      string    `json:"id" xml:"id" gorethink:"id,omitempty"`
+	Owner   string    `json:"owner" xml:"owner" gorethink:"owner"`
+	URL     string    `json:"url" xml:"url" gorethink:"url"`
+	Events  []string  `json:"events" xml:"events" gorethink:"events"`
+	User    string    `json:"user,omitempty" xml:"user,omitempty" gorethink:"user"`
+	Created time.Time `json:"created" xml:"created" gorethink:"created"`
+	// Secret signs deliveries. It is only returned when the webhook is
+	// created.
+	Secret string `json:"secret,omitempty" xml:"secret,omitempty" gorethink:"secret"`
+}
+
+// Client acts as an api to managing webhooks & delivering events to them.
+type Client struct {
+	config  Config
+	session *r.Session
+	wake    chan struct{}
+}
+
+// Config is used to create a new instance of Client via NewClient(...).
+type Config struct {
+	Table           string
+	DeliveriesTable string
+	Profiles        *profiles.Client
+	// HTTPClient is used to make deliveries. It defaults to a client with a
+	// 10 second timeout which refuses to connect to private addresses (see
+	// AllowPrivate).
+	HTTPClient *http.Client
+	// AllowPrivate permits webhook urls on private, loopback & link-local
+	// addresses, which are otherwise refused so that webhooks cannot be used
+	// to reach the service's own network.
+	AllowPrivate bool
+	// Workers is the most deliveries attempted at once. It defaults to 8.
+	Workers int
+	// MaxAttempts is the number of attempts made before a delivery is dead.
+	// It defaults to 8.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, which doubles after each
+	// failed attempt (up to MaxBackoff). It defaults to 10 seconds.
+	Backoff time.Duration
+	// PollInterval is how often deliveries which are due for a retry are
+	// looked for. It defaults to 1 second.
+	PollInterval time.Duration
+}
+
+// MaxBackoff is the longest wait between delivery attempts.
+const MaxBackoff = time.Hour
+
+// NewClient returns a new instance of Client.
+func NewClient(conf Config, sess *r.Session) *Client {
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = newHTTPClient(conf.AllowPrivate)
+	}
+	if conf.Workers <= 0 {
+		conf.Workers = 8
+	}
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 8
+	}
+	if conf.Backoff <= 0 {
+		conf.Backoff = 10 * time.Second
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	return &Client{
+		config:  conf,
+		session: sess,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Validate returns a non-nil error when it has been passed an invalid Webhook
+// entity.
+func (c *Client) Validate(w *Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("'url' must be an absolute http(s) url")
+	}
+	if !c.config.AllowPrivate {
+		if err := checkHost(u.Hostname()); err != nil {
+			return err
+		}
+	}
+	if len(w.Events) == 0 {
+		return errors.New("missing 'events' field")
+	}
+	for _, e := range w.Events {
+		switch e {
+		case EventVisitCreated, EventVisitUpdated, EventVisitDeleted, EventVisitRestored:
+		default:
+			return fmt.Errorf("'events' must be among %q, %q, %q & %q", EventVisitCreated, EventVisitUpdated, EventVisitDeleted, EventVisitRestored)
+		}
+	}
+	return nil
+}
+
+// checkHost returns an error when a webhook host is, or resolves to, a
+// private address. Names are checked again when deliveries connect (see
+// newHTTPClient), since they may resolve differently by then.
+func checkHost(host string) error {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			return fmt.Errorf("unable to resolve 'url' host: %s", err.Error())
+		}
+	}
+	for _, ip := range ips {
+		if private(ip) {
+			return errors.New("'url' must not be a private, loopback or link-local address")
+		}
+	}
+	return nil
+}
+
+// private reports whether an ip is not a public unicast address.
+func private(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// newHTTPClient returns the default client for deliveries. Unless
+// allowPrivate is set, connections to private addresses are refused once
+// the webhook's host has been resolved, so that a name which resolves to a
+// public address when validated cannot later be rebound to a private one.
+// Proxies are not used since they would hide the address connected to.
+func newHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || private(ip) {
+				return fmt.Errorf("refusing to connect to private address %s", host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+}
+
+// Add inserts a new Webhook into the database along with a generated signing
+// secret.
+func (c *Client) Add(w *Webhook) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("unable to generate webhook secret: %s", err.Error())
+	}
+	w.Secret = hex.EncodeToString(secret)
+	w.Created = time.Now()
+	result, err := r.Table(c.config.Table).Insert(w).RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to add webhook: %s", err.Error())
+	}
+	w.ID = result.GeneratedKeys[0]
+	return nil
+}
+
+// Get retrieves one of an owner's webhooks. ErrNotFound is returned if the
+// owner has no such webhook.
+func (c *Client) Get(owner, webhookId string) (*Webhook, error) {
+	w, err := c.get(webhookId)
+	if err == nil && w.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return w, err
+}
+
+func (c *Client) get(webhookId string) (*Webhook, error) {
+	result, err := r.Table(c.config.Table).Get(webhookId).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get webhook: %s", err.Error())
+	}
+	w := &Webhook{}
+	if !result.Next(w) {
+		return nil, ErrNotFound
+	}
+	return w, nil
+}
+
+// GetByOwner gets an owner's webhooks, without their secrets.
+func (c *Client) GetByOwner(owner string) ([]Webhook, error) {
+	result, err := r.Table(c.config.Table).GetAllByIndex("owner", owner).OrderBy("created").Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get webhooks: %s", err.Error())
+	}
+	hooks := make([]Webhook, 0)
+	var w Webhook
+	for result.Next(&w) {
+		w.Secret = ""
+		hooks = append(hooks, w)
+		w = Webhook{}
+	}
+	return hooks, nil
+}
+
+// Delete removes one of an owner's webhooks along with its deliveries.
+// ErrNotFound is returned if the owner has no such webhook.
+func (c *Client) Delete(owner, webhookId string) error {
+	if _, err := c.Get(owner, webhookId); err != nil {
+		return err
+	}
+	if _, err := r.Table(c.config.Table).Get(webhookId).Delete().RunWrite(c.session); err != nil {
+		return fmt.Errorf("unable to delete webhook: %s", err.Error())
+	}
+	_, err := r.Table(c.config.DeliveriesTable).Between(
+		[]interface{}{webhookId, r.MinVal},
+		[]interface{}{webhookId, r.MaxVal},
+		r.BetweenOpts{Index: "webhook_created"},
+	).Delete().RunWrite(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to delete webhook deliveries: %s", err.Error())
+	}
+	return nil
+}
+
+// Sign returns the signature of a delivery's body, as sent in the
+// X-Beenthere-Signature header: "sha256=" followed by the hex encoded
+// HMAC-SHA256 of the body keyed by the webhook's secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
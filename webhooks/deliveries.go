@@ -0,0 +1,263 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/nstogner/beenthere-ws/profiles"
+	"github.com/nstogner/beenthere-ws/visits"
+)
+
+// deliveryBatch is the most due deliveries attempted at once.
+const deliveryBatch = 100
+
+// Payload is the JSON body POSTed to a webhook.
+type Payload struct {
+	Event   string        `json:"event" gorethink:"event"`
+	Created time.Time     `json:"created" gorethink:"created"`
+	Visit   *visits.Visit `json:"visit" gorethink:"visit"`
+}
+
+// Delivery is a db structure tracking the attempts to deliver an event to a
+// webhook.
+type Delivery struct {
+	ID          string     `json:"id" xml:"id" gorethink:"id"`
+	Webhook     string     `json:"webhook" xml:"webhook" gorethink:"webhook"`
+	Payload     Payload    `json:"payload" xml:"-" gorethink:"payload"`
+	Status      string     `json:"status" xml:"status" gorethink:"status"`
+	Attempts    int        `json:"attempts" xml:"attempts" gorethink:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt" xml:"next_attempt" gorethink:"next_attempt"`
+	LastStatus  int        `json:"last_status,omitempty" xml:"last_status,omitempty" gorethink:"last_status,omitempty"`
+	LastError   string     `json:"last_error,omitempty" xml:"last_error,omitempty" gorethink:"last_error,omitempty"`
+	Created     time.Time  `json:"created" xml:"created" gorethink:"created"`
+	Delivered   *time.Time `json:"delivered,omitempty" xml:"delivered,omitempty" gorethink:"delivered,omitempty"`
+}
+
+// GetDeliveries gets the log of deliveries to a webhook, most recent first.
+// When status is not empty, only deliveries with that status are included.
+func (c *Client) GetDeliveries(webhookId, status string, start, limit int) ([]Delivery, error) {
+	term := r.Table(c.config.DeliveriesTable).Between(
+		[]interface{}{webhookId, r.MinVal},
+		[]interface{}{webhookId, r.MaxVal},
+		r.BetweenOpts{Index: "webhook_created"},
+	).OrderBy(r.OrderByOpts{Index: r.Desc("webhook_created")})
+	if status != "" {
+		term = term.Filter(r.Row.Field("status").Eq(status))
+	}
+	result, err := term.Slice(start, start+limit).Run(c.session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get deliveries: %s", err.Error())
+	}
+	dels := make([]Delivery, 0)
+	var d Delivery
+	for result.Next(&d) {
+		dels = append(dels, d)
+		d = Delivery{}
+	}
+	return dels, nil
+}
+
+// Name returns the name of the webhooks' outbox queue.
+func (c *Client) Name() string {
+	return "webhooks"
+}
+
+// Publish queues a Delivery of an outbox event to every subscribed webhook
+// which may see it, which makes Client an outbox sink. Deliveries are
+// attempted by Deliver.
+func (c *Client) Publish(e *visits.Event) error {
+	if e.Visit == nil {
+		return nil
+	}
+	p := Payload{Event: e.Type, Created: e.Created, Visit: e.Visit}
+
+	result, err := r.Table(c.config.Table).GetAllByIndex("events", p.Event).Filter(
+		r.Row.Field("user").Default("").Eq("").Or(r.Row.Field("user").Eq(p.Visit.User)),
+	).Run(c.session)
+	if err != nil {
+		return fmt.Errorf("unable to get webhooks: %s", err.Error())
+	}
+	var profile *profiles.Profile
+	var w Webhook
+	for result.Next(&w) {
+		// Other users' visits are only delivered when they are public.
+		if w.Owner != p.Visit.User {
+			if p.Visit.Private {
+				w = Webhook{}
+				continue
+			}
+			if profile == nil {
+				if profile, err = c.config.Profiles.Get(p.Visit.User); err != nil {
+					return err
+				}
+			}
+			if profile.Visibility != profiles.VisibilityPublic {
+				w = Webhook{}
+				continue
+			}
+		}
+		// Delivery ids are derived from the event so that republishing an
+		// event does not queue it twice.
+		d := &Delivery{
+			ID:          e.ID + "/" + w.ID,
+			Webhook:     w.ID,
+			Payload:     p,
+			Status:      StatusPending,
+			NextAttempt: time.Now(),
+			Created:     time.Now(),
+		}
+		_, err := r.Table(c.config.DeliveriesTable).Insert(d).RunWrite(c.session)
+		if err != nil && !r.IsConflictErr(err) {
+			return fmt.Errorf("unable to queue delivery: %s", err.Error())
+		}
+		w = Webhook{}
+	}
+
+	// Wake up the delivery loop, unless it is already due to wake up.
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Deliver attempts every pending delivery which is due, up to Workers at
+// once, then waits for new deliveries to be queued or for retries to become
+// due. It blocks until a database error occurs.
+func (c *Client) Deliver() error {
+	ticker := time.NewTicker(c.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		result, err := r.Table(c.config.DeliveriesTable).Between(
+			[]interface{}{StatusPending, r.MinVal},
+			[]interface{}{StatusPending, time.Now()},
+			r.BetweenOpts{Index: "status_next", RightBound: "closed"},
+		).OrderBy(r.OrderByOpts{Index: "status_next"}).Limit(deliveryBatch).Run(c.session)
+		if err != nil {
+			return fmt.Errorf("unable to get due deliveries: %s", err.Error())
+		}
+		due := make([]Delivery, 0)
+		var d Delivery
+		for result.Next(&d) {
+			due = append(due, d)
+			d = Delivery{}
+		}
+		if err := c.attemptAll(due); err != nil {
+			return err
+		}
+		if len(due) == deliveryBatch {
+			continue
+		}
+		select {
+		case <-c.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// attemptAll attempts deliveries with a pool of Workers, so that slow
+// webhooks do not hold up the others. The first error is returned once every
+// delivery has been attempted.
+func (c *Client) attemptAll(due []Delivery) error {
+	jobs := make(chan *Delivery)
+	errs := make(chan error, len(due))
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.Workers && i < len(due); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				if err := c.attempt(d); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	for i := range due {
+		jobs <- &due[i]
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// attempt makes a single attempt at a delivery & records the outcome. Failed
+// deliveries are retried with exponential backoff until they run out of
+// attempts, at which point they are dead.
+func (c *Client) attempt(d *Delivery) error {
+	w, err := c.get(d.Webhook)
+	if err == ErrNotFound {
+		// The webhook was deleted after the delivery was queued.
+		if _, err := r.Table(c.config.DeliveriesTable).Get(d.ID).Delete().RunWrite(c.session); err != nil {
+			return fmt.Errorf("unable to delete delivery: %s", err.Error())
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	d.Attempts++
+	d.LastStatus, d.LastError = 0, ""
+	if err := c.post(w, d); err != nil {
+		d.LastError = err.Error()
+	} else {
+		now := time.Now()
+		d.Status, d.Delivered = StatusDelivered, &now
+	}
+	if d.Status == StatusPending {
+		backoff := c.config.Backoff
+		for i := 1; i < d.Attempts && backoff < MaxBackoff; i++ {
+			backoff *= 2
+		}
+		if backoff > MaxBackoff {
+			backoff = MaxBackoff
+		}
+		d.NextAttempt = time.Now().Add(backoff)
+		if d.Attempts >= c.config.MaxAttempts {
+			d.Status = StatusDead
+		}
+	}
+
+	if _, err := r.Table(c.config.DeliveriesTable).Get(d.ID).Replace(d).RunWrite(c.session); err != nil {
+		return fmt.Errorf("unable to save delivery: %s", err.Error())
+	}
+	return nil
+}
+
+// post sends a delivery's payload to its webhook. Any non-2xx response is an
+// error.
+func (c *Client) post(w *Webhook, d *Delivery) error {
+	body, err := json.Marshal(d.Payload)
+	if err != nil {
+		return fmt.Errorf("unable to marshal payload: %s", err.Error())
+	}
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Beenthere-Event", d.Payload.Event)
+	req.Header.Set("X-Beenthere-Delivery", d.ID)
+	req.Header.Set("X-Beenthere-Signature", Sign(w.Secret, body))
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body so that the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	d.LastStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}